@@ -54,7 +54,12 @@ func CommandAppInfo() cli.Command {
 			// fix up trailing/leading / from appnames
 			appname = strings.Trim(appname, "/")
 
-			err = pvr.GetApplicationInfo(appname)
+			src, err := pvr.GetApplicationSrc(appname)
+			if err == nil {
+				err = libpvr.PrintOutput(c.GlobalString("output"), src, func() error {
+					return pvr.GetApplicationInfo(appname)
+				})
+			}
 			if err != nil {
 				return cli.NewExitError(err, 3)
 			}
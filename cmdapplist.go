@@ -44,7 +44,16 @@ func CommandAppList() cli.Command {
 			if err != nil {
 				return cli.NewExitError(err, 2)
 			}
-			err = pvr.ListApplications()
+			format := c.GlobalString("output")
+			if format == "" || format == libpvr.OutputFormatTable {
+				err = pvr.ListApplications()
+			} else {
+				var apps []libpvr.AppData
+				apps, err = pvr.GetApplications()
+				if err == nil {
+					err = libpvr.PrintOutput(format, apps, pvr.ListApplications)
+				}
+			}
 			if err != nil {
 				return cli.NewExitError(err, 3)
 			}
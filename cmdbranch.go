@@ -0,0 +1,106 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandBranch() cli.Command {
+	return cli.Command{
+		Name:        "branch",
+		Aliases:     []string{"br"},
+		ArgsUsage:   "[<name> [<revision>]]",
+		Usage:       "list, create or delete branches of the local repository",
+		Description: "without arguments all branches are listed with the current one marked by '*'. With <name> a new branch is created at <revision> (default: HEAD).",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			if c.NArg() > 2 {
+				return cli.NewExitError("branch can have at most 2 arguments. See --help.", 1)
+			}
+
+			if c.Bool("delete") {
+				if c.NArg() != 1 {
+					return cli.NewExitError("branch --delete needs exactly one branch name. See --help.", 1)
+				}
+				err = pvr.DeleteBranch(c.Args()[0])
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				return nil
+			}
+
+			if c.NArg() > 0 {
+				err = pvr.CreateBranch(c.Args()[0], c.Args().Get(1), c.Bool("force"))
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				return nil
+			}
+
+			branches, err := pvr.ListBranches()
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), branches, func() error {
+				for _, b := range branches {
+					marker := " "
+					if b.Current {
+						marker = "*"
+					}
+					fmt.Printf("%s %s %s\n", marker, b.Sha[:libpvr.Min(12, len(b.Sha))], b.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "delete, d",
+				Usage: "delete the named branch",
+			},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "move the branch if it already exists",
+			},
+		},
+	}
+}
@@ -0,0 +1,35 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"github.com/urfave/cli"
+)
+
+// CommandCache : pvr cache command
+func CommandCache() cli.Command {
+	cmd := cli.Command{
+		Name: "cache",
+		Subcommands: []cli.Command{
+			CommandCacheList(),
+			CommandCachePrune(),
+		},
+		Usage:       "pvr cache <ls|prune>: manage the object cache shared by working copies",
+		Description: "\nclone, get and app install keep objects in a content addressed cache in the config dir shared by all working copies.\n1.List the working copies using the object cache\n2.Remove objects no working copy references anymore",
+	}
+	return cmd
+}
@@ -0,0 +1,59 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// CommandCacheList : pvr cache ls command
+func CommandCacheList() cli.Command {
+	cmd := cli.Command{
+		Name:        "ls",
+		Aliases:     []string{"l"},
+		ArgsUsage:   "",
+		Usage:       "pvr cache ls: list the working copies using the object cache",
+		Description: "List the working copies recorded as users of the object cache with the number of objects they referenced at their last get or commit",
+		Action: func(c *cli.Context) error {
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			repos, err := libpvr.CacheRepos(session)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), repos, func() error {
+				for _, r := range repos {
+					fmt.Printf("%s\t%d objects\t%s\n", r.Path, len(r.Objects),
+						r.Updated.Format("2006-01-02 15:04:05"))
+				}
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
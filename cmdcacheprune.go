@@ -0,0 +1,108 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// CommandCachePrune : pvr cache prune command
+func CommandCachePrune() cli.Command {
+	cmd := cli.Command{
+		Name:      "prune",
+		ArgsUsage: "[<working-copy> ...]",
+		Usage:     "pvr cache prune: remove objects no working copy references from the object cache",
+		Description: "objects referenced by the current state, staged files and the history of any working copy using the object cache are kept. " +
+			"Working copies are recorded by clone, get and commit; pass working copies not used since upgrading pvr as arguments so their objects are kept too. " +
+			"Objects older than the first recorded working copy are kept unless --all-registered tells that all working copies using the cache are recorded or passed. " +
+			"Deleted working copies are forgotten. Objects younger than an hour are always kept as a get might still be running.",
+		Action: func(c *cli.Context) error {
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			for _, dir := range c.Args() {
+				other, err := libpvr.NewPvr(session, dir)
+				if err != nil {
+					return cli.NewExitError(err, 2)
+				}
+				if !other.Initialized {
+					return cli.NewExitError(dir+" is not a pvr working copy.", 2)
+				}
+				if !other.UsesObjectCache() {
+					return cli.NewExitError(dir+" does not use the object cache.", 2)
+				}
+				err = other.TrackObjectCache()
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+			}
+
+			result, err := libpvr.CachePrune(session, c.Bool("dry-run"), c.Int("keep-days"), c.Bool("all-registered"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			verb := "Removed"
+			forgot := "Forgot"
+			if c.Bool("dry-run") {
+				verb = "Would remove"
+				forgot = "Would forget"
+			}
+			for _, dir := range result.Forgotten {
+				fmt.Println(forgot + " working copy " + dir)
+			}
+			for _, sha := range result.Removed {
+				fmt.Println(verb + " object " + sha)
+			}
+			for _, name := range result.Temp {
+				fmt.Println(verb + " temporary file " + name)
+			}
+
+			fmt.Println(verb + " " + strconv.Itoa(len(result.Removed)) + " unreferenced objects (" +
+				strconv.FormatInt(result.RemovedBytes, 10) + " bytes) and " +
+				strconv.Itoa(len(result.Temp)) + " temporary files (" +
+				strconv.FormatInt(result.TempBytes, 10) + " bytes); kept " +
+				strconv.Itoa(result.Reachable) + " objects referenced by " +
+				strconv.Itoa(len(result.Repos)) + " working copies and " +
+				strconv.Itoa(len(result.Kept)) + " recent or possibly unrecorded objects.")
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run, n",
+				Usage: "only report what would be removed",
+			},
+			cli.IntFlag{
+				Name:  "keep-days",
+				Usage: "keep unreferenced objects modified within the last `DAYS` days",
+				Value: 0,
+			},
+			cli.BoolFlag{
+				Name:  "all-registered",
+				Usage: "all working copies using the cache are recorded or passed; also remove objects older than the first record",
+			},
+		},
+	}
+	return cmd
+}
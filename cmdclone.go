@@ -126,6 +126,7 @@ func CommandClone() cli.Command {
 				return cli.NewExitError(err, 20)
 			}
 
+			pvr.Retries = c.Int("retries")
 			_, err = pvr.GetRepo(deviceString, false, false, nil)
 			if err != nil {
 				return cli.NewExitError(err, 7)
@@ -142,6 +143,15 @@ func CommandClone() cli.Command {
 				return cli.NewExitError(err, 9)
 			}
 
+			// the object cache has to know the final location
+			pvr, err = libpvr.NewPvr(session, base)
+			if err == nil {
+				err = pvr.TrackObjectCache()
+			}
+			if err != nil {
+				return cli.NewExitError(err, 9)
+			}
+
 			fmt.Println("Successfully cloned: " + base)
 
 			return nil
@@ -150,7 +160,7 @@ func CommandClone() cli.Command {
 			cli.StringFlag{
 				Name:   "objects, o",
 				EnvVar: "PVR_OBJECTS_DIR",
-				Usage:  "Use `OBJECTS` directory for storing the file objects. Can be absolue or relative to working directory.",
+				Usage:  "Use `OBJECTS` directory for storing the file objects. Can be absolue or relative to working directory, or s3://<host>/<bucket>[/<prefix>] for an S3 compatible object store.",
 			},
 			cli.BoolFlag{
 				Name:   "canonical, c",
@@ -162,6 +172,11 @@ func CommandClone() cli.Command {
 				Usage: "Use `SPEC` as state format (e.g. pantavisor-service-system@1 or pantavisor-multi-platform@1 (legacy)",
 				Value: "pantavisor-service-system@1",
 			},
+			cli.IntFlag{
+				Name:  "retries",
+				Usage: "fetch failed or corrupt objects up to `N` more times",
+				Value: 2,
+			},
 		},
 	}
 
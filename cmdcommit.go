@@ -52,7 +52,7 @@ func CommandCommit() cli.Command {
 			}
 			isCheckpoint := c.Bool("checkpoint")
 
-			err = pvr.Commit(commitmsg, isCheckpoint)
+			err = pvr.Commit(commitmsg, c.String("author"), isCheckpoint)
 			if err != nil {
 				return err
 			}
@@ -64,6 +64,11 @@ func CommandCommit() cli.Command {
 				Name:  "message, m",
 				Usage: "provide a commit message",
 			},
+			cli.StringFlag{
+				Name:   "author",
+				Usage:  "record `AUTHOR` as author of the revision in local history (default: user@host)",
+				EnvVar: "PVR_AUTHOR",
+			},
 			cli.BoolFlag{
 				Name:  "checkpoint, c",
 				Usage: "commit an updated checkpoint token to ensure this revision will get properly tested and checkpointed as a fallback revision",
@@ -97,6 +97,8 @@ func CommandDeploy() cli.Command {
 			}
 
 			merge := !c.Bool("nomerge")
+			// later repositories are layered on top of earlier ones
+			deployPvr.MergeStrategy = libpvr.MergeStrategyTheirs
 			if c.NArg() > 1 {
 				for _, repoPath = range c.Args()[1:] {
 					repoPath, err = libpvr.FixupRepoRef(repoPath)
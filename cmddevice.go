@@ -32,9 +32,12 @@ func CommandDevice() cli.Command {
 			CommandDeviceCreate(),
 			CommandDeviceGet(),
 			CommandDeviceSet(),
+			CommandDeviceHistory(),
+			CommandDeviceWait(),
+			CommandDeviceRollback(),
 		},
-		Usage:       "pvr device <ps|logs|scan>",
-		Description: "\n1.Show Owned Devices\n 2.Get logs for your devices (early preview)\n 3.Scan for pantavisor devices announcing themselves through MDNS on local network.\n4.Create new device\n5.Set device user-meta|device-meta fields (Note:If you are logged in as USER then you can update user-meta field but if you are logged in as DEVICE then you can update device-meta field)",
+		Usage:       "pvr device <ps|logs|scan|create|get|set|history|wait|rollback>",
+		Description: "\n1.Show Owned Devices\n 2.Get logs for your devices (early preview)\n 3.Scan for pantavisor devices announcing themselves through MDNS on local network.\n4.Create new device\n5.Set device user-meta|device-meta fields (Note:If you are logged in as USER then you can update user-meta field but if you are logged in as DEVICE then you can update device-meta field)\n6.List the revisions of a device\n7.Wait until a device finished updating\n8.Roll a device back to an earlier revision",
 	}
 	return cmd
 }
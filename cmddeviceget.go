@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	"gitlab.com/pantacor/pvr/libpvr"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
 
 	"github.com/urfave/cli"
 )
@@ -84,7 +85,17 @@ func CommandDeviceGet() cli.Command {
 			if err != nil {
 				return cli.NewExitError(err, 2)
 			}
-			libpvr.LogPrettyJSON(deviceResponse.Body())
+			var device interface{}
+			err = pvjson.Unmarshal(deviceResponse.Body(), &device)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+			err = libpvr.PrintOutput(c.GlobalString("output"), device, func() error {
+				return libpvr.LogPrettyJSON(deviceResponse.Body())
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
 			return nil
 		},
 	}
@@ -0,0 +1,113 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	duration "github.com/ChannelMeter/iso8601duration"
+	"github.com/justincampbell/timeago"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandDeviceHistory() cli.Command {
+	return cli.Command{
+		Name:        "history",
+		Aliases:     []string{"hist"},
+		ArgsUsage:   "<NICK|ID> | <USER_NICK>/<NICK|ID>",
+		Usage:       "pvr device history <NICK|ID>: list the revisions of a device",
+		Description: "Page through the trail of a device from the latest revision backwards, showing commit message, progress and state of each step",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.NewExitError(errors.New("Device ID or Nick is required. See --help"), 2)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			baseURL := c.App.Metadata["PVR_BASEURL"].(string)
+
+			var since time.Time
+			if c.String("since") != "" {
+				since, err = libpvr.ParseRFC3339(c.String("since"))
+				if err != nil {
+					parsedDuration, err := duration.FromString(c.String("since"))
+					if err != nil {
+						return cli.NewExitError(err, 5)
+					}
+					since = time.Now().Local().Add(-parsedDuration.ToDuration())
+				}
+			}
+
+			deviceId, err := session.ResolveDevice(baseURL, c.Args()[0])
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			steps, err := session.GetTrailSteps(baseURL, deviceId, since, c.Int("limit"))
+			if err != nil {
+				return cli.NewExitError("Error getting device history: "+err.Error(), 4)
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), steps, func() error {
+				table := tablewriter.NewWriter(os.Stdout)
+				table.SetBorder(false)
+				table.SetHeaderLine(false)
+				table.SetColumnSeparator(" ")
+				table.SetAutoWrapText(false)
+				table.SetHeader([]string{"rev", "status", "progress", "state", "posted", "updated", "message", "status-msg"})
+
+				for _, v := range steps {
+					table.Append([]string{
+						strconv.Itoa(v.Rev),
+						v.Progress.Status,
+						strconv.Itoa(v.Progress.Progress) + "%",
+						v.StateSha[:min(len(v.StateSha), 8)],
+						v.StepTime.Local().Format("2006-01-02 15:04:05"),
+						timeago.FromTime(v.ProgressTime),
+						v.CommitMsg,
+						v.Progress.StatusMsg})
+				}
+
+				table.Render()
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "since, s",
+				Usage: "only list revisions posted after `SINCE`, a RFC3339 date or ISO8601 duration ago, e.g.: --since=P7D",
+			},
+			cli.IntFlag{
+				Name:  "limit, n",
+				Usage: "list at most `LIMIT` revisions; 0 lists all",
+				Value: 20,
+			},
+		},
+	}
+}
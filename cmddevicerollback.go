@@ -0,0 +1,100 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandDeviceRollback() cli.Command {
+	return cli.Command{
+		Name:      "rollback",
+		ArgsUsage: "<NICK|ID> | <USER_NICK>/<NICK|ID>",
+		Usage:     "pvr device rollback <NICK|ID> [--to REV]: post the state of an earlier revision as a new revision",
+		Description: "Fetch the state of an earlier revision of a device and post it again as a new revision, " +
+			"without a local checkout. Without --to the latest revision before the current one that the device " +
+			"finished with DONE or UPDATED is used. Fails if any object of that state is not available anymore.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.NewExitError(errors.New("Device ID or Nick is required. See --help"), 2)
+			}
+
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			baseURL := c.App.Metadata["PVR_BASEURL"].(string)
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			deviceId, err := session.ResolveDevice(baseURL, c.Args()[0])
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			result, err := pvr.RollbackDevice(baseURL, deviceId, c.Int("to"), c.String("commit-msg"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			if c.Bool("wait") {
+				rev, err := strconv.Atoi(result.Rev)
+				if err != nil {
+					return cli.NewExitError("cannot wait for revision '"+result.Rev+"' posted to "+result.TrailId, 3)
+				}
+				return waitForDevice(session, baseURL, result.TrailId, rev,
+					c.Duration("wait-timeout"), 10*time.Second)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "to, r",
+				Usage: "roll back to revision `REV`; -1 is the latest successful revision before the current one",
+				Value: -1,
+			},
+			cli.StringFlag{
+				Name:  "commit-msg, m",
+				Usage: "commit message of the new revision; defaults to 'Rollback to revision REV'",
+			},
+			cli.BoolFlag{
+				Name:  "wait, w",
+				Usage: "wait until the device finished the new revision (see pvr device wait)",
+			},
+			cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "give up waiting after `TIMEOUT`",
+				Value: 20 * time.Minute,
+			},
+		},
+	}
+}
@@ -0,0 +1,108 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// exit codes of pvr device wait and pvr post --wait
+const (
+	exitWaitFailed  = 10
+	exitWaitTimeout = 11
+)
+
+func CommandDeviceWait() cli.Command {
+	return cli.Command{
+		Name:      "wait",
+		ArgsUsage: "<NICK|ID> | <USER_NICK>/<NICK|ID>",
+		Usage:     "pvr device wait <NICK|ID>: wait until a device finished updating to a revision",
+		Description: "Poll the progress of a revision (default: the latest) of a device and print its status transitions. " +
+			"Exits with 0 once the device reports DONE or UPDATED, " + fmt.Sprint(exitWaitFailed) + " if it reports ERROR or WONTGO (including rollbacks) " +
+			"and " + fmt.Sprint(exitWaitTimeout) + " on timeout.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.NewExitError(errors.New("Device ID or Nick is required. See --help"), 2)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			baseURL := c.App.Metadata["PVR_BASEURL"].(string)
+
+			deviceId, err := session.ResolveDevice(baseURL, c.Args()[0])
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			return waitForDevice(session, baseURL, deviceId, c.Int("rev"),
+				c.Duration("timeout"), c.Duration("interval"))
+		},
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "rev, r",
+				Usage: "wait for revision `REV`; -1 is the latest",
+				Value: -1,
+			},
+			cli.DurationFlag{
+				Name:  "timeout, t",
+				Usage: "give up after `TIMEOUT`",
+				Value: 20 * time.Minute,
+			},
+			cli.DurationFlag{
+				Name:  "interval, i",
+				Usage: "poll the device progress every `INTERVAL`",
+				Value: 10 * time.Second,
+			},
+		},
+	}
+}
+
+// waitForDevice waits for revision rev of deviceId and maps the outcome to
+// the exit codes of pvr device wait
+func waitForDevice(session *libpvr.Session, baseURL string, deviceId string, rev int,
+	timeout time.Duration, interval time.Duration) error {
+
+	step, err := session.WaitForStep(baseURL, deviceId, rev, timeout, interval,
+		func(step *libpvr.PantahubStep) {
+			fmt.Fprintf(os.Stderr, "%s rev %d: %s %d%% %s\n", time.Now().Format("15:04:05"),
+				step.Rev, step.Progress.Status, step.Progress.Progress, step.Progress.StatusMsg)
+		})
+
+	switch err {
+	case nil:
+		fmt.Printf("Device %s finished revision %d: %s\n", deviceId, step.Rev, step.Progress.Status)
+		return nil
+	case libpvr.ErrStepFailed:
+		return cli.NewExitError(fmt.Sprintf("Device %s failed revision %d: %s %s", deviceId,
+			step.Rev, step.Progress.Status, step.Progress.StatusMsg), exitWaitFailed)
+	case libpvr.ErrWaitTimeout:
+		status := "no progress"
+		if step != nil {
+			status = fmt.Sprintf("revision %d is %s", step.Rev, step.Progress.Status)
+		}
+		return cli.NewExitError("Timeout after "+timeout.String()+" waiting for device "+deviceId+"; "+status, exitWaitTimeout)
+	}
+	return cli.NewExitError(err, 4)
+}
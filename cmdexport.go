@@ -31,7 +31,7 @@ func CommandExport() cli.Command {
 		Aliases:     []string{"g"},
 		ArgsUsage:   "<export-file>",
 		Usage:       "export repo into single file (tarball)",
-		Description: "if export file ends with .gz or .tgz it will create a zipped tarball. Otherwise plain",
+		Description: "if export file ends with .gz or .tgz it will create a zipped tarball. Otherwise plain. With --ref the state of that branch or tag is exported instead of the current one.",
 		Action: func(c *cli.Context) error {
 			wd, err := os.Getwd()
 			if err != nil {
@@ -61,7 +61,7 @@ func CommandExport() cli.Command {
 			} else {
 				parts = []string{}
 			}
-			err = pvr.Export(parts, c.Args()[0])
+			err = pvr.Export(parts, c.Args()[0], c.String("ref"))
 			if err != nil {
 				return cli.NewExitError(err, 3)
 			}
@@ -73,6 +73,10 @@ func CommandExport() cli.Command {
 				Name:  "parts, p",
 				Usage: "comma separate list of parts to export; if empty we export all",
 			},
+			cli.StringFlag{
+				Name:  "ref, r",
+				Usage: "export the state of branch or tag `REF` instead of the current one",
+			},
 		},
 	}
 }
@@ -61,11 +61,11 @@ func CommandFastCopy() cli.Command {
 			if err != nil {
 				return cli.NewExitError(err, 2)
 			}
-			src, err = libpvr.FixupRepoRef(src)
+			src, err = pvr.FixupRepoRef(src)
 			if err != nil {
 				return cli.NewExitError(err, 7)
 			}
-			dest, err = libpvr.FixupRepoRef(dest)
+			dest, err = pvr.FixupPostRepoRef(dest)
 			if err != nil {
 				return cli.NewExitError(err, 8)
 			}
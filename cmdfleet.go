@@ -0,0 +1,34 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"github.com/urfave/cli"
+)
+
+// CommandFleet : pvr fleet command
+func CommandFleet() cli.Command {
+	cmd := cli.Command{
+		Name: "fleet",
+		Subcommands: []cli.Command{
+			CommandFleetPost(),
+		},
+		Usage:       "pvr fleet <post>: operate on many devices at once",
+		Description: "\nDevices are picked with a selector, a comma separated list of KEY=VALUE, KEY!=VALUE, KEY=~PATTERN or KEY!~PATTERN terms matched against the device documents, e.g. 'user-meta.site=berlin,nick!=test' or 'nick=~cam-*'.",
+	}
+	return cmd
+}
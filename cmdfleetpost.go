@@ -0,0 +1,149 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandFleetPost() cli.Command {
+	return cli.Command{
+		Name:  "post",
+		Usage: "pvr fleet post --selector <SELECTOR> [--part PART]: post the local state to all selected devices",
+		Description: "Post the local state, or with --part only that part merged into the current state of each device, " +
+			"as a new revision to every device matching the selector. Objects are uploaded once for the whole batch. " +
+			"Prints a report per device and fails if any post failed.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 0 {
+				return cli.NewExitError(errors.New("fleet post takes no arguments. See --help"), 2)
+			}
+			if c.String("selector") == "" {
+				return cli.NewExitError(errors.New("--selector is required. See --help"), 2)
+			}
+
+			selector, err := libpvr.ParseDeviceSelector(c.String("selector"))
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			baseURL := c.App.Metadata["PVR_BASEURL"].(string)
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+			if !pvr.Initialized {
+				return cli.NewExitError(errors.New("fleet post needs a pvr checkout with the state to post"), 2)
+			}
+
+			devices, err := session.SelectDevices(baseURL, selector)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			if len(devices) == 0 {
+				return cli.NewExitError("no device matches selector '"+c.String("selector")+"'", 3)
+			}
+
+			results := pvr.FleetPost(baseURL, devices, c.String("part"), c.String("envelope"),
+				c.String("commit-msg"), c.Int("max-parallel"), c.Bool("force"), nil)
+
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
+				}
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), results, func() error {
+				table := tablewriter.NewWriter(os.Stdout)
+				table.SetBorder(false)
+				table.SetHeaderLine(false)
+				table.SetColumnSeparator(" ")
+				table.SetAutoWrapText(false)
+				table.SetHeader([]string{"device", "nick", "rev", "state", "result"})
+
+				for _, r := range results {
+					result := "OK"
+					if r.Error != "" {
+						result = "FAILED: " + r.Error
+					}
+					table.Append([]string{
+						r.Device.Id,
+						r.Device.Nick,
+						r.Rev,
+						r.StateSha[:min(len(r.StateSha), 8)],
+						result})
+				}
+
+				table.Render()
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			if failed > 0 {
+				return cli.NewExitError(fmt.Sprintf("%d of %d device posts failed", failed, len(results)), 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "selector, l",
+				Usage: "post to the devices matching `SELECTOR`, e.g.: user-meta.site=berlin",
+			},
+			cli.StringFlag{
+				Name:  "part, p",
+				Usage: "only post `PART` of the local state, merged into the current state of each device",
+			},
+			cli.IntFlag{
+				Name:  "max-parallel, j",
+				Usage: "talk to at most `N` devices at once",
+				Value: 10,
+			},
+			cli.StringFlag{
+				Name:  "envelope, e",
+				Usage: "provide the json envelope to wrap around the pvr post",
+				Value: "{}",
+			},
+			cli.StringFlag{
+				Name:  "commit-msg, m",
+				Usage: "add commit message to the new revisions",
+			},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "force upload of objects even if the remote has them already",
+			},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandFsck() cli.Command {
+	return cli.Command{
+		Name:      "fsck",
+		ArgsUsage: "",
+		Usage:     "check the consistency of the local repository",
+		Description: "re-hashes all objects, checks that all objects referenced by the pristine state exist, validates #spec, " +
+			"the json syntax of checked out inline json files, the staging index and the local history. " +
+			"With --repair corrupt objects and stale temporary files are removed, a corrupt staging index is moved aside " +
+			"and missing objects are fetched from the default get url again.",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			repair := c.Bool("repair")
+
+			// NewPvr refuses a corrupt index, so check that first
+			indexProblem, err := libpvr.FsckIndex(filepath.Join(wd, ".pvr"), repair)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			result, err := pvr.Fsck(repair)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			if indexProblem != nil {
+				result.Problems = append([]libpvr.PvrFsckProblem{*indexProblem}, result.Problems...)
+			}
+
+			unrepaired := 0
+			for _, problem := range result.Problems {
+				if !problem.Repaired {
+					unrepaired++
+				}
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), result, func() error {
+				for _, problem := range result.Problems {
+					fmt.Println(problem)
+				}
+				fmt.Println("Checked " + strconv.Itoa(result.Objects) + " objects; found " +
+					strconv.Itoa(len(result.Problems)) + " problems, " +
+					strconv.Itoa(len(result.Problems)-unrepaired) + " repaired.")
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			if unrepaired > 0 {
+				return cli.NewExitError("Repository is not consistent.", 5)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "repair",
+				Usage: "repair what can be repaired",
+			},
+		},
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandGc() cli.Command {
+	return cli.Command{
+		Name:      "gc",
+		ArgsUsage: "[<other-working-copy> ...]",
+		Usage:     "remove objects not referenced by the repository from the objects directory",
+		Description: "all objects referenced by the current state, staged files and the history reachable from HEAD, branches and tags are kept. " +
+			"If the objects directory is shared (e.g. by pvr deploy) the other working copies using it must be passed as arguments so their objects are kept too. " +
+			"For the shared object cache the objects of all working copies recorded as its users are kept (see pvr cache prune). " +
+			"Leftover .new files of interrupted copies are removed once they are older than an hour.",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			others := []*libpvr.Pvr{}
+			for _, dir := range c.Args() {
+				other, err := libpvr.NewPvr(session, dir)
+				if err != nil {
+					return cli.NewExitError(err, 2)
+				}
+				if !other.Initialized {
+					return cli.NewExitError(dir+" is not a pvr working copy.", 2)
+				}
+				others = append(others, other)
+			}
+
+			if pvr.HasSharedObjects() && !pvr.UsesObjectCache() && len(others) == 0 {
+				return cli.NewExitError("objects "+pvr.Objects.String()+" are shared; pass the other working copies using it. See --help.", 5)
+			}
+
+			result, err := pvr.Gc(c.Bool("dry-run"), c.Int("keep-days"), others)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			verb := "Removed"
+			if c.Bool("dry-run") {
+				verb = "Would remove"
+			}
+			for _, sha := range result.Removed {
+				fmt.Println(verb + " object " + sha)
+			}
+			for _, name := range result.Temp {
+				fmt.Println(verb + " temporary file " + name)
+			}
+
+			fmt.Println(verb + " " + strconv.Itoa(len(result.Removed)) + " unreferenced objects (" +
+				strconv.FormatInt(result.RemovedBytes, 10) + " bytes) and " +
+				strconv.Itoa(len(result.Temp)) + " temporary files (" +
+				strconv.FormatInt(result.TempBytes, 10) + " bytes); kept " +
+				strconv.Itoa(result.Reachable) + " referenced and " +
+				strconv.Itoa(len(result.Kept)) + " recent objects.")
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run, n",
+				Usage: "only report what would be removed",
+			},
+			cli.IntFlag{
+				Name:  "keep-days",
+				Usage: "keep unreferenced objects modified within the last `DAYS` days",
+				Value: 0,
+			},
+		},
+	}
+}
@@ -31,9 +31,9 @@ func CommandGet() cli.Command {
 	return cli.Command{
 		Name:        "get",
 		Aliases:     []string{"g"},
-		ArgsUsage:   "[<repository>[#<part>] [<target-repository>]] | [<USER_NICK>/<DEVICE_NICK>[#<part>]]",
+		ArgsUsage:   "[<repository>[@<ref>][#<part>] [<target-repository>]] | [<USER_NICK>/<DEVICE_NICK>[#<part>]]",
 		Usage:       "get update target-repository from repository",
-		Description: "default target-repository is the local .pvr one. If not <repository> is provided the last one is used. <part> can be one of 'bsp' or $appname.",
+		Description: "default target-repository is the local .pvr one. If not <repository> is provided the last one is used. <part> can be one of 'bsp' or $appname. For local repositories @<ref> selects the state of a branch or tag.",
 		BashComplete: func(c *cli.Context) {
 			if c.GlobalString("baseurl") != "" {
 				c.App.Metadata["PVR_BASEURL"] = c.GlobalString("baseurl")
@@ -67,6 +67,13 @@ func CommandGet() cli.Command {
 				return cli.NewExitError(err, 2)
 			}
 
+			err = libpvr.ValidateMergeStrategy(c.String("strategy"))
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+			pvr.MergeStrategy = c.String("strategy")
+			pvr.Retries = c.Int("retries")
+
 			var repoUri string
 
 			if c.NArg() > 1 {
@@ -74,7 +81,7 @@ func CommandGet() cli.Command {
 			} else if c.NArg() == 0 {
 				repoUri = ""
 			} else {
-				repoUri, err = libpvr.FixupRepoRef(c.Args()[0])
+				repoUri, err = pvr.FixupRepoRef(c.Args()[0])
 				if err != nil {
 					return cli.NewExitError(err, 1)
 				}
@@ -85,10 +92,31 @@ func CommandGet() cli.Command {
 				return cli.NewExitError(err, 3)
 			}
 
-			fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + pvr.Objdir)
+			fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + pvr.Objects.String())
 			fmt.Println("\n\nRun pvr checkout to checkout the changed files into the workspace.")
 
+			conflicts, err := pvr.GetConflicts()
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+			if conflicts != nil {
+				return cli.NewExitError("Merge left "+strconv.Itoa(len(conflicts.Conflicts))+
+					" conflicts; fix them in the workspace and run pvr resolve.", 5)
+			}
+
 			return nil
 		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "strategy, s",
+				Usage: "how to handle changes made on both sides: conflict, ours or theirs",
+				Value: libpvr.MergeStrategyConflict,
+			},
+			cli.IntFlag{
+				Name:  "retries",
+				Usage: "fetch failed or corrupt objects up to `N` more times",
+				Value: 2,
+			},
+		},
 	}
 }
@@ -68,7 +68,7 @@ func CommandInit() cli.Command {
 			cli.StringFlag{
 				Name:   "objects, o",
 				EnvVar: "PVR_OBJECTS_DIR",
-				Usage:  "Use `OBJECTS` directory for storing the file objects. Can be absolute or relative to working directory.",
+				Usage:  "Use `OBJECTS` directory for storing the file objects. Can be absolute or relative to working directory, or s3://<host>/<bucket>[/<prefix>] for an S3 compatible object store.",
 			},
 			cli.StringFlag{
 				Name:  "spec, s",
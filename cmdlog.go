@@ -0,0 +1,147 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// revisionOutput adds the sha, which is not part of the stored revision,
+// to json and yaml output
+type revisionOutput struct {
+	Sha string `json:"sha"`
+	*libpvr.PvrRevision
+}
+
+func printRevision(rev *libpvr.PvrRevision) {
+	fmt.Println("revision " + rev.Sha)
+	if rev.Parent != "" {
+		fmt.Println("Parent: " + rev.Parent)
+	}
+	fmt.Println("Author: " + rev.Author)
+	fmt.Println("Date:   " + rev.Time.Local().Format("Mon Jan 2 15:04:05 2006 -0700"))
+	fmt.Println("State:  " + rev.StateSha)
+	fmt.Println()
+	for _, l := range strings.Split(rev.Message, "\n") {
+		fmt.Println("    " + l)
+	}
+	fmt.Println()
+}
+
+// runLogsDeprecated runs the action of the logs command; the log command
+// accepts the flags of logs for that
+func runLogsDeprecated(c *cli.Context) error {
+	fmt.Fprintln(os.Stderr, "DEPRECATED: pvr log outside of a pvr repository runs pvr logs; use pvr device logs instead. pvr log now shows the local revision history.")
+	return CommandLogs().Action.(func(*cli.Context) error)(c)
+}
+
+// hiddenFlags returns flags hidden from the help output
+func hiddenFlags(flags []cli.Flag) []cli.Flag {
+	hidden := []cli.Flag{}
+	for _, f := range flags {
+		switch t := f.(type) {
+		case cli.StringFlag:
+			t.Hidden = true
+			f = t
+		case cli.IntFlag:
+			t.Hidden = true
+			f = t
+		case cli.BoolFlag:
+			t.Hidden = true
+			f = t
+		}
+		hidden = append(hidden, f)
+	}
+	return hidden
+}
+
+func CommandLog() cli.Command {
+	return cli.Command{
+		Name:        "log",
+		ArgsUsage:   "[<revision>]",
+		Usage:       "show local revision history",
+		Description: "list revisions committed in this repository starting at <revision> (default: HEAD)",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			// "pvr log" used to be an alias of the deprecated "pvr logs";
+			// outside of a pvr repository keep running that for now
+			if !pvr.Initialized {
+				return runLogsDeprecated(c)
+			}
+
+			if c.NArg() > 1 {
+				return cli.NewExitError("log can have at most 1 argument. See --help.", 1)
+			}
+
+			revs, err := pvr.Log(c.Args().First(), c.Int("max-count"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			output := []revisionOutput{}
+			for _, rev := range revs {
+				output = append(output, revisionOutput{Sha: rev.Sha, PvrRevision: rev})
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), output, func() error {
+				for _, rev := range revs {
+					if c.Bool("oneline") {
+						fmt.Println(rev.Sha[:12] + " " + strings.SplitN(rev.Message, "\n", 2)[0])
+						continue
+					}
+					printRevision(rev)
+				}
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: append([]cli.Flag{
+			cli.IntFlag{
+				Name:  "max-count, n",
+				Usage: "show at most `N` revisions",
+			},
+			cli.BoolFlag{
+				Name:  "oneline",
+				Usage: "show each revision as short sha and first line of its message",
+			},
+		}, hiddenFlags(CommandLogs().Flags)...),
+	}
+}
@@ -17,12 +17,15 @@
 package main
 
 import (
+	"io"
 	"log"
+	"os"
 	"strings"
 	"time"
 
 	duration "github.com/ChannelMeter/iso8601duration"
 	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pantahub-base/logs"
 	"gitlab.com/pantacor/pvr/libpvr"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -150,42 +153,82 @@ func CommandLogs() cli.Command {
 				Platforms: platforms,
 			}
 
-			var logFormatter libpvr.LogFormatter
+			checkpoint, err := libpvr.LoadLogCheckpoint(c.String("checkpoint"))
+			if err != nil {
+				return cli.NewExitError(err, 5)
+			}
+			// a checkpoint continues where the previous run stopped
+			if checkpoint.From() != nil {
+				from = checkpoint.From()
+			}
+
+			if c.Bool("until-now") && to == nil {
+				_t := time.Now()
+				to = &_t
+			}
+
+			// formatters default to the terminal without out file
+			var out io.Writer
+			var outFile *os.File
 			logFormat := c.String("template")
-			switch logFormat {
-			case "json":
-				logFormatter = &libpvr.LogFormatterJson{}
-				break
-			default:
-				logFormatter = &libpvr.LogFormatterTemplate{}
-				logFormatter.Init("{{ .Device | prn2id " +
-					"| sprintf \"%10.10s\" }}" +
-					"({{ .LogRev | sprintf \"%3s\" }}) " +
-					"{{ .TimeCreated | timeformat \"Stamp\" }}" +
-					"{{ .LogPlat | sprintf \"%12s\" }}(" +
-					"{{ .LogSource |  basename | sprintf \"%-15.15s\"}})" +
-					": {{ .LogText }}")
-				break
+			if c.String("out") != "" {
+				outFile, err = os.OpenFile(c.String("out"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+				if err != nil {
+					return cli.NewExitError(err, 5)
+				}
+				defer outFile.Close()
+				out = outFile
+				if logFormat == "" {
+					logFormat = "json"
+				}
 			}
 
-			for {
-				logEntries, cursorID, err := session.DoLogs(c.App.Metadata["PVR_BASEURL"].(string), nil, rev, from, to, true, logFilter)
+			logFormatter, err := libpvr.NewLogFormatter(logFormat, out)
+			if err != nil {
+				return cli.NewExitError(err, 5)
+			}
 
+			if c.String("grep") != "" || c.String("grep-v") != "" {
+				logFormatter, err = libpvr.NewLogFormatterGrep(logFormatter, c.String("grep"), c.String("grep-v"))
 				if err != nil {
-					return cli.NewExitError("Error getting device list: "+err.Error(), 4)
+					return cli.NewExitError(err, 5)
 				}
+			}
 
+			// writeLogs writes the entries not read before and saves the
+			// checkpoint once they are on disk
+			writeLogs := func(logEntries []*logs.Entry) error {
 				for _, v := range logEntries {
-					cutDeviceStart := strings.LastIndex(v.Device, "/")
-					if cutDeviceStart < 0 {
-						cutDeviceStart = 0
-					} else {
-						cutDeviceStart++
+					if !checkpoint.Add(v) {
+						continue
+					}
+					err := logFormatter.DoLog(v)
+					if err != nil {
+						return err
 					}
-					logFormatter.DoLog(v)
 					// advance "from" cursor
 					from = &v.TimeCreated
 				}
+				if outFile != nil {
+					err := outFile.Sync()
+					if err != nil {
+						return err
+					}
+				}
+				return checkpoint.Save()
+			}
+
+			for {
+				logEntries, cursorID, err := session.DoLogs(c.App.Metadata["PVR_BASEURL"].(string), nil, rev, from, to, true, logFilter)
+
+				if err != nil {
+					return cli.NewExitError("Error getting device list: "+err.Error(), 4)
+				}
+
+				err = writeLogs(logEntries)
+				if err != nil {
+					return cli.NewExitError(err, 5)
+				}
 
 				for {
 					logEntries, cursorID, err = session.DoLogsCursor(c.App.Metadata["PVR_BASEURL"].(string), cursorID)
@@ -194,18 +237,22 @@ func CommandLogs() cli.Command {
 						return cli.NewExitError("Error getting device list: "+err.Error(), 4)
 					}
 
-					for _, v := range logEntries {
-						logFormatter.DoLog(v)
-						// advance "from" cursor
-						from = &v.TimeCreated
+					err = writeLogs(logEntries)
+					if err != nil {
+						return cli.NewExitError(err, 5)
 					}
+
 					// if we reach end of cursor we have exhausted it and will sleep
 					// before trying to get new logs starting from last timestamp
 					if len(logEntries) == 0 {
-						time.Sleep(time.Duration(1 * time.Second))
 						break
 					}
 				}
+
+				if c.Bool("until-now") {
+					return nil
+				}
+				time.Sleep(time.Duration(1 * time.Second))
 			}
 		},
 		Flags: []cli.Flag{
@@ -222,7 +269,7 @@ func CommandLogs() cli.Command {
 			},
 			cli.StringFlag{
 				Name:   "template,s",
-				Usage:  "template for log output formatting: short(default), json, <golang-time-format>",
+				Usage:  "log output format: " + strings.Join(libpvr.LogFormatterNames(), ", ") + " (csv and logfmt take columns, e.g. csv:time,level,text), <golang-time-format> or <gotemplate>; default short",
 				EnvVar: "PVR_LOGS_TEMPLATE",
 			},
 			cli.StringFlag{
@@ -250,6 +297,26 @@ func CommandLogs() cli.Command {
 				Usage:  "level, e.g.: --level=DEBUG,INFO",
 				EnvVar: "PVR_LOGS_LEVEL",
 			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "append the logs to `FILE`, as json lines unless --template is given, e.g.: --out=logs.ndjson",
+			},
+			cli.StringFlag{
+				Name:  "checkpoint,c",
+				Usage: "remember in `FILE` how far the logs got read and continue from there on the next run, e.g.: --checkpoint=.logs.state",
+			},
+			cli.StringFlag{
+				Name:  "grep",
+				Usage: "only show entries whose text matches the regular expression `REGEX`",
+			},
+			cli.StringFlag{
+				Name:  "grep-v",
+				Usage: "hide entries whose text matches the regular expression `REGEX`",
+			},
+			cli.BoolFlag{
+				Name:  "until-now",
+				Usage: "exit once the logs until the start of the command are read instead of following them",
+			},
 		},
 	}
 }
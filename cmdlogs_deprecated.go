@@ -28,7 +28,6 @@ import (
 func CommandLogsDeprecated() cli.Command {
 	return cli.Command{
 		Name:        "logs",
-		Aliases:     []string{"log"},
 		ArgsUsage:   "<deviceid|devicenick>[/source][@Level][#Platform]",
 		Usage:       "pvr logs <deviceid|devicenick>[/source][@Level][#Platform]",
 		Description: "Get streaming logs of devices you own from pantahub",
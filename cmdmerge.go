@@ -50,6 +50,12 @@ func CommandMerge() cli.Command {
 				return cli.NewExitError(err, 2)
 			}
 
+			err = libpvr.ValidateMergeStrategy(c.String("strategy"))
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+			pvr.MergeStrategy = c.String("strategy")
+
 			var repoPath string
 
 			if c.NArg() > 1 {
@@ -65,10 +71,26 @@ func CommandMerge() cli.Command {
 				return cli.NewExitError(err, 3)
 			}
 
-			fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + pvr.Objdir)
+			fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + pvr.Objects.String())
 			fmt.Println("\n\nRun pvr checkout to checkout the changed files into the workspace.")
 
+			conflicts, err := pvr.GetConflicts()
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+			if conflicts != nil {
+				return cli.NewExitError("Merge left "+strconv.Itoa(len(conflicts.Conflicts))+
+					" conflicts; fix them in the workspace and run pvr resolve.", 5)
+			}
+
 			return nil
 		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "strategy, s",
+				Usage: "how to handle changes made on both sides: conflict, ours or theirs",
+				Value: libpvr.MergeStrategyConflict,
+			},
+		},
 	}
 }
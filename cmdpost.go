@@ -17,10 +17,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"fmt"
 
@@ -72,7 +76,14 @@ func CommandPost() cli.Command {
 				repoPath = c.Args()[0]
 			}
 
-			if repoPath != "" && !libpvr.IsValidUrl(repoPath) {
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			// remote names are resolved by Post itself
+			remoteName := strings.SplitN(repoPath, "#", 2)[0]
+			if repoPath != "" && !libpvr.IsValidUrl(repoPath) && pvr.GetRemote(remoteName) == nil {
 				//Get owner nick & Device nick & make device repo URL
 				userNick := ""
 				deviceNick := ""
@@ -86,12 +97,15 @@ func CommandPost() cli.Command {
 				repoPath = "https://pvr.pantahub.com/" + userNick + "/" + deviceNick
 			}
 
-			pvr, err := libpvr.NewPvr(session, wd)
-			if err != nil {
-				return cli.NewExitError(err, 2)
+			if c.Bool("dry-run") {
+				err = printPostPlan(c, pvr, repoPath)
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				return nil
 			}
 
-			err = pvr.Post(repoPath, c.String("envelope"), c.String("commit-msg"),
+			result, err := pvr.Post(repoPath, c.String("envelope"), c.String("commit-msg"),
 				c.Int("rev"), c.Bool("force"))
 
 			if err != nil {
@@ -99,6 +113,15 @@ func CommandPost() cli.Command {
 				return cli.NewExitError(err, 3)
 			}
 
+			if c.Bool("wait") {
+				rev, err := strconv.Atoi(result.Rev)
+				if err != nil {
+					return cli.NewExitError("cannot wait for revision '"+result.Rev+"' posted to "+result.TrailId, 3)
+				}
+				return waitForDevice(session, c.App.Metadata["PVR_BASEURL"].(string), result.TrailId,
+					rev, c.Duration("wait-timeout"), 10*time.Second)
+			}
+
 			return nil
 		},
 		Flags: []cli.Flag{
@@ -119,6 +142,56 @@ func CommandPost() cli.Command {
 				Name:  "force, f",
 				Usage: "force reupload of existing objects",
 			},
+			cli.BoolFlag{
+				Name:  "wait, w",
+				Usage: "wait until the device finished updating to the posted revision, like pvr device wait",
+			},
+			cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "give up waiting after `TIMEOUT`",
+				Value: 20 * time.Minute,
+			},
+			cli.BoolFlag{
+				Name:  "dry-run, n",
+				Usage: "only show the state changes, objects to upload and bytes the device will download",
+			},
 		},
 	}
 }
+
+func printPostPlan(c *cli.Context, pvr *libpvr.Pvr, repoPath string) error {
+	plan, err := pvr.PostPlan(repoPath)
+	if err != nil {
+		return err
+	}
+
+	return libpvr.PrintOutput(c.GlobalString("output"), plan, func() error {
+		var patch bytes.Buffer
+		err := json.Indent(&patch, plan.Patch, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		var uploadBytes int64
+		for _, o := range plan.Upload {
+			uploadBytes += o.Size
+		}
+
+		fmt.Println("Would post to " + plan.Url)
+		fmt.Println("\nState changes (JSON merge patch):")
+		fmt.Println(patch.String())
+
+		fmt.Printf("\nObjects to upload: %d (%d bytes)\n", len(plan.Upload), uploadBytes)
+		for _, o := range plan.Upload {
+			fmt.Printf("\t%s %12d %s\n", o.Sha[:libpvr.Min(12, len(o.Sha))], o.Size, o.Name)
+		}
+
+		fmt.Printf("\nObjects skipped as already on the device: %d\n", len(plan.Skip))
+		for _, o := range plan.Skip {
+			fmt.Printf("\t%s %s\n", o.Sha[:libpvr.Min(12, len(o.Sha))], o.Name)
+		}
+
+		fmt.Printf("\nThe device will download %d bytes.\n", plan.DownloadBytes)
+		return nil
+	})
+}
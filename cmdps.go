@@ -17,13 +17,18 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/justincampbell/timeago"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 	"gitlab.com/pantacor/pvr/libpvr"
+	"golang.org/x/term"
 )
 
 func min(x, y int) int {
@@ -34,10 +39,11 @@ func min(x, y int) int {
 }
 func CommandPs() cli.Command {
 	return cli.Command{
-		Name:        "ps",
-		Aliases:     []string{"ps"},
-		Usage:       "Show Owned Devices",
-		Description: "Get a quick overview of devices you manage in Pantahub",
+		Name:    "ps",
+		Aliases: []string{"ps"},
+		Usage:   "Show Owned Devices",
+		Description: "Get a quick overview of devices you manage in Pantahub. " +
+			"With --watch the list refreshes and devices that did not pick up their latest revision yet or report ERROR are highlighted.",
 		Action: func(c *cli.Context) error {
 			session, err := libpvr.NewSession(c.App)
 
@@ -45,33 +51,154 @@ func CommandPs() cli.Command {
 				return cli.NewExitError(err, 4)
 			}
 
-			devices, err := session.DoPs(c.App.Metadata["PVR_BASEURL"].(string))
-
-			if err != nil {
-				return cli.NewExitError("Error getting device list: "+err.Error(), 4)
+			var filter libpvr.DeviceSelector
+			if c.String("filter") != "" {
+				filter, err = libpvr.ParseDeviceSelector(c.String("filter"))
+				if err != nil {
+					return cli.NewExitError(err, 2)
+				}
 			}
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetBorder(false)
-			table.SetHeaderLine(false)
-			table.SetColumnSeparator(" ")
-			table.SetHeader([]string{"id", "nick", "rev", "status", "state", "seen", "ip", "message"})
-
-			for _, v := range devices {
-				table.Append([]string{
-					v.Id[:8],
-					v.Nick,
-					strconv.Itoa(v.ProgressRevision),
-					v.Status,
-					v.StateSha[:min(len(v.StateSha), 8)],
-					timeago.FromTime(v.Timestamp),
-					v.RealIP,
-					v.StatusMsg})
+			if c.String("sort") != "" {
+				err = libpvr.SortDevices(nil, c.String("sort"))
+				if err != nil {
+					return cli.NewExitError(err, 2)
+				}
 			}
 
-			table.Render()
+			if c.Duration("watch") <= 0 {
+				devices, err := psDevices(c, session, filter)
+				if err != nil {
+					return cli.NewExitError(err, 4)
+				}
+				err = printPs(c, devices, false)
+				if err != nil {
+					return cli.NewExitError(err, 4)
+				}
+				return nil
+			}
 
-			return nil
+			// machine readable output stays free of the header and
+			// screen clearing; the header goes to stderr instead
+			output := c.GlobalString("output")
+			machine := c.String("template") != "" || output != "" && output != libpvr.OutputFormatTable
+			highlight := !machine && term.IsTerminal(int(os.Stdout.Fd()))
+			header := os.Stdout
+			if machine {
+				header = os.Stderr
+			}
+			for {
+				devices, err := psDevices(c, session, filter)
+				if highlight {
+					// clear the screen
+					fmt.Print("\033[H\033[2J")
+				}
+				fmt.Fprintf(header, "Every %s: pvr ps  %s\n\n", c.Duration("watch"), time.Now().Format("2006-01-02 15:04:05"))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+				} else if err = printPs(c, devices, highlight); err != nil {
+					return cli.NewExitError(err, 4)
+				}
+				time.Sleep(c.Duration("watch"))
+			}
+		},
+		Flags: []cli.Flag{
+			cli.DurationFlag{
+				Name:  "watch, w",
+				Usage: "refresh the list every `INTERVAL`, e.g.: --watch 5s",
+			},
+			cli.StringFlag{
+				Name:  "filter, f",
+				Usage: "only show devices matching `FILTER`, e.g.: --filter status=ERROR,nick=~cam-*",
+			},
+			cli.StringFlag{
+				Name:  "sort, s",
+				Usage: "sort by `KEY`, one of " + strings.Join(libpvr.PsSortKeys(), ", ") + "; prefix with - to sort descending",
+			},
+			cli.StringFlag{
+				Name:  "template, t",
+				Usage: "print every device with a go `TEMPLATE` instead of the table, e.g.: --template '{{ .Nick }} {{ .Status }}'",
+			},
 		},
 	}
 }
+
+// psDevices fetches the device summaries, filtered and sorted as asked for
+func psDevices(c *cli.Context, session *libpvr.Session, filter libpvr.DeviceSelector) ([]libpvr.PantahubDevice, error) {
+	devices, err := session.DoPs(c.App.Metadata["PVR_BASEURL"].(string))
+	if err != nil {
+		return nil, errors.New("Error getting device list: " + err.Error())
+	}
+
+	if filter != nil {
+		devices, err = libpvr.FilterDevices(devices, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.String("sort") != "" {
+		err = libpvr.SortDevices(devices, c.String("sort"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+func printPs(c *cli.Context, devices []libpvr.PantahubDevice, highlight bool) error {
+	if c.String("template") != "" {
+		for _, v := range devices {
+			r, err := libpvr.SprintTmpl(c.String("template"), v)
+			if err != nil {
+				return err
+			}
+			fmt.Println(r)
+		}
+		return nil
+	}
+
+	return libpvr.PrintOutput(c.GlobalString("output"), devices, func() error {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetBorder(false)
+		table.SetHeaderLine(false)
+		table.SetColumnSeparator(" ")
+		table.SetHeader([]string{"id", "nick", "rev", "status", "state", "seen", "ip", "message"})
+
+		for _, v := range devices {
+			// in highlighted watch mode also show the revision a device is
+			// about to move to
+			rev := strconv.Itoa(v.ProgressRevision)
+			if highlight && v.Revision != v.ProgressRevision {
+				rev += " (" + strconv.Itoa(v.Revision) + ")"
+			}
+			row := []string{
+				v.Id[:min(len(v.Id), 8)],
+				v.Nick,
+				rev,
+				v.Status,
+				v.StateSha[:min(len(v.StateSha), 8)],
+				timeago.FromTime(v.Timestamp),
+				v.RealIP,
+				v.StatusMsg}
+
+			if !highlight || !libpvr.PsNeedsAttention(v) {
+				table.Append(row)
+				continue
+			}
+
+			color := tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor}
+			if v.Status == libpvr.StepStatusError {
+				color = tablewriter.Colors{tablewriter.Bold, tablewriter.FgRedColor}
+			}
+			colors := []tablewriter.Colors{}
+			for range row {
+				colors = append(colors, color)
+			}
+			table.Rich(row, colors)
+		}
+
+		table.Render()
+		return nil
+	})
+}
@@ -33,5 +33,6 @@ func CommandPsDeprecated() cli.Command {
 			return nil
 		},
 		Action: CommandPs().Action,
+		Flags:  CommandPs().Flags,
 	}
 }
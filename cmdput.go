@@ -27,9 +27,9 @@ func CommandPut() cli.Command {
 	return cli.Command{
 		Name:        "put",
 		Aliases:     []string{"p"},
-		ArgsUsage:   "[target-repo]",
+		ArgsUsage:   "[target-repo[@<ref>]]",
 		Usage:       "put local repository to a target respository.",
-		Description: "Can put to local and REST repos. If no repository is provided the previously used one is used.",
+		Description: "Can put to local and REST repos. If no repository is provided the previously used one is used. For local repos @<ref> publishes HEAD as branch (or existing tag) <ref> of the target instead of replacing its state.",
 		Action: func(c *cli.Context) error {
 			wd, err := os.Getwd()
 			if err != nil {
@@ -66,7 +66,7 @@ func CommandPut() cli.Command {
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "force, f",
-				Usage: "force reupload of existing objects",
+				Usage: "force reupload of existing objects; allows moving existing tags with @<ref>",
 			},
 		},
 	}
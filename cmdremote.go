@@ -0,0 +1,38 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"github.com/urfave/cli"
+)
+
+// CommandRemote : pvr remote command
+func CommandRemote() cli.Command {
+	cmd := cli.Command{
+		Name:      "remote",
+		ArgsUsage: "[add|ls|rm]",
+		Subcommands: []cli.Command{
+			CommandRemoteAdd(),
+			CommandRemoteList(),
+			CommandRemoteRemove(),
+		},
+		Usage:       "pvr remote <add|ls|rm>: manage the named remotes of the local repository",
+		Description: "\nNamed remotes can be used instead of urls with get, put, post and fastcopy; '<name>#<part>' selects parts of a remote.\nThe first repository a checkout talks to is remembered as 'origin', which is used when no repository is given.\nWithout subcommand the remotes are listed.",
+		Action:      remoteListAction,
+	}
+	return cmd
+}
@@ -0,0 +1,117 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// CommandRemoteAdd : pvr remote add command
+func CommandRemoteAdd() cli.Command {
+	cmd := cli.Command{
+		Name:        "add",
+		Aliases:     []string{"a"},
+		ArgsUsage:   "<name> <url>",
+		Usage:       "pvr remote add <name> <url>: add a named remote",
+		Description: "Add a named remote. <url> is used by get; --put-url and --post-url override it for put and post. Urls, paths and <user-nick>/<device-nick> are accepted like in pvr get.",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			if c.NArg() != 2 {
+				return cli.NewExitError("remote add needs <name> and <url>. See --help.", 1)
+			}
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			remote := libpvr.PvrRemoteConfig{
+				AuthEndpoint: c.String("auth-endpoint"),
+				AuthRealm:    c.String("auth-realm"),
+				Proxy:        c.String("proxy"),
+				Insecure:     c.Bool("insecure"),
+				CaCert:       c.String("ca-cert"),
+			}
+			remote.Url, err = libpvr.FixupRepoRef(c.Args()[1])
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			if c.String("put-url") != "" {
+				remote.PutUrl, err = libpvr.FixupRepoRef(c.String("put-url"))
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+			}
+			if c.String("post-url") != "" {
+				remote.PostUrl, err = libpvr.FixupRepoRef(c.String("post-url"))
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+			}
+
+			err = pvr.AddRemote(c.Args()[0], remote, c.Bool("force"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "put-url",
+				Usage: "url used by pvr put instead of <url>",
+			},
+			cli.StringFlag{
+				Name:  "post-url",
+				Usage: "url used by pvr post instead of <url>",
+			},
+			cli.StringFlag{
+				Name:  "auth-endpoint",
+				Usage: "use the login of this auth endpoint (see pvr whoami) for the remote",
+			},
+			cli.StringFlag{
+				Name:  "auth-realm",
+				Usage: "realm of the login to use with --auth-endpoint",
+			},
+			cli.StringFlag{
+				Name:  "proxy",
+				Usage: "proxy for the remote: 'system', 'no' or a proxy url",
+			},
+			cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "do not verify the tls certificate of the remote",
+			},
+			cli.StringFlag{
+				Name:  "ca-cert",
+				Usage: "pem file with additional certificates to trust for the remote",
+			},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "replace the remote if it already exists",
+			},
+		},
+	}
+	return cmd
+}
@@ -60,7 +60,7 @@ func CommandRemoteInfo() cli.Command {
 				repoUri = c.Args()[0]
 			}
 
-			repoUri, err = libpvr.FixupRepoRef(repoUri)
+			repoUri, err = pvr.FixupRepoRef(repoUri)
 			if err != nil {
 				return cli.NewExitError(err, 7)
 			}
@@ -71,25 +71,28 @@ func CommandRemoteInfo() cli.Command {
 				return cli.NewExitError(err, 1)
 			}
 
-			jsonData, err := json.MarshalIndent(pvrRemote, "", "    ")
-
-			if err != nil {
-				return cli.NewExitError(err, 1)
-			}
-
-			if c.Bool("canonical") {
-				jsonData, err = libpvr.FormatJsonC(jsonData)
+			// the table format stays the json it always was
+			err = libpvr.PrintOutput(c.GlobalString("output"), pvrRemote, func() error {
+				jsonData, err := json.MarshalIndent(pvrRemote, "", "    ")
 				if err != nil {
-					cli.NewExitError(err, 4)
+					return err
+				}
+
+				if c.Bool("canonical") {
+					jsonData, err = libpvr.FormatJsonC(jsonData)
+				} else {
+					jsonData, err = libpvr.FormatJson(jsonData)
 				}
-			} else {
-				jsonData, err = libpvr.FormatJson(jsonData)
 				if err != nil {
-					cli.NewExitError(err, 4)
+					return err
 				}
-			}
 
-			fmt.Println(string(jsonData))
+				fmt.Println(string(jsonData))
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
 
 			return nil
 		},
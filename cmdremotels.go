@@ -0,0 +1,71 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// CommandRemoteList : pvr remote ls command
+func CommandRemoteList() cli.Command {
+	cmd := cli.Command{
+		Name:        "ls",
+		Aliases:     []string{"l"},
+		ArgsUsage:   "",
+		Usage:       "pvr remote ls: list the remotes of the local repository",
+		Description: "List the remotes of the local repository",
+		Action:      remoteListAction,
+	}
+	return cmd
+}
+
+func remoteListAction(c *cli.Context) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	session, err := libpvr.NewSession(c.App)
+	if err != nil {
+		return cli.NewExitError(err, 4)
+	}
+	pvr, err := libpvr.NewPvr(session, wd)
+	if err != nil {
+		return cli.NewExitError(err, 2)
+	}
+
+	remotes := pvr.ListRemotes()
+	err = libpvr.PrintOutput(c.GlobalString("output"), remotes, func() error {
+		for _, r := range remotes {
+			fmt.Printf("%s\t%s\n", r.Name, r.Url)
+			if r.PutUrl != "" {
+				fmt.Printf("%s\t%s (put)\n", r.Name, r.PutUrl)
+			}
+			if r.PostUrl != "" {
+				fmt.Printf("%s\t%s (post)\n", r.Name, r.PostUrl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return cli.NewExitError(err, 3)
+	}
+	return nil
+}
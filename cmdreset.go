@@ -27,9 +27,9 @@ func CommandReset() cli.Command {
 	return cli.Command{
 		Name:        "reset",
 		Aliases:     []string{"r", "checkout", "co"},
-		ArgsUsage:   "",
+		ArgsUsage:   "[<revision>]",
 		Usage:       "reset working directory to match the repo state",
-		Description: "reset/checkout also forgets about added files; pvr status and diff will yield empty",
+		Description: "reset/checkout also forgets about added files; pvr status and diff will yield empty.\n\n   If <revision> is provided the repo state is first moved to that revision of the local history (see pvr log). <revision> can be HEAD, a branch or tag name, a revision sha or unique sha prefix, each optionally followed by ~N to go N revisions back. Checking out a branch switches to it, everything else detaches HEAD. Moving to a revision refuses to run with uncommitted changes unless --force is given.",
 		Action: func(c *cli.Context) error {
 			wd, err := os.Getwd()
 			if err != nil {
@@ -47,7 +47,11 @@ func CommandReset() cli.Command {
 				return cli.NewExitError(err, 2)
 			}
 
-			if c.Bool("hardlink") {
+			if c.NArg() > 1 {
+				return cli.NewExitError("reset can have at most 1 argument. See --help.", 1)
+			} else if c.NArg() == 1 {
+				err = pvr.Checkout(c.Args()[0], c.Bool("hardlink"), c.Bool("canonical"), c.Bool("force"))
+			} else if c.Bool("hardlink") {
 				err = pvr.ResetWithHardlink()
 			} else {
 				err = pvr.Reset(c.Bool("canonical"))
@@ -60,6 +64,10 @@ func CommandReset() cli.Command {
 			return nil
 		},
 		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "move to <revision> even if the working directory has uncommitted changes; these get discarded",
+			},
 			cli.BoolFlag{
 				Name:  "hardlink, hl",
 				Usage: "checkout working copy with harlinks to objects; change files to read only.",
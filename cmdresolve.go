@@ -0,0 +1,112 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandResolve() cli.Command {
+	return cli.Command{
+		Name:        "resolve",
+		ArgsUsage:   "[<key> ...]",
+		Usage:       "list or resolve conflicts left by pvr merge or pvr get",
+		Description: "without arguments and flags the unresolved conflicts are listed. With --ours or --theirs the chosen side is written to the workspace before the conflicts of <key> (default: all) are marked as resolved; otherwise the workspace content is taken as resolution. pvr commit refuses to run while conflicts are unresolved.",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			if c.Bool("ours") && c.Bool("theirs") {
+				return cli.NewExitError("resolve can only take one of --ours and --theirs. See --help.", 1)
+			}
+
+			strategy := libpvr.MergeStrategyConflict
+			if c.Bool("ours") {
+				strategy = libpvr.MergeStrategyOurs
+			} else if c.Bool("theirs") {
+				strategy = libpvr.MergeStrategyTheirs
+			}
+
+			if c.NArg() == 0 && strategy == libpvr.MergeStrategyConflict && !c.Bool("all") {
+				conflicts, err := pvr.GetConflicts()
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				if conflicts == nil {
+					fmt.Println("No merge conflicts.")
+					return nil
+				}
+				fmt.Println("Conflicts merging " + conflicts.Source + ":")
+				for _, conflict := range conflicts.Conflicts {
+					if !c.Bool("verbose") {
+						fmt.Println("  " + conflict.String())
+						continue
+					}
+					buf, err := json.MarshalIndent(conflict, "  ", "  ")
+					if err != nil {
+						return cli.NewExitError(err, 3)
+					}
+					fmt.Println("  " + string(buf))
+				}
+				return nil
+			}
+
+			err = pvr.ResolveConflicts(c.Args(), strategy)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "ours",
+				Usage: "resolve to the local side",
+			},
+			cli.BoolFlag{
+				Name:  "theirs",
+				Usage: "resolve to the incoming side",
+			},
+			cli.BoolFlag{
+				Name:  "all, a",
+				Usage: "take the workspace as resolution for all conflicts",
+			},
+			cli.BoolFlag{
+				Name:  "verbose, v",
+				Usage: "show base, ours and theirs of each conflict",
+			},
+		},
+	}
+}
@@ -0,0 +1,126 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// CommandRollout : pvr rollout command
+func CommandRollout() cli.Command {
+	cmd := cli.Command{
+		Name: "rollout",
+		Subcommands: []cli.Command{
+			CommandRolloutStart(),
+			CommandRolloutResume(),
+			CommandRolloutAbort(),
+			CommandRolloutStatus(),
+		},
+		Usage:       "pvr rollout <start|resume|abort|status>: roll the local state out to a fleet of devices in stages",
+		Description: "\nA rollout posts the local state to the devices matching a selector (see pvr fleet post) in stages, e.g. 1 device, then 10%, then 100%.\nAfter each stage it waits for every device of the stage to finish the new revision and halts if the ratio of failed devices exceeds a threshold.\nThe rollout is kept in .pvr/rollout.json; an interrupted or halted rollout can be resumed or aborted, which re-posts the previous revision of every device it posted to.\nWithout subcommand the status of the rollout is shown.",
+		Action:      rolloutStatusAction,
+	}
+	return cmd
+}
+
+func CommandRolloutStatus() cli.Command {
+	return cli.Command{
+		Name:        "status",
+		Usage:       "pvr rollout status: show the progress of the rollout",
+		Description: "List the devices of the rollout with their stage, revisions and status",
+		Action:      rolloutStatusAction,
+	}
+}
+
+// loadRollout opens the checkout in the working directory and its rollout
+func loadRollout(c *cli.Context) (*libpvr.Pvr, *libpvr.PvrRollout, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, 1)
+	}
+
+	session, err := libpvr.NewSession(c.App)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, 4)
+	}
+
+	pvr, err := libpvr.NewPvr(session, wd)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, 2)
+	}
+
+	rollout, err := pvr.LoadRollout()
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, 2)
+	}
+	if rollout == nil {
+		return nil, nil, cli.NewExitError("no rollout; see pvr rollout start", 2)
+	}
+	return pvr, rollout, nil
+}
+
+func rolloutStatusAction(c *cli.Context) error {
+	_, rollout, err := loadRollout(c)
+	if err != nil {
+		return err
+	}
+
+	err = libpvr.PrintOutput(c.GlobalString("output"), rollout, func() error {
+		stage := rollout.Stage + 1
+		if stage > len(rollout.Stages) {
+			stage = len(rollout.Stages)
+		}
+		fmt.Printf("Rollout %s to '%s': stage %d/%d (%s), %.0f%% failed (threshold %.0f%%)\n\n",
+			rollout.Status, rollout.Selector, stage, len(rollout.Stages), rollout.Stages[stage-1],
+			rollout.FailureRatio()*100, rollout.FailureThreshold*100)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetBorder(false)
+		table.SetHeaderLine(false)
+		table.SetColumnSeparator(" ")
+		table.SetAutoWrapText(false)
+		table.SetHeader([]string{"device", "nick", "stage", "previous", "rev", "status", "error"})
+
+		for _, d := range rollout.Devices {
+			stage := ""
+			if d.Stage >= 0 {
+				stage = strconv.Itoa(d.Stage + 1)
+			}
+			table.Append([]string{
+				d.Id,
+				d.Nick,
+				stage,
+				strconv.Itoa(d.PreviousRev),
+				d.Rev,
+				d.Status,
+				d.Error})
+		}
+
+		table.Render()
+		return nil
+	})
+	if err != nil {
+		return cli.NewExitError(err, 4)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+func CommandRolloutAbort() cli.Command {
+	return cli.Command{
+		Name:  "abort",
+		Usage: "pvr rollout abort: stop the rollout and re-post the previous revision of its devices",
+		Description: "Post the revision every device had before the rollout again to all devices the rollout posted to " +
+			"(see pvr device rollback). Devices that could not be rolled back are reported; running abort again retries them.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 0 {
+				return cli.NewExitError(errors.New("rollout abort takes no arguments. See --help"), 2)
+			}
+
+			pvr, rollout, err := loadRollout(c)
+			if err != nil {
+				return err
+			}
+
+			err = pvr.AbortRollout(rollout)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			fmt.Fprintln(os.Stderr, "Rollout aborted")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,59 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandRolloutResume() cli.Command {
+	return cli.Command{
+		Name:  "resume",
+		Usage: "pvr rollout resume [--failure-threshold RATIO]: continue an interrupted or halted rollout",
+		Description: "Continue the rollout with the stage it stopped in; devices already posted to are waited for again. " +
+			"The local state gets posted to devices not posted to yet; it has to be the state the rollout started with. " +
+			"A halted rollout only continues if a higher --failure-threshold is given.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 0 {
+				return cli.NewExitError(errors.New("rollout resume takes no arguments. See --help"), 2)
+			}
+
+			pvr, rollout, err := loadRollout(c)
+			if err != nil {
+				return err
+			}
+
+			if c.String("failure-threshold") != "" {
+				rollout.FailureThreshold, err = libpvr.ParseRatio(c.String("failure-threshold"))
+				if err != nil {
+					return cli.NewExitError(err, 2)
+				}
+			}
+
+			return runRollout(c, pvr, rollout)
+		},
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "failure-threshold, t",
+				Usage: "change the threshold of the rollout to `RATIO`, e.g.: 10%",
+			},
+		}, rolloutRunFlags...),
+	}
+}
@@ -0,0 +1,139 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+// exit code of pvr rollout start|resume once the failure threshold got exceeded
+const exitRolloutHalted = 10
+
+func CommandRolloutStart() cli.Command {
+	return cli.Command{
+		Name:  "start",
+		Usage: "pvr rollout start --selector <SELECTOR> [--stages 1,10%,100%]: start a rollout of the local state",
+		Description: "Record the devices matching the selector and their current revision, then run the stages. " +
+			"Each stage gives the number or percentage of devices updated once it is finished. " +
+			"Exits with " + fmt.Sprint(exitRolloutHalted) + " if the rollout halted because too many devices failed.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 0 {
+				return cli.NewExitError(errors.New("rollout start takes no arguments. See --help"), 2)
+			}
+			if c.String("selector") == "" {
+				return cli.NewExitError(errors.New("--selector is required. See --help"), 2)
+			}
+
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+			baseURL := c.App.Metadata["PVR_BASEURL"].(string)
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+			if !pvr.Initialized {
+				return cli.NewExitError(errors.New("rollout needs a pvr checkout with the state to roll out"), 2)
+			}
+
+			rollout, err := pvr.NewRollout(baseURL, c.String("selector"), c.String("part"),
+				c.String("envelope"), c.String("commit-msg"), c.String("stages"), c.String("failure-threshold"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return runRollout(c, pvr, rollout)
+		},
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "selector, l",
+				Usage: "roll out to the devices matching `SELECTOR`, e.g.: user-meta.site=berlin",
+			},
+			cli.StringFlag{
+				Name:  "part, p",
+				Usage: "only roll out `PART` of the local state, merged into the current state of each device",
+			},
+			cli.StringFlag{
+				Name:  "stages, s",
+				Usage: "comma separated `STAGES`, each a number or percentage of devices updated at its end",
+				Value: "1,10%,100%",
+			},
+			cli.StringFlag{
+				Name:  "failure-threshold, t",
+				Usage: "halt when more than `RATIO` of the devices failed, e.g.: 10%",
+				Value: "0%",
+			},
+			cli.StringFlag{
+				Name:  "envelope, e",
+				Usage: "provide the json envelope to wrap around the pvr post",
+				Value: "{}",
+			},
+			cli.StringFlag{
+				Name:  "commit-msg, m",
+				Usage: "add commit message to the new revisions",
+			},
+		}, rolloutRunFlags...),
+	}
+}
+
+// rolloutRunFlags are the flags of the commands running rollout stages
+var rolloutRunFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "max-parallel, j",
+		Usage: "talk to at most `N` devices at once",
+		Value: 10,
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "count a device as failed if it did not finish its new revision within `TIMEOUT`",
+		Value: 20 * time.Minute,
+	},
+	cli.DurationFlag{
+		Name:  "interval, i",
+		Usage: "poll the device progress every `INTERVAL`",
+		Value: 10 * time.Second,
+	},
+}
+
+// runRollout runs the stages of rollout and maps the outcome to exit codes
+func runRollout(c *cli.Context, pvr *libpvr.Pvr, rollout *libpvr.PvrRollout) error {
+	err := pvr.RunRollout(rollout, c.Int("max-parallel"), c.Duration("timeout"), c.Duration("interval"))
+	if err == libpvr.ErrRolloutHalted {
+		return cli.NewExitError(fmt.Sprintf("Rollout halted in stage %d: %.0f%% of the devices failed; "+
+			"see pvr rollout status, then resume or abort", rollout.Stage+1, rollout.FailureRatio()*100),
+			exitRolloutHalted)
+	}
+	if err != nil {
+		return cli.NewExitError(err, 4)
+	}
+
+	fmt.Fprintf(os.Stderr, "Rollout to %d devices done\n", len(rollout.Devices))
+	return nil
+}
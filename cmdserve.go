@@ -0,0 +1,113 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandServe() cli.Command {
+	return cli.Command{
+		Name:      "serve",
+		ArgsUsage: "[<repo-dir>]",
+		Usage:     "serve a local repository over http using the pvr remote protocol",
+		Description: "exposes the repository in <repo-dir> (default: current directory) so that pvr clone, get, put and post " +
+			"work against http://<host>:<port>/ like against any other remote. <repo-dir> may be a working copy or its .pvr directory. " +
+			"States put or posted become the pristine json of the served repository and are recorded in its history; " +
+			"its working directory is left untouched, so serve a dedicated mirror. " +
+			"The repository is served read-only unless a --write-token is set; writes then have to use http://<host>:<port>" + libpvr.ServeWritePrefix + "<token>/ as remote " +
+			"or send the token as bearer token. Only local clients can connect unless --listen says otherwise.",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 1 {
+				return cli.NewExitError("serve takes at most one repository directory. See --help.", 1)
+			}
+
+			dir := c.Args().Get(0)
+			if dir == "" {
+				dir = "."
+			}
+			dir, err := filepath.Abs(dir)
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			if filepath.Base(dir) == ".pvr" {
+				dir = filepath.Dir(dir)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, dir)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			server, err := libpvr.NewPvrServer(pvr)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+			server.PublicUrl = c.String("public-url")
+			server.WriteToken = c.String("write-token")
+			if c.Bool("read-only") {
+				server.WriteToken = ""
+			}
+
+			mode := "read-only"
+			if server.WriteToken != "" {
+				mode = "writable with token"
+			}
+			fmt.Fprintf(os.Stderr, "Serving %s on %s (%s)\n", dir, c.String("listen"), mode)
+
+			err = server.ListenAndServe(c.String("listen"))
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "listen, l",
+				Usage:  "listen on `ADDRESS`",
+				EnvVar: "PVR_SERVE_LISTEN",
+				Value:  libpvr.ServeDefaultListen,
+			},
+			cli.StringFlag{
+				Name:  "public-url",
+				Usage: "announce `URL` as base for all endpoints instead of the host clients connect to (e.g. behind a reverse proxy)",
+			},
+			cli.StringFlag{
+				Name:   "write-token",
+				Usage:  "allow put, post and object uploads for clients presenting `TOKEN`; without it the repository is served read-only",
+				EnvVar: "PVR_SERVE_WRITE_TOKEN",
+			},
+			cli.BoolFlag{
+				Name:   "read-only",
+				Usage:  "serve read-only; the default without --write-token",
+				Hidden: true,
+			},
+		},
+	}
+}
@@ -0,0 +1,108 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	jsonpatch "github.com/asac/json-patch"
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandShow() cli.Command {
+	return cli.Command{
+		Name:        "show",
+		ArgsUsage:   "[<revision>]",
+		Usage:       "show a revision of the local history",
+		Description: "show metadata of <revision> (default: HEAD) and the json diff to its parent; with --state the full state json of the revision is shown instead",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			if c.NArg() > 1 {
+				return cli.NewExitError("show can have at most 1 argument. See --help.", 1)
+			}
+
+			sha, err := pvr.ResolveRevision(c.Args().First())
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			rev, err := pvr.GetRevision(sha)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			state, err := pvr.GetState(rev.StateSha)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			var out []byte
+			if c.Bool("state") {
+				out = state
+			} else {
+				parentState := []byte("{}")
+				if rev.Parent != "" {
+					parent, err := pvr.GetRevision(rev.Parent)
+					if err != nil {
+						return cli.NewExitError(err, 3)
+					}
+					parentState, err = pvr.GetState(parent.StateSha)
+					if err != nil {
+						return cli.NewExitError(err, 3)
+					}
+				}
+				out, err = jsonpatch.CreateMergePatch(parentState, state)
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+			}
+
+			out, err = libpvr.FormatJson(out)
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			printRevision(rev)
+			fmt.Println(string(out))
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "state, s",
+				Usage: "show the full state json of the revision instead of the diff to its parent",
+			},
+		},
+	}
+}
@@ -183,14 +183,19 @@ func CommandSigLs() cli.Command {
 			if !c.Bool("with-sigs") {
 				resultSummary.FullJSONWebSigs = nil
 			}
-			jsonBuf, err := json.MarshalIndent(resultSummary, "", "    ")
-
+			// the table format stays the json it always was
+			err = libpvr.PrintOutput(c.GlobalString("output"), resultSummary, func() error {
+				jsonBuf, err := json.MarshalIndent(resultSummary, "", "    ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsonBuf))
+				return nil
+			})
 			if err != nil {
 				return cli.NewExitError(err, 13)
 			}
 
-			fmt.Println(string(jsonBuf))
-
 			return nil
 		},
 		Flags: []cli.Flag{
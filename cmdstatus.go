@@ -52,7 +52,13 @@ func CommandStatus() cli.Command {
 				return cli.NewExitError(err, 3)
 			}
 
-			fmt.Print(status)
+			err = libpvr.PrintOutput(c.GlobalString("output"), status, func() error {
+				fmt.Print(status)
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
 
 			return nil
 		},
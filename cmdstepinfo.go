@@ -62,7 +62,7 @@ func CommandStepInfo() cli.Command {
 				repoUri = c.Args()[0]
 			}
 
-			repoUri, err = libpvr.FixupRepoRef(repoUri)
+			repoUri, err = pvr.FixupRepoRef(repoUri)
 			if err != nil {
 				return cli.NewExitError(err, 7)
 			}
@@ -86,25 +86,28 @@ func CommandStepInfo() cli.Command {
 				return cli.NewExitError(err, 1)
 			}
 
-			jsonData, err := json.MarshalIndent(stateJsonMap, "", "    ")
-
-			if err != nil {
-				return cli.NewExitError(err, 1)
-			}
-
-			if c.Bool("canonical") {
-				jsonData, err = libpvr.FormatJsonC(jsonData)
+			// the table format stays the json it always was
+			err = libpvr.PrintOutput(c.GlobalString("output"), stateJsonMap, func() error {
+				jsonData, err := json.MarshalIndent(stateJsonMap, "", "    ")
 				if err != nil {
-					cli.NewExitError(err, 4)
+					return err
+				}
+
+				if c.Bool("canonical") {
+					jsonData, err = libpvr.FormatJsonC(jsonData)
+				} else {
+					jsonData, err = libpvr.FormatJson(jsonData)
 				}
-			} else {
-				jsonData, err = libpvr.FormatJson(jsonData)
 				if err != nil {
-					cli.NewExitError(err, 4)
+					return err
 				}
-			}
 
-			fmt.Println(string(jsonData))
+				fmt.Println(string(jsonData))
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
 
 			return nil
 		},
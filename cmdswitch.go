@@ -0,0 +1,97 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandSwitch() cli.Command {
+	return cli.Command{
+		Name:        "switch",
+		Aliases:     []string{"sw"},
+		ArgsUsage:   "<branch>",
+		Usage:       "switch the repository to another branch",
+		Description: "makes <branch> the current branch and checks out its state into the working directory. Refuses to run with uncommitted changes unless --force is given.",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			if c.NArg() != 1 {
+				return cli.NewExitError("switch needs exactly one branch name. See --help.", 1)
+			}
+			branch := c.Args()[0]
+
+			if !c.Bool("force") {
+				err = pvr.CheckClean()
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+			}
+
+			if c.Bool("create") {
+				err = pvr.CreateBranch(branch, "", false)
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+			}
+
+			// cleanliness got checked above, before creating the branch
+			err = pvr.Switch(branch, c.Bool("hardlink"), c.Bool("canonical"), true)
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "create, c",
+				Usage: "create the branch at HEAD before switching to it",
+			},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "switch even if the working directory has uncommitted changes; these get discarded",
+			},
+			cli.BoolFlag{
+				Name:  "hardlink, hl",
+				Usage: "checkout working copy with harlinks to objects; change files to read only.",
+			},
+			cli.BoolFlag{
+				Name:   "canonical",
+				Usage:  "checkout working copy json files using canonical formatting; hardlink implies this option",
+				EnvVar: "PVR_CANONICAL_JSON",
+			},
+		},
+	}
+}
@@ -0,0 +1,101 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"gitlab.com/pantacor/pvr/libpvr"
+)
+
+func CommandTag() cli.Command {
+	return cli.Command{
+		Name:        "tag",
+		ArgsUsage:   "[<name> [<revision>]]",
+		Usage:       "list, create or delete tags of the local repository",
+		Description: "without arguments all tags are listed. With <name> a new tag is created at <revision> (default: HEAD).",
+		Action: func(c *cli.Context) error {
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+
+			session, err := libpvr.NewSession(c.App)
+
+			if err != nil {
+				return cli.NewExitError(err, 4)
+			}
+
+			pvr, err := libpvr.NewPvr(session, wd)
+			if err != nil {
+				return cli.NewExitError(err, 2)
+			}
+
+			if c.NArg() > 2 {
+				return cli.NewExitError("tag can have at most 2 arguments. See --help.", 1)
+			}
+
+			if c.Bool("delete") {
+				if c.NArg() != 1 {
+					return cli.NewExitError("tag --delete needs exactly one tag name. See --help.", 1)
+				}
+				err = pvr.DeleteTag(c.Args()[0])
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				return nil
+			}
+
+			if c.NArg() > 0 {
+				err = pvr.CreateTag(c.Args()[0], c.Args().Get(1), c.Bool("force"))
+				if err != nil {
+					return cli.NewExitError(err, 3)
+				}
+				return nil
+			}
+
+			tags, err := pvr.ListTags()
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			err = libpvr.PrintOutput(c.GlobalString("output"), tags, func() error {
+				for _, t := range tags {
+					fmt.Printf("%s %s\n", t.Sha[:libpvr.Min(12, len(t.Sha))], t.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				return cli.NewExitError(err, 3)
+			}
+
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "delete, d",
+				Usage: "delete the named tag",
+			},
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "move the tag if it already exists",
+			},
+		},
+	}
+}
@@ -45,7 +45,13 @@ func CommandWhoami() cli.Command {
 			if err != nil {
 				return cli.NewExitError(err, 2)
 			}
-			err = pvr.Session.Whoami()
+			logins, err := pvr.Session.GetLogins()
+			if err == nil {
+				err = libpvr.PrintOutput(c.GlobalString("output"), logins, func() error {
+					libpvr.PrintLogins(logins)
+					return nil
+				})
+			}
 			if err != nil {
 				return cli.NewExitError(err, 2)
 			}
@@ -40,6 +40,7 @@ require (
 	go.mongodb.org/mongo-driver v1.9.0
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
 	gopkg.in/cheggaaa/pb.v1 v1.0.28
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace github.com/ant0ine/go-json-rest => github.com/asac/go-json-rest v3.3.3-0.20191004094541-40429adaafcb+incompatible
@@ -474,18 +474,23 @@ func (p *Pvr) GetFromRepo(app *AppData) (string, *Source, error) {
 		return "", nil, ErrEmptyPart
 	}
 
+	// app sources must not become the default remote of the repository
+	origin := p.Pvrconfig.Remotes[PvrDefaultRemote]
+
 	state := PvrMap{}
 	objectsCount, err := p.GetRepo(app.From, false, true, &state)
 	if err != nil {
 		return "", nil, err
 	}
-	p.Pvrconfig.DefaultGetUrl = p.Pvrconfig.DefaultPostUrl
+	if origin == nil {
+		delete(p.Pvrconfig.Remotes, PvrDefaultRemote)
+	}
 	err = p.SaveConfig()
 	if err != nil {
 		return "", nil, err
 	}
 
-	fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + p.Objdir)
+	fmt.Println("\nImported " + strconv.Itoa(objectsCount) + " objects to " + p.Objects.String())
 
 	err = p.ResetWithState(&state)
 	if err != nil {
@@ -533,7 +538,7 @@ func (p *Pvr) ListApplications() error {
 	return nil
 }
 
-// ListApplications : List Applications
+// GetApplications : Get the applications of the pvr checkout
 func (p *Pvr) GetApplications() ([]AppData, error) {
 	files, err := ioutil.ReadDir(p.Dir)
 	if err != nil {
@@ -563,15 +568,24 @@ func (p *Pvr) GetApplications() ([]AppData, error) {
 	return sources, nil
 }
 
-// GetApplicationInfo : Get Application Info
-func (p *Pvr) GetApplicationInfo(appname string) error {
+// GetApplicationSrc : Get the src.json of appname
+func (p *Pvr) GetApplicationSrc(appname string) (interface{}, error) {
 	srcFilePath := filepath.Join(p.Dir, appname, "src.json")
 	if _, err := os.Stat(srcFilePath); err != nil {
-		return errors.New("App '" + appname + "' doesn't exist")
+		return nil, errors.New("App '" + appname + "' doesn't exist")
 	}
 	src, _ := ioutil.ReadFile(srcFilePath)
 	var fileData interface{}
 	err := pvjson.Unmarshal(src, &fileData)
+	if err != nil {
+		return nil, err
+	}
+	return fileData, nil
+}
+
+// GetApplicationInfo : Get Application Info
+func (p *Pvr) GetApplicationInfo(appname string) error {
+	fileData, err := p.GetApplicationSrc(appname)
 	if err != nil {
 		return err
 	}
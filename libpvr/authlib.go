@@ -343,8 +343,16 @@ func newDefaultAuthConfig(filePath string) *PvrAuthConfig {
 	}
 }
 
-// Whoami : List all loggedin nick names
-func (s *Session) Whoami() error {
+// PvrLogin is an account we are logged in with at an auth endpoint
+type PvrLogin struct {
+	Nick     string `json:"nick"`
+	Prn      string `json:"prn"`
+	Endpoint string `json:"endpoint"`
+}
+
+// GetLogins returns the accounts we have tokens for
+func (s *Session) GetLogins() ([]PvrLogin, error) {
+	logins := []PvrLogin{}
 	pvrAuthConfig := s.auth
 	for k := range pvrAuthConfig.Tokens {
 		splits := strings.Split(k, " ")
@@ -356,14 +364,31 @@ func (s *Session) Whoami() error {
 			return req.Get(authEndPoint + "/auth_status")
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		responseBody := map[string]interface{}{}
-		err = pvjson.Unmarshal(response.Body(), &responseBody)
+		login := PvrLogin{Endpoint: authEndPoint}
+		err = pvjson.Unmarshal(response.Body(), &login)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		fmt.Fprint(os.Stderr, responseBody["nick"].(string)+"("+responseBody["prn"].(string)+") at "+authEndPoint+"\n")
+		logins = append(logins, login)
+	}
+	return logins, nil
+}
+
+// Whoami : List all loggedin nick names
+func (s *Session) Whoami() error {
+	logins, err := s.GetLogins()
+	if err != nil {
+		return err
 	}
+	PrintLogins(logins)
 	return nil
 }
+
+// PrintLogins prints logins the way Whoami does
+func PrintLogins(logins []PvrLogin) {
+	for _, login := range logins {
+		fmt.Fprint(os.Stderr, login.Nick+"("+login.Prn+") at "+login.Endpoint+"\n")
+	}
+}
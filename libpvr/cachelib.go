@@ -0,0 +1,331 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// PvrCacheRepo records a working copy using the object cache and the
+// objects it referenced when it last updated its state
+type PvrCacheRepo struct {
+	Path    string    `json:"path"`
+	Objects []string  `json:"objects"`
+	Updated time.Time `json:"updated"`
+}
+
+// PvrCachePruneResult reports what CachePrune removed, or would remove on a
+// dry run
+type PvrCachePruneResult struct {
+	Repos        []string
+	Forgotten    []string
+	Reachable    int
+	Removed      []string
+	RemovedBytes int64
+	Temp         []string
+	TempBytes    int64
+	Kept         []string
+}
+
+// ObjectCacheDir is the content addressed object cache shared by all
+// working copies of configDir
+func ObjectCacheDir(configDir string) string {
+	return filepath.Join(configDir, "objects")
+}
+
+// objectCacheReposDir keeps one PvrCacheRepo file per working copy using
+// the object cache of configDir
+func objectCacheReposDir(configDir string) string {
+	return filepath.Join(configDir, "cache", "repos")
+}
+
+// objectCacheSinceFile marks when the first working copy was recorded as
+// user of the object cache of configDir; older pvr versions used the cache
+// without recording their working copies
+func objectCacheSinceFile(configDir string) string {
+	return filepath.Join(configDir, "cache", "since")
+}
+
+func objectCacheRepoFile(configDir string, repoDir string) string {
+	sum := sha256.Sum256([]byte(repoDir))
+	return filepath.Join(objectCacheReposDir(configDir), hex.EncodeToString(sum[:])+".json")
+}
+
+func (p *Pvr) configDir() string {
+	if p.Session == nil {
+		return ""
+	}
+	return p.Session.GetConfigDir()
+}
+
+// UsesObjectCache tells if the objects of p are kept in the shared object
+// cache; checkouts then hardlink objects instead of copying them
+func (p *Pvr) UsesObjectCache() bool {
+	local, ok := p.Objects.(*LocalObjectStore)
+	if !ok || p.configDir() == "" {
+		return false
+	}
+	objDir, err := filepath.Abs(local.Dir)
+	if err != nil {
+		return false
+	}
+	cacheDir, err := filepath.Abs(ObjectCacheDir(p.configDir()))
+	if err != nil {
+		return false
+	}
+	return objDir == cacheDir
+}
+
+// useObjectCache makes a repository without objects location use the
+// shared object cache
+func (p *Pvr) useObjectCache() error {
+	if p.Pvrconfig.ObjectsDir != "" || p.configDir() == "" {
+		return nil
+	}
+
+	cacheDir, err := filepath.Abs(ObjectCacheDir(p.configDir()))
+	if err != nil {
+		return err
+	}
+	err = p.setObjectStore(cacheDir)
+	if err != nil {
+		return err
+	}
+	p.Pvrconfig.ObjectsDir = cacheDir
+	return nil
+}
+
+func (p *Pvr) repoDir() (string, error) {
+	return filepath.Abs(filepath.Dir(p.Pvrdir))
+}
+
+func readCacheRepo(path string) (*PvrCacheRepo, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	repo := PvrCacheRepo{}
+	err = pvjson.Unmarshal(buf, &repo)
+	if err != nil {
+		return nil, errors.New("JSON Unmarshal (" + path + "): " + err.Error())
+	}
+	return &repo, nil
+}
+
+func writeCacheRepo(configDir string, path string, repo *PvrCacheRepo) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	since, err := os.OpenFile(objectCacheSinceFile(configDir), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err == nil {
+		since.Close()
+	} else if !os.IsExist(err) {
+		return err
+	}
+	buf, err := json.MarshalIndent(repo, "", "	")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".new", buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
+
+// TrackObjectCache records the objects p references in the object cache so
+// pvr cache prune keeps them
+func (p *Pvr) TrackObjectCache() error {
+	if !p.UsesObjectCache() {
+		return nil
+	}
+	dir, err := p.repoDir()
+	if err != nil {
+		return err
+	}
+
+	objects, err := p.ReachableObjects()
+	if err != nil {
+		return err
+	}
+	repo := PvrCacheRepo{Path: dir, Objects: []string{}, Updated: time.Now()}
+	for sha := range objects {
+		repo.Objects = append(repo.Objects, sha)
+	}
+	sort.Strings(repo.Objects)
+
+	return writeCacheRepo(p.configDir(), objectCacheRepoFile(p.configDir(), dir), &repo)
+}
+
+// CacheRepos lists the working copies recorded as users of the object
+// cache of s
+func CacheRepos(s *Session) ([]PvrCacheRepo, error) {
+	entries, err := os.ReadDir(objectCacheReposDir(s.GetConfigDir()))
+	if os.IsNotExist(err) {
+		return []PvrCacheRepo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []PvrCacheRepo{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		repo, err := readCacheRepo(filepath.Join(objectCacheReposDir(s.GetConfigDir()), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, *repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Path < repos[j].Path
+	})
+	return repos, nil
+}
+
+// cacheRefs are the objects referenced by the working copies using an
+// object cache
+type cacheRefs struct {
+	Repos     []string
+	Forgotten []string
+	Objects   map[string]bool
+}
+
+// cacheReferences collects the objects referenced by the working copies
+// recorded as users of the object cache of s. The references of working
+// copies that still exist are computed again; those of copies that cannot
+// be opened are taken from their last record. Working copies that were
+// deleted or moved to other objects are reported as forgotten and, with
+// forget, dropped from the records.
+func cacheReferences(s *Session, forget bool) (*cacheRefs, error) {
+	repos, err := CacheRepos(s)
+	if err != nil {
+		return nil, err
+	}
+
+	result := cacheRefs{Repos: []string{}, Forgotten: []string{}, Objects: map[string]bool{}}
+
+	for _, repo := range repos {
+		repoFile := objectCacheRepoFile(s.GetConfigDir(), repo.Path)
+
+		if _, err := os.Stat(filepath.Join(repo.Path, ".pvr", "json")); os.IsNotExist(err) {
+			result.Forgotten = append(result.Forgotten, repo.Path)
+			if forget {
+				os.Remove(repoFile)
+			}
+			continue
+		}
+
+		objects := repo.Objects
+		p, err := NewPvr(s, repo.Path)
+		if err == nil && !p.UsesObjectCache() {
+			result.Forgotten = append(result.Forgotten, repo.Path)
+			if forget {
+				os.Remove(repoFile)
+			}
+			continue
+		}
+		if err == nil {
+			var live map[string]bool
+			live, err = p.ReachableObjects()
+			if err == nil {
+				objects = []string{}
+				for sha := range live {
+					objects = append(objects, sha)
+				}
+			}
+		}
+		if err != nil {
+			s.Emit(PvrEvent{
+				Type:    EventWarning,
+				Name:    repo.Path,
+				Message: "using recorded objects of " + repo.Path + ": " + err.Error(),
+			})
+		}
+
+		for _, sha := range objects {
+			result.Objects[sha] = true
+		}
+		result.Repos = append(result.Repos, repo.Path)
+	}
+
+	return &result, nil
+}
+
+// CachePrune removes objects from the object cache of s that no working
+// copy references anymore (see cacheReferences); working copies that were
+// deleted or moved to other objects are forgotten. Objects modified within
+// the last keepDays days, or within the last hour as a get might still be
+// running, are kept. Unless allRegistered tells that all working copies
+// using the cache are recorded, objects older than the first record are
+// kept too as they might belong to working copies of older pvr versions.
+// With dryRun nothing gets removed.
+func CachePrune(s *Session, dryRun bool, keepDays int, allRegistered bool) (*PvrCachePruneResult, error) {
+	if keepDays < 0 {
+		return nil, errors.New("keep days must not be negative")
+	}
+
+	refs, err := cacheReferences(s, !dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	keepSince := time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour)
+	graceSince := time.Now().Add(-gcTempGracePeriod)
+	if keepSince.After(graceSince) {
+		keepSince = graceSince
+	}
+
+	// without a record of the first user everything might be unrecorded
+	registeredSince := time.Now()
+	if info, err := os.Stat(objectCacheSinceFile(s.GetConfigDir())); err == nil {
+		registeredSince = info.ModTime()
+	}
+
+	cacheDir := ObjectCacheDir(s.GetConfigDir())
+	swept, err := sweepObjects(NewLocalObjectStore(cacheDir), cacheDir, refs.Objects, dryRun, graceSince,
+		func(modTime time.Time) bool {
+			return modTime.After(keepSince) || !allRegistered && modTime.Before(registeredSince)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PvrCachePruneResult{
+		Repos:        refs.Repos,
+		Forgotten:    refs.Forgotten,
+		Reachable:    swept.Reachable,
+		Removed:      swept.Removed,
+		RemovedBytes: swept.RemovedBytes,
+		Temp:         swept.Temp,
+		TempBytes:    swept.TempBytes,
+		Kept:         swept.Kept,
+	}, nil
+}
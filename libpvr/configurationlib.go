@@ -19,10 +19,12 @@ package libpvr
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
 
 	"gitlab.com/pantacor/pvr/utils/pvjson"
 )
@@ -37,6 +39,11 @@ type PvrGlobalConfig struct {
 	Spec            string `json:"Spec"`
 	AutoUpgrade     bool   `json:"AutoUpgrade"`
 	DistributionTag string `json:"DistributionTag"`
+
+	// TransferJobs and TransferLimitRate are the defaults of --jobs and
+	// --limit-rate
+	TransferJobs      int    `json:"TransferJobs"`
+	TransferLimitRate string `json:"TransferLimitRate"`
 }
 
 // LoadConfiguration read configuration from ~/.pvr/config.json or return default configuration
@@ -108,6 +115,12 @@ func (pvr *Pvr) SetConfiguration(arguments []string) (*PvrGlobalConfig, error) {
 		return nil, err
 	}
 
+	// a bad rate would make every later session fail
+	_, err = ParseRate(config.TransferLimitRate)
+	if err != nil {
+		return nil, err
+	}
+
 	configurationFilePath := filepath.Join(pvr.Session.configDir, ConfigurationFile)
 
 	err = WriteConfiguration(configurationFilePath, config)
@@ -123,6 +136,7 @@ func defaultConfiguration() PvrGlobalConfig {
 		Spec:            defaultSpec,
 		AutoUpgrade:     true,
 		DistributionTag: defaultDistributionTag,
+		TransferJobs:    PoolSize,
 	}
 }
 
@@ -132,7 +146,13 @@ func fillStruct(data map[string]interface{}, result interface{}) error {
 		structFieldValue := structValue.FieldByName(k)
 
 		if structFieldValue.CanSet() && structFieldValue.IsValid() {
-			if v == "true" {
+			if structFieldValue.Kind() == reflect.Int {
+				i, err := strconv.Atoi(fmt.Sprintf("%v", v))
+				if err != nil {
+					return errors.New(k + " must be a number: " + err.Error())
+				}
+				structFieldValue.SetInt(int64(i))
+			} else if v == "true" {
 				structFieldValue.Set(reflect.ValueOf(true))
 			} else if v == "false" {
 				structFieldValue.Set(reflect.ValueOf(false))
@@ -127,7 +127,11 @@ func (p *Pvr) dmifyRunJson(container, volume string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println("- Updated " + runJsonPath)
+	p.emit(PvrEvent{
+		Type:    EventInfo,
+		Name:    runJsonPath,
+		Message: "- Updated " + runJsonPath,
+	})
 
 	return nil
 }
@@ -229,7 +233,11 @@ func (p *Pvr) DmCVerityApply(prefix string) error {
 			manifestPath := path.Join(p.Dir, container, DmVolumes, volume+".json")
 
 			if len(out) == 0 {
-				fmt.Println("- Unchanged verity format " + manifestPath)
+				p.emit(PvrEvent{
+					Type:    EventInfo,
+					Name:    manifestPath,
+					Message: "- Unchanged verity format " + manifestPath,
+				})
 				return nil
 			}
 			outS := string(out)
@@ -257,7 +265,11 @@ func (p *Pvr) DmCVerityApply(prefix string) error {
 			os.Rename(manifestPath+".new", manifestPath)
 			p.AddFile([]string{path.Join(container, hashDevice)}, false)
 
-			fmt.Println("- Updated " + manifestPath)
+			p.emit(PvrEvent{
+				Type:    EventInfo,
+				Name:    manifestPath,
+				Message: "- Updated " + manifestPath,
+			})
 
 		}
 	}
@@ -335,7 +347,11 @@ func (p *Pvr) DmCVerityConvert(container string, volume string) error {
 	p.AddFile([]string{path.Join(container, manifestMap["hash_device"].(string)),
 		path.Join(container, DmVolumes, volume+".json")}, false)
 
-	fmt.Println("- Updated " + manifestPath)
+	p.emit(PvrEvent{
+		Type:    EventInfo,
+		Name:    manifestPath,
+		Message: "- Updated " + manifestPath,
+	})
 
 	// update run.json
 
@@ -27,7 +27,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
@@ -35,6 +34,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/distribution/manifest/schema2"
@@ -278,7 +278,12 @@ func (p *Pvr) FindDockerImage(app *AppData) (err error) {
 		}
 
 		if err != nil {
-			fmt.Printf("%s source had an error, trying with other sources \n %s \n", source, err)
+			p.emit(PvrEvent{
+				Type:    EventWarning,
+				Name:    source,
+				Error:   err.Error(),
+				Message: source + " source had an error, trying with other sources: " + err.Error(),
+			})
 		}
 	}
 
@@ -469,25 +474,110 @@ func LoadLocalImage(app *AppData) error {
 
 // AppData : To hold all required App Information
 type AppData struct {
-	SquashFile      string
-	Appname         string
-	DockerURL       string
-	Username        string
-	Password        string
-	Appmanifest     *Source
-	TemplateArgs    map[string]interface{}
-	DestinationPath string
-	LocalImage      DockerImage
-	RemoteImage     DockerImage
-	From            string
-	Source          string
-	Platform        string
-	ConfigFile      string
-	Volumes         []string
-	FormatOptions   string
-	SourceType      string
-	DoOverlay       bool
-	Base            string
+	SquashFile      string                 `json:"squash-file,omitempty"`
+	Appname         string                 `json:"name"`
+	DockerURL       string                 `json:"docker-url,omitempty"`
+	Username        string                 `json:"username,omitempty"`
+	Password        string                 `json:"-"`
+	Appmanifest     *Source                `json:"manifest,omitempty"`
+	TemplateArgs    map[string]interface{} `json:"template-args,omitempty"`
+	DestinationPath string                 `json:"destination-path,omitempty"`
+	LocalImage      DockerImage            `json:"-"`
+	RemoteImage     DockerImage            `json:"-"`
+	From            string                 `json:"from,omitempty"`
+	Source          string                 `json:"source,omitempty"`
+	Platform        string                 `json:"platform,omitempty"`
+	ConfigFile      string                 `json:"config-file,omitempty"`
+	Volumes         []string               `json:"volumes,omitempty"`
+	FormatOptions   string                 `json:"format-options,omitempty"`
+	SourceType      string                 `json:"source-type,omitempty"`
+	DoOverlay       bool                   `json:"do-overlay,omitempty"`
+	Base            string                 `json:"base,omitempty"`
+}
+
+// downloadRemoteLayers fetches the layers of the remote image of app into
+// cacheDir, up to --jobs of them in parallel, and returns their files in
+// layer order
+func (p *Pvr) downloadRemoteLayers(app *AppData, cacheDir string) ([]string, error) {
+	layers := app.RemoteImage.DockerManifest.Layers
+	files := make([]string, len(layers))
+	errs := make([]error, len(layers))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < p.transferJobs(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				files[i], errs[i] = p.downloadRemoteLayer(app, cacheDir, i)
+			}
+		}()
+	}
+	for i := range layers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (p *Pvr) downloadRemoteLayer(app *AppData, cacheDir string, i int) (string, error) {
+	layer := app.RemoteImage.DockerManifest.Layers[i]
+	filename := filepath.Join(cacheDir, string(layer.Digest)) + ".tar.gz"
+	shaValid, err := FileHasSameSha(filename, string(layer.Digest))
+	if err != nil {
+		return "", err
+	}
+	if shaValid {
+		p.emit(PvrEvent{
+			Type:    EventLayerDownloaded,
+			Name:    string(layer.Digest),
+			Status:  EventStatusCached,
+			Total:   layer.Size,
+			Message: fmt.Sprintf("Layer %d downloaded(cache)", i),
+		})
+		return filename, nil
+	}
+
+	layerReader, err := app.RemoteImage.DockerRegistry.DownloadLayer(context.Background(), app.RemoteImage.ImagePath, layer.Digest)
+	if err != nil {
+		return "", err
+	}
+	layerReader = p.rateLimiter().LimitReader(layerReader)
+	defer layerReader.Close()
+
+	buf := bufio.NewReader(layerReader)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	writedCount, err := buf.WriteTo(file)
+	if err != nil {
+		return "", err
+	}
+	if writedCount != layer.Size {
+		return "", ErrDownloadedLayerDiffSize
+	}
+
+	p.emit(PvrEvent{
+		Type:    EventLayerDownloaded,
+		Name:    string(layer.Digest),
+		Status:  EventStatusOk,
+		Bytes:   writedCount,
+		Total:   layer.Size,
+		Message: fmt.Sprintf("Layer %d downloaded", i),
+	})
+	return filename, nil
 }
 
 func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) error {
@@ -527,8 +617,12 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 
 	defer RemoveAll(tempdir)
 
+	info := func(msg string) {
+		p.emit(PvrEvent{Type: EventInfo, Name: app.Appname, Message: msg})
+	}
+
 	files := []string{}
-	fmt.Println("Downloading layers...")
+	info("Downloading layers...")
 	//	Exists flag is true only if the image got loaded which will depend on
 	//  priority order provided in --source=local,remote
 	if app.LocalImage.Exists {
@@ -538,11 +632,14 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 			return err
 		}
 		if fileExistInCache {
-			fmt.Println("Layers Found in Cache")
-			fmt.Printf("Extracting layers folder(cache)\n")
+			p.emit(PvrEvent{
+				Type:    EventLayerDownloaded,
+				Name:    app.LocalImage.DockerDigest,
+				Status:  EventStatusCached,
+				Message: "Layers Found in Cache\nExtracting layers folder(cache)",
+			})
 		} else {
-			fmt.Println("Layers Not Found in Cache")
-			fmt.Println("Downloading layers from local docker")
+			info("Layers Not Found in Cache\nDownloading layers from local docker")
 			imageReader, err := DownloadLayersFromLocalDocker(app.LocalImage.DockerDigest)
 			if err != nil {
 				return err
@@ -557,8 +654,12 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Layers downloaded from local docker\n")
-			fmt.Printf("Extracting layers folder\n")
+			p.emit(PvrEvent{
+				Type:    EventLayerDownloaded,
+				Name:    app.LocalImage.DockerDigest,
+				Status:  EventStatusOk,
+				Message: "Layers downloaded from local docker\nExtracting layers folder",
+			})
 		}
 
 		MkdirAll(tempdir+"/layers", 0777)
@@ -584,40 +685,9 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 
 	} else if app.RemoteImage.Exists {
 		//Download from remote repo.
-		for i, layer := range app.RemoteImage.DockerManifest.Layers {
-			filename := filepath.Join(cacheDir, string(layer.Digest)) + ".tar.gz"
-			shaValid, err := FileHasSameSha(filename, string(layer.Digest))
-			if err != nil {
-				return err
-			}
-			if shaValid {
-				fmt.Printf("Layer %d downloaded(cache)\n", i)
-				files = append(files, filename)
-				continue
-			}
-
-			layerReader, err := app.RemoteImage.DockerRegistry.DownloadLayer(context.Background(), app.RemoteImage.ImagePath, layer.Digest)
-			if err != nil {
-				return err
-			}
-
-			buf := bufio.NewReader(layerReader)
-
-			file, err := os.Create(filename)
-			if err != nil {
-				return err
-			}
-
-			writedCount, err := buf.WriteTo(file)
-			if writedCount != layer.Size {
-				return ErrDownloadedLayerDiffSize
-			}
-
-			if err != nil {
-				return err
-			}
-			files = append(files, filename)
-			fmt.Printf("Layer %d downloaded\n", i)
+		files, err = p.downloadRemoteLayers(app, cacheDir)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -634,21 +704,20 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 		return ErrTarNotFound
 	}
 
-	fmt.Println("Extracting layers...")
+	info("Extracting layers...")
 	for layerNumber, file := range files {
 		err := ProcessWhiteouts(extractPath, file, layerNumber)
 		if err != nil {
-			log.Println("Error processing whiteouts.")
-			return err
+			return fmt.Errorf("cannot process whiteouts of layer %d: %s", layerNumber, err.Error())
 		}
 		err = Untar(extractPath, file, []string{"--exclude", ".wh.*"})
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Extracting layer %d\n", layerNumber)
+		info(fmt.Sprintf("Extracting layer %d", layerNumber))
 	}
 
-	fmt.Println("Stripping qemu files...")
+	info("Stripping qemu files...")
 	for _, file := range stripFilesList {
 		fileToDelete := filepath.Join(extractPath, file)
 		Remove(fileToDelete)
@@ -659,7 +728,7 @@ func (p *Pvr) GenerateApplicationSquashFS(app *AppData, appManifest *Source) err
 		PrintDebugf("Deleted %s file\n", fileToDelete)
 	}
 
-	fmt.Println("Adding essential structural dirs to operate RO containers")
+	info("Adding essential structural dirs to operate RO containers")
 	for _, file := range structureDirs {
 		dirToMake := filepath.Join(extractPath, file)
 		os.MkdirAll(dirToMake, 0755)
@@ -0,0 +1,266 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/cheggaaa/pb.v1"
+)
+
+const (
+	EventObjectUploadStarted    = "object-upload-started"
+	EventObjectUploadProgress   = "object-upload-progress"
+	EventObjectUploadDone       = "object-upload-done"
+	EventObjectDownloadStarted  = "object-download-started"
+	EventObjectDownloadProgress = "object-download-progress"
+	EventObjectDownloadDone     = "object-download-done"
+	EventFileCommitted          = "file-committed"
+	EventRevisionCommitted      = "revision-committed"
+	EventRevisionPosted         = "revision-posted"
+	EventRemoteInfo             = "remote-info"
+	EventObjectInfoPosted       = "object-info-posted"
+	EventObjectInfoFetched      = "object-info-fetched"
+	EventObjectCopied           = "object-copied"
+	EventLayerDownloaded        = "layer-downloaded"
+	EventRolloutStage           = "rollout-stage"
+	EventMergeConflict          = "merge-conflict"
+	EventMergeResolved          = "merge-resolved"
+	EventInfo                   = "info"
+	EventWarning                = "warning"
+)
+
+// status of object and layer events
+const (
+	EventStatusOk         = "ok"
+	EventStatusLink       = "link"
+	EventStatusCached     = "cached"
+	EventStatusLinkCached = "link-cached"
+	EventStatusDupe       = "dupe"
+	EventStatusError      = "error"
+	EventStatusAdded      = "added"
+	EventStatusChanged    = "changed"
+	EventStatusRemoved    = "removed"
+)
+
+const (
+	EventFormatCli  = "cli"
+	EventFormatJson = "json"
+)
+
+// PvrEvent is a single progress event. Name is the object, file or layer
+// the event is about; Message is a human readable version of the event.
+type PvrEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name,omitempty"`
+	Sha     string    `json:"sha,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// EventSink receives the events of libpvr operations. Emit can be called
+// from several goroutines at once.
+type EventSink interface {
+	Emit(event PvrEvent)
+}
+
+// NewEventSink returns the sink for format; see EventFormatCli and
+// EventFormatJson
+func NewEventSink(format string, w io.Writer) (EventSink, error) {
+	switch format {
+	case "", EventFormatCli:
+		return NewCliEventSink(), nil
+	case EventFormatJson:
+		return NewJsonLinesEventSink(w), nil
+	}
+	return nil, errors.New("unknown event format '" + format + "'; use one of cli or json")
+}
+
+// JsonLinesEventSink writes every event as a line of json
+type JsonLinesEventSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJsonLinesEventSink(w io.Writer) *JsonLinesEventSink {
+	return &JsonLinesEventSink{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (s *JsonLinesEventSink) Emit(event PvrEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encoder.Encode(event)
+}
+
+// CliEventSink shows object transfers as progress bars and prints all
+// other events as text
+type CliEventSink struct {
+	mu     sync.Mutex
+	pool   *pb.Pool
+	bars   map[string]*pb.ProgressBar
+	active int
+}
+
+func NewCliEventSink() *CliEventSink {
+	return &CliEventSink{
+		bars: map[string]*pb.ProgressBar{},
+	}
+}
+
+func eventStatusPostfix(status string) string {
+	switch status {
+	case EventStatusLink:
+		return " [LK]"
+	case EventStatusCached:
+		return " [OK cache]"
+	case EventStatusLinkCached:
+		return " [LK cache]"
+	case EventStatusDupe:
+		return " [OK - Dupe]"
+	case EventStatusError:
+		return " [ERROR]"
+	}
+	return " [OK]"
+}
+
+func eventShortName(name string, n int) string {
+	if len(name) > n {
+		return name[:n]
+	}
+	return name
+}
+
+func (s *CliEventSink) startBar(key string, event PvrEvent, upload bool) {
+	bar := pb.New64(event.Total)
+	bar.ShowCounters = false
+	if upload {
+		bar.Units = pb.U_BYTES
+		bar.UnitsWidth = 25
+		bar.ShowSpeed = true
+		bar.Prefix(eventShortName(event.Name, 12) + " ")
+	} else {
+		bar.SetUnits(pb.KB)
+		bar.Prefix(eventShortName(event.Name, 15))
+	}
+
+	if s.pool == nil {
+		pool, err := pb.StartPool()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: starting progressbar pool failed: "+err.Error())
+			return
+		}
+		s.pool = pool
+	}
+	s.pool.Add(bar)
+	s.bars[key] = bar
+	s.active++
+}
+
+func (s *CliEventSink) finishBar(key string, event PvrEvent) bool {
+	bar, ok := s.bars[key]
+	if !ok {
+		return false
+	}
+	delete(s.bars, key)
+
+	bar.ShowFinalTime = event.Type == EventObjectUploadDone
+	bar.ShowPercent = false
+	bar.ShowCounters = false
+	bar.ShowTimeLeft = false
+	bar.ShowSpeed = false
+	bar.ShowBar = event.Type == EventObjectUploadDone
+	bar.Postfix(eventStatusPostfix(event.Status))
+	bar.Set64(bar.Total)
+	bar.Finish()
+
+	s.active--
+	if s.active == 0 && s.pool != nil {
+		s.pool.Stop()
+		s.pool = nil
+	}
+	return true
+}
+
+func (s *CliEventSink) Emit(event PvrEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch event.Type {
+	case EventObjectUploadStarted:
+		s.startBar("up:"+event.Name, event, true)
+	case EventObjectDownloadStarted:
+		s.startBar("down:"+event.Name, event, false)
+	case EventObjectUploadProgress:
+		if bar, ok := s.bars["up:"+event.Name]; ok {
+			bar.Total = event.Total
+			bar.Set64(event.Bytes)
+		}
+	case EventObjectDownloadProgress:
+		if bar, ok := s.bars["down:"+event.Name]; ok {
+			bar.Total = event.Total
+			bar.ShowTimeLeft = true
+			bar.ShowCounters = true
+			bar.ShowPercent = true
+			bar.Set64(event.Bytes)
+		}
+	case EventObjectUploadDone:
+		if !s.finishBar("up:"+event.Name, event) {
+			fmt.Fprintln(os.Stderr, eventShortName(event.Name, 12)+eventStatusPostfix(event.Status))
+		}
+	case EventObjectDownloadDone:
+		if !s.finishBar("down:"+event.Name, event) && event.Message != "" {
+			fmt.Fprintln(os.Stderr, event.Message)
+		}
+		if event.Error != "" {
+			fmt.Fprintln(os.Stderr, "ERROR: Downloading "+event.Error)
+		}
+	case EventWarning:
+		fmt.Fprintln(os.Stderr, "WARNING: "+event.Message)
+	case EventInfo, EventLayerDownloaded:
+		fmt.Println(event.Message)
+	default:
+		if event.Message != "" {
+			fmt.Fprintln(os.Stderr, event.Message)
+		}
+	}
+}
+
+var defaultEventSink EventSink = NewCliEventSink()
+
+// emit sends event to the sink of the session
+func (p *Pvr) emit(event PvrEvent) {
+	if p.Session != nil {
+		p.Session.Emit(event)
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	defaultEventSink.Emit(event)
+}
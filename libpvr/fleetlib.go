@@ -0,0 +1,414 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty"
+	pvrapi "gitlab.com/pantacor/pvr/api"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// DeviceSelector selects devices by their fields. It is parsed from a comma
+// separated list of KEY=VALUE or KEY!=VALUE terms that all have to match,
+// e.g. "user-meta.site=berlin,nick!=test". With KEY=~PATTERN or
+// KEY!~PATTERN the value is matched against a shell pattern instead, e.g.
+// "nick=~cam-*". Dots in KEY descend into maps like user-meta and
+// device-meta.
+type DeviceSelector []deviceSelectorTerm
+
+type deviceSelectorTerm struct {
+	key    string
+	value  string
+	negate bool
+	glob   bool
+}
+
+// ParseDeviceSelector parses a selector expression
+func ParseDeviceSelector(expr string) (DeviceSelector, error) {
+	selector := DeviceSelector{}
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		t := deviceSelectorTerm{}
+		i := strings.IndexAny(term, "=~")
+		if i <= 0 {
+			return nil, errors.New("invalid selector term '" + term + "', expected KEY=VALUE, KEY!=VALUE, KEY=~PATTERN or KEY!~PATTERN")
+		}
+		t.key = term[:i]
+		t.value = term[i+1:]
+		if term[i] == '~' {
+			// KEY!~PATTERN
+			if !strings.HasSuffix(t.key, "!") {
+				return nil, errors.New("invalid selector term '" + term + "', expected KEY=~PATTERN or KEY!~PATTERN")
+			}
+			t.glob = true
+		} else if strings.HasPrefix(t.value, "~") {
+			t.glob = true
+			t.value = t.value[1:]
+		}
+		if strings.HasSuffix(t.key, "!") {
+			t.negate = true
+			t.key = strings.TrimSuffix(t.key, "!")
+		}
+		if t.key == "" {
+			return nil, errors.New("invalid selector term '" + term + "', key is empty")
+		}
+		if t.glob {
+			if _, err := path.Match(t.value, ""); err != nil {
+				return nil, errors.New("invalid pattern in selector term '" + term + "': " + err.Error())
+			}
+		}
+		selector = append(selector, t)
+	}
+	if len(selector) == 0 {
+		return nil, errors.New("empty selector")
+	}
+	return selector, nil
+}
+
+// Matches tells if device, a device document of the devices endpoint,
+// matches all terms of the selector
+func (s DeviceSelector) Matches(device map[string]interface{}) bool {
+	for _, t := range s {
+		v, ok := lookupDeviceField(device, t.key)
+		matches := false
+		if ok && t.glob {
+			matches, _ = path.Match(t.value, fmt.Sprint(v))
+		} else if ok {
+			matches = fmt.Sprint(v) == t.value
+		}
+		if matches == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupDeviceField finds key in doc; keys may contain dots themselves, so
+// the full key is tried first before descending at each dot
+func lookupDeviceField(doc map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := doc[key]; ok {
+		return v, true
+	}
+	for i := strings.Index(key, "."); i > 0; {
+		if sub, ok := doc[key[:i]].(map[string]interface{}); ok {
+			if v, ok := lookupDeviceField(sub, key[i+1:]); ok {
+				return v, true
+			}
+		}
+		next := strings.Index(key[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
+}
+
+// PvrFleetDevice is a device selected for a fleet operation
+type PvrFleetDevice struct {
+	Id   string `json:"id"`
+	Nick string `json:"nick"`
+}
+
+// SelectDevices lists the devices of the logged in user matching selector
+func (s *Session) SelectDevices(baseURL string, selector DeviceSelector) ([]PvrFleetDevice, error) {
+	response, err := s.GetDevices(baseURL, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []map[string]interface{}{}
+	err = pvjson.Unmarshal(response.Body(), &docs)
+	if err != nil {
+		return nil, errors.New("cannot parse devices response: " + err.Error())
+	}
+
+	devices := []PvrFleetDevice{}
+	for _, doc := range docs {
+		if !selector.Matches(doc) {
+			continue
+		}
+		device := PvrFleetDevice{}
+		device.Id, _ = doc["id"].(string)
+		device.Nick, _ = doc["nick"].(string)
+		if device.Id == "" {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Nick < devices[j].Nick
+	})
+
+	return devices, nil
+}
+
+// PvrFleetResult is the outcome of a fleet post for one device
+type PvrFleetResult struct {
+	Device   PvrFleetDevice `json:"device"`
+	Rev      string         `json:"rev,omitempty"`
+	StateSha string         `json:"state-sha,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// fleetTarget is the per device state of a fleet post
+type fleetTarget struct {
+	remote  pvrapi.PvrRemote
+	state   PvrMap
+	needed  map[string]string
+	current map[string]string
+	err     error
+}
+
+// fleetEach runs f for 0..n-1 with at most maxParallel running at once
+func fleetEach(n int, maxParallel int, f func(i int)) {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	sem := make(chan struct{}, maxParallel)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// mergePart replaces part in the state dest with the one of src
+func mergePart(dest PvrMap, src PvrMap, part string) (PvrMap, error) {
+	merged := PvrMap{}
+	for k, v := range dest {
+		if k == part || strings.HasPrefix(k, part+"/") {
+			continue
+		}
+		merged[k] = v
+	}
+	found := false
+	for k, v := range src {
+		if k == part || strings.HasPrefix(k, part+"/") {
+			merged[k] = v
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("local state has no part " + part)
+	}
+	return merged, nil
+}
+
+// fleetDeviceState gets the current state of the trail of remote; empty if
+// the trail has no state yet. Error documents never pass for states as
+// parts would get merged into them.
+func (p *Pvr) fleetDeviceState(remote pvrapi.PvrRemote) (PvrMap, error) {
+	current := PvrMap{}
+	if remote.JsonGetUrl == "" {
+		return current, nil
+	}
+
+	response, err := p.Session.DoAuthCall(true, func(req *resty.Request) (*resty.Response, error) {
+		return req.Get(remote.JsonGetUrl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() == http.StatusNotFound {
+		return current, nil
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New("cannot get current state: REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	err = pvjson.Unmarshal(response.Body(), &current)
+	if err != nil {
+		return nil, errors.New("cannot parse current state: " + err.Error())
+	}
+	if _, ok := current["#spec"]; !ok {
+		return nil, errors.New("current state has no #spec")
+	}
+	return current, nil
+}
+
+// fleetUploads computes the union of the objects missing on each objects
+// endpoint of targets so every object gets uploaded once per endpoint;
+// objects in the current state of any device there are not missing. refs
+// are the objects each endpoint has already. Targets that failed are left
+// out.
+func fleetUploads(targets []fleetTarget) (endpoints []string, uploads map[string]map[string]string,
+	refs map[string]map[string]interface{}) {
+
+	endpoints = []string{}
+	uploads = map[string]map[string]string{}
+	refs = map[string]map[string]interface{}{}
+	for _, t := range targets {
+		if t.err != nil {
+			continue
+		}
+		ep := t.remote.ObjectsEndpointUrl
+		if refs[ep] == nil {
+			refs[ep] = map[string]interface{}{}
+		}
+		for _, sha := range t.current {
+			refs[ep][sha] = true
+		}
+	}
+	for _, t := range targets {
+		if t.err != nil {
+			continue
+		}
+		ep := t.remote.ObjectsEndpointUrl
+		if uploads[ep] == nil {
+			endpoints = append(endpoints, ep)
+			uploads[ep] = map[string]string{}
+		}
+		for name, sha := range t.needed {
+			if refs[ep][sha] == nil {
+				uploads[ep][name] = sha
+			}
+		}
+	}
+	return endpoints, uploads, refs
+}
+
+// FleetPost posts the local state to the trails of devices. With a part
+// only that part of the local state replaces the same part of the current
+// state of each device. Objects get uploaded once per objects endpoint for
+// the whole batch; at most maxParallel devices are talked to at once. The
+// returned results are in the order of devices. If not nil, posted gets
+// called with the index and result of each device as soon as its post is
+// done, possibly from several goroutines at once.
+func (p *Pvr) FleetPost(baseURL string, devices []PvrFleetDevice, part string,
+	envelope string, commitMsg string, maxParallel int, force bool,
+	posted func(i int, result PvrFleetResult)) []PvrFleetResult {
+
+	targets := make([]fleetTarget, len(devices))
+
+	// resolve remotes and compute the state to post for each device
+	prepare := func(i int) {
+		t := &targets[i]
+		trailURL, err := url.Parse(strings.TrimSuffix(baseURL, "/") + PhTrailsEp + "/" + devices[i].Id)
+		if err != nil {
+			t.err = err
+			return
+		}
+		t.remote, err = p.initializeRemote(trailURL)
+		if err != nil {
+			t.err = err
+			return
+		}
+
+		current, err := p.fleetDeviceState(t.remote)
+		if err != nil {
+			t.err = err
+			return
+		}
+
+		t.state = p.PristineJsonMap
+		if part != "" {
+			t.state, err = mergePart(current, p.PristineJsonMap, part)
+			if err != nil {
+				t.err = err
+				return
+			}
+		}
+
+		t.current, err = listFilesAndObjectsFromJson(current, []string{})
+		if err != nil {
+			t.err = err
+			return
+		}
+		t.needed, err = listFilesAndObjectsFromJson(t.state, []string{})
+		if err != nil {
+			t.err = err
+			return
+		}
+	}
+	// the first device alone so a login happens once before the others
+	// talk to the server in parallel
+	if len(devices) > 0 {
+		prepare(0)
+	}
+	fleetEach(len(devices)-1, maxParallel, func(i int) {
+		prepare(i + 1)
+	})
+
+	endpoints, uploads, refs := fleetUploads(targets)
+	uploadErrs := map[string]error{}
+	for _, ep := range endpoints {
+		p.emit(PvrEvent{
+			Type:    EventRemoteInfo,
+			Name:    ep,
+			Status:  EventStatusOk,
+			Message: "Uploading objects to " + ep,
+		})
+		uploadErrs[ep] = p.uploadObjects(ep, uploads[ep], refs[ep], force)
+	}
+
+	// post the new states
+	results := make([]PvrFleetResult, len(devices))
+	fleetEach(len(devices), maxParallel, func(i int) {
+		t := &targets[i]
+		results[i].Device = devices[i]
+		if posted != nil {
+			defer func() {
+				posted(i, results[i])
+			}()
+		}
+		if t.err == nil {
+			t.err = uploadErrs[t.remote.ObjectsEndpointUrl]
+		}
+		if t.err != nil {
+			results[i].Error = t.err.Error()
+			return
+		}
+
+		body, err := p.postRemoteJson(t.remote, t.state, envelope, commitMsg, 0, force)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		result, err := parsePostResult(body)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		results[i].Rev = result.Rev
+		results[i].StateSha = result.StateSha
+	})
+
+	return results
+}
@@ -0,0 +1,188 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	pvrapi "gitlab.com/pantacor/pvr/api"
+)
+
+func ExampleParseDeviceSelector() {
+	for _, expr := range []string{
+		"user-meta.site=berlin,nick!=test",
+		"nick=~cam-*,status!~ERR*",
+		"nick~cam",
+		"nick=~[",
+		"=berlin",
+		" , ",
+	} {
+		selector, err := ParseDeviceSelector(expr)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		for _, t := range selector {
+			fmt.Printf("%q %q negate=%v glob=%v\n", t.key, t.value, t.negate, t.glob)
+		}
+	}
+	// Output:
+	// "user-meta.site" "berlin" negate=false glob=false
+	// "nick" "test" negate=true glob=false
+	// "nick" "cam-*" negate=false glob=true
+	// "status" "ERR*" negate=true glob=true
+	// invalid selector term 'nick~cam', expected KEY=~PATTERN or KEY!~PATTERN
+	// invalid pattern in selector term 'nick=~[': syntax error in pattern
+	// invalid selector term '=berlin', expected KEY=VALUE, KEY!=VALUE, KEY=~PATTERN or KEY!~PATTERN
+	// empty selector
+}
+
+func ExampleDeviceSelector_Matches() {
+	device := map[string]interface{}{
+		"nick": "cam-berlin-1",
+		"user-meta": map[string]interface{}{
+			"site": "berlin",
+		},
+	}
+	for _, expr := range []string{
+		"user-meta.site=berlin",
+		"user-meta.site!=berlin",
+		"nick=~cam-*",
+		"nick!~cam-*",
+		"user-meta.site=berlin,nick=~gw-*",
+		"device-meta.arch!=arm64",
+	} {
+		selector, _ := ParseDeviceSelector(expr)
+		fmt.Println(expr, selector.Matches(device))
+	}
+	// Output:
+	// user-meta.site=berlin true
+	// user-meta.site!=berlin false
+	// nick=~cam-* true
+	// nick!~cam-* false
+	// user-meta.site=berlin,nick=~gw-* false
+	// device-meta.arch!=arm64 true
+}
+
+func Example_lookupDeviceField() {
+	doc := map[string]interface{}{
+		"nick": "cam-1",
+		"device-meta": map[string]interface{}{
+			"pantavisor.arch": "aarch64",
+			"interfaces": map[string]interface{}{
+				"eth0": "10.0.0.2",
+			},
+		},
+	}
+	for _, key := range []string{
+		"nick",
+		"device-meta.pantavisor.arch",
+		"device-meta.interfaces.eth0",
+		"device-meta.interfaces",
+		"device-meta.missing",
+	} {
+		v, ok := lookupDeviceField(doc, key)
+		fmt.Println(key, v, ok)
+	}
+	// Output:
+	// nick cam-1 true
+	// device-meta.pantavisor.arch aarch64 true
+	// device-meta.interfaces.eth0 10.0.0.2 true
+	// device-meta.interfaces map[eth0:10.0.0.2] true
+	// device-meta.missing <nil> false
+}
+
+func Example_mergePart() {
+	device := PvrMap{
+		"#spec":              "pantavisor-service-system@1",
+		"bsp/run.json":       "bsp-device",
+		"app/run.json":       "app-old",
+		"app/root.squashfs":  "sha-old",
+		"application/a.json": "other",
+	}
+	local := PvrMap{
+		"#spec":             "pantavisor-service-system@1",
+		"bsp/run.json":      "bsp-local",
+		"app/run.json":      "app-new",
+		"app/root.squashfs": "sha-new",
+	}
+
+	merged, _ := mergePart(device, local, "app")
+	keys := []string{}
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Println(k, merged[k])
+	}
+
+	_, err := mergePart(device, local, "missing")
+	fmt.Println(err)
+	// Output:
+	// #spec pantavisor-service-system@1
+	// app/root.squashfs sha-new
+	// app/run.json app-new
+	// application/a.json other
+	// bsp/run.json bsp-device
+	// local state has no part missing
+}
+
+func Example_fleetUploads() {
+	ep1 := pvrapi.PvrRemote{ObjectsEndpointUrl: "https://api.example.com/objects"}
+	ep2 := pvrapi.PvrRemote{ObjectsEndpointUrl: "https://other.example.com/objects"}
+	targets := []fleetTarget{
+		{
+			remote:  ep1,
+			current: map[string]string{"bsp/kernel.img": "kernel-old"},
+			needed:  map[string]string{"bsp/kernel.img": "kernel-new", "app/root.squashfs": "app"},
+		},
+		{
+			// has the new kernel already, so nobody on ep1 uploads it
+			remote:  ep1,
+			current: map[string]string{"bsp/kernel.img": "kernel-new"},
+			needed:  map[string]string{"bsp/kernel.img": "kernel-new", "app/root.squashfs": "app"},
+		},
+		{
+			remote:  ep2,
+			current: map[string]string{},
+			needed:  map[string]string{"bsp/kernel.img": "kernel-new"},
+		},
+		{
+			remote: ep2,
+			err:    errors.New("device unreachable"),
+			needed: map[string]string{"bsp/firmware.bin": "firmware"},
+		},
+	}
+
+	endpoints, uploads, _ := fleetUploads(targets)
+	for _, ep := range endpoints {
+		names := []string{}
+		for name := range uploads[ep] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(ep, name, uploads[ep][name])
+		}
+	}
+	// Output:
+	// https://api.example.com/objects app/root.squashfs app
+	// https://other.example.com/objects bsp/kernel.img kernel-new
+}
@@ -0,0 +1,422 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+const (
+	FsckCorruptObject = "corrupt-object"
+	FsckMissingObject = "missing-object"
+	FsckTempFile      = "temp-file"
+	FsckBadIndex      = "bad-index"
+	FsckBadSpec       = "bad-spec"
+	FsckBadJson       = "bad-json"
+	FsckBadReference  = "bad-reference"
+	FsckBadHistory    = "bad-history"
+)
+
+var specRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*@[0-9]+$`)
+
+// PvrFsckProblem is a single inconsistency found by Fsck. Name is the
+// object, file or state key the problem was found in.
+type PvrFsckProblem struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+func (f PvrFsckProblem) String() string {
+	s := f.Kind + " " + f.Name + ": " + f.Detail
+	if f.Repaired {
+		s += " [repaired]"
+	}
+	return s
+}
+
+type PvrFsckResult struct {
+	Objects  int              `json:"objects"`
+	Problems []PvrFsckProblem `json:"problems"`
+}
+
+// FsckIndex checks the staging index .pvr/new in pvrDir. It has to be
+// checked before NewPvr as that refuses to load repositories with a
+// corrupt index. With repair a corrupt index is moved to new.corrupt,
+// which unstages all added files.
+func FsckIndex(pvrDir string, repair bool) (*PvrFsckProblem, error) {
+	indexPath := filepath.Join(pvrDir, "new")
+	buf, err := ioutil.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := PvrIndex{}
+	err = pvjson.Unmarshal(buf, &index)
+	if err == nil {
+		for k, v := range index {
+			if !IsSha(v.Sha) {
+				err = errors.New("bad sha for " + k)
+				break
+			}
+		}
+	}
+	if err == nil {
+		return nil, nil
+	}
+
+	problem := PvrFsckProblem{
+		Kind:   FsckBadIndex,
+		Name:   ".pvr/new",
+		Detail: err.Error(),
+	}
+	if repair {
+		err = os.Rename(indexPath, indexPath+".corrupt")
+		if err != nil {
+			return nil, err
+		}
+		problem.Repaired = true
+	}
+	return &problem, nil
+}
+
+// fsckObjects re-hashes every object in the object store. Corrupt objects
+// and stale .new files are removed with repair.
+func (p *Pvr) fsckObjects(repair bool, result *PvrFsckResult) (map[string]bool, error) {
+	valid := map[string]bool{}
+
+	// leftovers of interrupted copies; with remote stores Objdir stages
+	// the transfers
+	entries, err := os.ReadDir(p.Objdir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	tempKeepSince := time.Now().Add(-gcTempGracePeriod)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".new") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(tempKeepSince) {
+			// might still get written
+			continue
+		}
+		problem := PvrFsckProblem{
+			Kind:   FsckTempFile,
+			Name:   name,
+			Detail: "leftover of an interrupted copy",
+		}
+		if repair {
+			err = os.Remove(filepath.Join(p.Objdir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			problem.Repaired = true
+		}
+		result.Problems = append(result.Problems, problem)
+	}
+
+	shas, err := p.Objects.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range shas {
+		result.Objects++
+		sha, err := objectContentSha(p.Objects, name)
+		if err != nil {
+			return nil, err
+		}
+		if sha == name {
+			valid[name] = true
+			continue
+		}
+
+		problem := PvrFsckProblem{
+			Kind:   FsckCorruptObject,
+			Name:   name,
+			Detail: "content has sha " + sha,
+		}
+		if repair {
+			err = p.Objects.Delete(name)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if !p.isLocalObjects() {
+				os.Remove(filepath.Join(p.Objdir, name))
+			}
+			problem.Repaired = true
+		}
+		result.Problems = append(result.Problems, problem)
+	}
+	return valid, nil
+}
+
+// objectContentSha hashes the content of object sha in store
+func objectContentSha(store ObjectStore, sha string) (string, error) {
+	r, _, err := store.Get(sha)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fsckState checks #spec and the references of the pristine state as well
+// as the syntax of checked out inline json files. It returns the missing
+// objects by key.
+func (p *Pvr) fsckState(valid map[string]bool, result *PvrFsckResult) map[string]interface{} {
+	missing := map[string]interface{}{}
+
+	spec, ok := p.PristineJsonMap["#spec"].(string)
+	if !ok {
+		result.Problems = append(result.Problems, PvrFsckProblem{
+			Kind:   FsckBadSpec,
+			Name:   "#spec",
+			Detail: "missing or not a string",
+		})
+	} else if !specRegexp.MatchString(spec) {
+		result.Problems = append(result.Problems, PvrFsckProblem{
+			Kind:   FsckBadSpec,
+			Name:   "#spec",
+			Detail: "'" + spec + "' is not of the form <name>@<version>",
+		})
+	}
+
+	for k, v := range p.PristineJsonMap {
+		if strings.HasPrefix(k, "#spec") {
+			continue
+		}
+
+		if isInlineJson(k, v) {
+			buf, err := ioutil.ReadFile(filepath.Join(p.Dir, filepath.FromSlash(k)))
+			if err != nil {
+				// not checked out is fine
+				continue
+			}
+			var doc interface{}
+			err = pvjson.Unmarshal(buf, &doc)
+			if err != nil {
+				result.Problems = append(result.Problems, PvrFsckProblem{
+					Kind:   FsckBadJson,
+					Name:   k,
+					Detail: err.Error(),
+				})
+			}
+			continue
+		}
+
+		sha, ok := v.(string)
+		if !ok || !IsSha(sha) {
+			result.Problems = append(result.Problems, PvrFsckProblem{
+				Kind:   FsckBadReference,
+				Name:   k,
+				Detail: "not an object sha",
+			})
+			continue
+		}
+		if !valid[sha] {
+			missing[k] = sha
+		}
+	}
+
+	return missing
+}
+
+// fsckHistory checks that HEAD, branches and tags point to revisions and
+// that all reachable revisions and their states can be read
+func (p *Pvr) fsckHistory(result *PvrFsckResult) error {
+	tips := map[string]string{}
+
+	head, err := p.GetHead()
+	if err != nil {
+		result.Problems = append(result.Problems, PvrFsckProblem{
+			Kind:   FsckBadHistory,
+			Name:   PvrHeadFilename,
+			Detail: err.Error(),
+		})
+	} else if head != "" {
+		tips[PvrHeadFilename] = head
+	}
+
+	for _, kind := range []string{PvrBranchesDir, PvrTagsDir} {
+		refs, err := p.listRefs(kind)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			tips[PvrRefsDir+"/"+kind+"/"+ref.Name] = ref.Sha
+		}
+	}
+
+	seen := map[string]bool{}
+	for name, sha := range tips {
+		for sha != "" && !seen[sha] {
+			seen[sha] = true
+			rev, err := p.GetRevision(sha)
+			if err != nil {
+				result.Problems = append(result.Problems, PvrFsckProblem{
+					Kind:   FsckBadHistory,
+					Name:   name,
+					Detail: err.Error(),
+				})
+				break
+			}
+			_, err = p.GetStateMap(rev.StateSha)
+			if err != nil {
+				result.Problems = append(result.Problems, PvrFsckProblem{
+					Kind:   FsckBadHistory,
+					Name:   "revision " + sha,
+					Detail: err.Error(),
+				})
+			}
+			sha = rev.Parent
+		}
+	}
+	return nil
+}
+
+// refetchObjects gets the objects of missing from the repository of the
+// default remote
+func (p *Pvr) refetchObjects(missing map[string]interface{}) (int, error) {
+	source, isRemote, err := p.resolveRemote("", remoteGet)
+	if err != nil {
+		return 0, err
+	}
+	if !isRemote || source == "" {
+		return 0, errors.New("no default remote to refetch missing objects from")
+	}
+
+	sourceUrl, err := url.Parse(source)
+	if err != nil {
+		return 0, err
+	}
+	sourceUrl.Fragment = ""
+
+	if sourceUrl.Scheme == "" {
+		repoPath, _ := SplitRefSuffix(sourceUrl.Path)
+		if fi, err := os.Stat(repoPath); err == nil && fi.IsDir() {
+			return p.refetchLocalObjects(repoPath, missing)
+		}
+
+		repoBaseURL := p.Session.GetApp().Metadata["PVR_REPO_BASEURL_url"].(*url.URL)
+		sourceUrl = repoBaseURL.ResolveReference(sourceUrl)
+	}
+
+	remote, err := p.initializeRemote(sourceUrl)
+	if err != nil {
+		return 0, err
+	}
+	return p.getObjects(false, remote, missing)
+}
+
+func (p *Pvr) refetchLocalObjects(repoPath string, missing map[string]interface{}) (int, error) {
+	source, err := bareRepoObjectStore(repoPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, v := range missing {
+		sha := v.(string)
+		err := copyObject(p.Objects, source, sha)
+		if err != nil {
+			return count, errors.New("cannot refetch object " + sha + " from " + repoPath + ": " + err.Error())
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Fsck checks the consistency of the repository: objects get re-hashed,
+// the pristine state is checked for a valid #spec and references to
+// objects we do not have, checked out inline json files for their syntax
+// and the history for readable revisions and states. With repair corrupt
+// objects and stale temporary files are removed and missing objects are
+// fetched from the default remote again.
+func (p *Pvr) Fsck(repair bool) (*PvrFsckResult, error) {
+	result := PvrFsckResult{Problems: []PvrFsckProblem{}}
+
+	valid, err := p.fsckObjects(repair, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := p.fsckState(valid, &result)
+
+	if repair && len(missing) > 0 {
+		err = os.MkdirAll(p.Objdir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.refetchObjects(missing)
+		if err != nil {
+			return nil, errors.New("cannot refetch missing objects: " + err.Error())
+		}
+	}
+
+	for k, v := range missing {
+		sha := v.(string)
+		problem := PvrFsckProblem{
+			Kind:   FsckMissingObject,
+			Name:   k,
+			Detail: "object " + sha + " not in " + p.Objects.String(),
+		}
+		if repair {
+			has, err := p.Objects.Has(sha)
+			problem.Repaired = err == nil && has
+		}
+		result.Problems = append(result.Problems, problem)
+	}
+
+	err = p.fsckHistory(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result.Problems, func(i, j int) bool {
+		if result.Problems[i].Kind != result.Problems[j].Kind {
+			return result.Problems[i].Kind < result.Problems[j].Kind
+		}
+		return result.Problems[i].Name < result.Problems[j].Name
+	})
+
+	return &result, nil
+}
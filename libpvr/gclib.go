@@ -0,0 +1,281 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objects with .new suffix younger than this might still be written by a
+// running get or commit and are never collected
+const gcTempGracePeriod = time.Hour
+
+// PvrGcResult reports what Gc removed, or would remove on a dry run
+type PvrGcResult struct {
+	Reachable    int
+	Removed      []string
+	RemovedBytes int64
+	Temp         []string
+	TempBytes    int64
+	Kept         []string
+}
+
+// addStateObjects adds the object shas referenced by state to objects
+func addStateObjects(objects map[string]bool, state map[string]interface{}) {
+	for k, v := range state {
+		if isInlineJson(k, v) || strings.HasPrefix(k, "#spec") {
+			continue
+		}
+		if sha, ok := v.(string); ok && IsSha(sha) {
+			objects[sha] = true
+		}
+	}
+}
+
+// reachableRevisions returns all revisions reachable from HEAD, branches and
+// tags
+func (p *Pvr) reachableRevisions() (map[string]bool, error) {
+	tips := []string{}
+
+	head, err := p.GetHead()
+	if err != nil {
+		return nil, err
+	}
+	tips = append(tips, head)
+
+	for _, kind := range []string{PvrBranchesDir, PvrTagsDir} {
+		refs, err := p.listRefs(kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			tips = append(tips, ref.Sha)
+		}
+	}
+
+	revisions := map[string]bool{}
+	for _, sha := range tips {
+		for sha != "" && !revisions[sha] {
+			rev, err := p.GetRevision(sha)
+			if err != nil {
+				return nil, err
+			}
+			revisions[sha] = true
+			sha = rev.Parent
+		}
+	}
+	return revisions, nil
+}
+
+// ReachableObjects returns the shas of all objects referenced by the
+// current state, staged files and the states of all revisions reachable
+// from HEAD, branches and tags
+func (p *Pvr) ReachableObjects() (map[string]bool, error) {
+	objects := map[string]bool{}
+
+	addStateObjects(objects, p.PristineJsonMap)
+	for _, v := range p.NewFiles {
+		objects[v.Sha] = true
+	}
+
+	revisions, err := p.reachableRevisions()
+	if err != nil {
+		return nil, err
+	}
+	for sha := range revisions {
+		rev, err := p.GetRevision(sha)
+		if err != nil {
+			return nil, err
+		}
+		state, err := p.GetStateMap(rev.StateSha)
+		if err != nil {
+			return nil, err
+		}
+		addStateObjects(objects, state)
+	}
+
+	return objects, nil
+}
+
+// Gc removes objects from the object store that are not reachable from
+// this repository or any of others, which must be the other repositories
+// using the same object store. For the shared object cache the working
+// copies recorded as its users are taken into account too. Objects
+// modified within the last keepDays days are kept, as are .new files of
+// copies that might still be in progress. With dryRun nothing gets
+// removed.
+func (p *Pvr) Gc(dryRun bool, keepDays int, others []*Pvr) (*PvrGcResult, error) {
+	if keepDays < 0 {
+		return nil, errors.New("keep days must not be negative")
+	}
+
+	reachable, err := p.ReachableObjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		otherObjects, err := other.ReachableObjects()
+		if err != nil {
+			return nil, errors.New("cannot compute reachable objects of " + other.Dir + ": " + err.Error())
+		}
+		for sha := range otherObjects {
+			reachable[sha] = true
+		}
+	}
+	if p.UsesObjectCache() {
+		refs, err := cacheReferences(p.Session, false)
+		if err != nil {
+			return nil, err
+		}
+		for sha := range refs.Objects {
+			reachable[sha] = true
+		}
+	}
+
+	_, isLocal := p.Objects.(*LocalObjectStore)
+	if !isLocal && keepDays > 0 {
+		return nil, errors.New("object store " + p.Objects.String() + " does not tell the age of objects; keep days must be 0")
+	}
+
+	keepSince := time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour)
+	tempKeepSince := time.Now().Add(-gcTempGracePeriod)
+	if keepSince.Before(tempKeepSince) {
+		tempKeepSince = keepSince
+	}
+
+	return sweepObjects(p.Objects, p.Objdir, reachable, dryRun, tempKeepSince, func(modTime time.Time) bool {
+		return modTime.After(keepSince)
+	})
+}
+
+// sweepObjects removes the objects of store that are not reachable and the
+// .new files in stageDir older than tempKeepSince. keep tells if an
+// unreachable object with the given modification time has to stay; it is
+// only asked for local stores as others do not tell the age of objects.
+func sweepObjects(store ObjectStore, stageDir string, reachable map[string]bool, dryRun bool,
+	tempKeepSince time.Time, keep func(modTime time.Time) bool) (*PvrGcResult, error) {
+
+	local, isLocal := store.(*LocalObjectStore)
+
+	shas, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := PvrGcResult{Reachable: len(reachable)}
+
+	for _, sha := range shas {
+		if reachable[sha] {
+			continue
+		}
+
+		// remote stores only have sizes of the copies staged in stageDir
+		var size int64
+		objPath := filepath.Join(stageDir, sha)
+		if isLocal {
+			objPath = local.Path(sha)
+		}
+		info, err := os.Stat(objPath)
+		if err == nil {
+			size = info.Size()
+		} else if isLocal && os.IsNotExist(err) {
+			continue
+		} else if isLocal {
+			return nil, err
+		}
+
+		if isLocal && keep(info.ModTime()) {
+			result.Kept = append(result.Kept, sha)
+			continue
+		}
+
+		if !dryRun {
+			err = store.Delete(sha)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if !isLocal {
+				os.Remove(objPath)
+			}
+		}
+
+		result.Removed = append(result.Removed, sha)
+		result.RemovedBytes += size
+	}
+
+	// leftovers of interrupted copies; with remote stores stageDir stages
+	// the transfers
+	entries, err := os.ReadDir(stageDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".new") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(tempKeepSince) {
+			continue
+		}
+
+		if !dryRun {
+			err = os.Remove(filepath.Join(stageDir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		result.Temp = append(result.Temp, name)
+		result.TempBytes += info.Size()
+	}
+
+	sort.Strings(result.Removed)
+	sort.Strings(result.Temp)
+	sort.Strings(result.Kept)
+
+	return &result, nil
+}
+
+// HasSharedObjects tells if the objects directory lives outside of the
+// repository and might be used by other repositories too; remote object
+// stores always might be
+func (p *Pvr) HasSharedObjects() bool {
+	if !p.isLocalObjects() {
+		return true
+	}
+	objDir, err := filepath.Abs(p.Objdir)
+	if err != nil {
+		return true
+	}
+	pvrDir, err := filepath.Abs(p.Pvrdir)
+	if err != nil {
+		return true
+	}
+	return !strings.HasPrefix(objDir, pvrDir+string(filepath.Separator))
+}
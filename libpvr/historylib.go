@@ -0,0 +1,498 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	cjson "github.com/gibson042/canonicaljson-go"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+const (
+	// PvrHeadFilename holds the sha of the revision the working copy is based on
+	PvrHeadFilename = "HEAD"
+
+	// PvrRevisionsDir is the content addressed store of revision records
+	PvrRevisionsDir = "revisions"
+
+	// PvrStatesDir is the content addressed store of committed state jsons
+	PvrStatesDir = "states"
+)
+
+// PvrRevision is a single entry in the local revision history. Revisions are
+// stored as canonical json under .pvr/revisions/<sha> and point to the
+// state they committed through StateSha (.pvr/states/<state-sha>)
+type PvrRevision struct {
+	Sha      string    `json:"-"`
+	Parent   string    `json:"parent,omitempty"`
+	Message  string    `json:"message"`
+	Author   string    `json:"author"`
+	Time     time.Time `json:"time"`
+	StateSha string    `json:"state-sha"`
+
+	// Merges maps the sources merged since Parent to the sha of the state
+	// we got from them; the base for the next merge from the same source
+	Merges map[string]string `json:"merges,omitempty"`
+}
+
+func bytesToSha(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// write buf atomically to path unless a file with that name already exists;
+// as all callers are content addressed an existing file has the same content
+func writeContentAddressed(path string, buf []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path+".new", buf, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".new", path)
+}
+
+// DefaultCommitAuthor returns the author used for commits if none is
+// provided through --author or PVR_AUTHOR
+func DefaultCommitAuthor() string {
+	name := "unknown"
+	usr, err := user.Current()
+	if err == nil && usr.Username != "" {
+		name = usr.Username
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return name
+	}
+	return name + "@" + host
+}
+
+// GetHead returns the sha of the revision the repository is currently at;
+// empty string if no revision has been recorded yet
+func (p *Pvr) GetHead() (string, error) {
+	_, sha, err := p.readHead()
+	return sha, err
+}
+
+// readHead resolves .pvr/HEAD. HEAD either refers to a branch
+// ("ref: refs/heads/<name>") or holds a revision sha directly (detached).
+// Repositories without HEAD are on the default branch.
+func (p *Pvr) readHead() (branch string, sha string, err error) {
+	buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrHeadFilename))
+	if os.IsNotExist(err) {
+		branch = PvrDefaultBranch
+	} else if err != nil {
+		return "", "", err
+	} else {
+		head := strings.TrimSpace(string(buf))
+		if !strings.HasPrefix(head, symbolicRefPrefix) {
+			return "", head, nil
+		}
+		branch = strings.TrimPrefix(head, symbolicRefPrefix+PvrRefsDir+"/"+PvrBranchesDir+"/")
+	}
+
+	sha, err = p.readRef(PvrBranchesDir, branch)
+	return branch, sha, err
+}
+
+func (p *Pvr) writeHead(content string) error {
+	headPath := filepath.Join(p.Pvrdir, PvrHeadFilename)
+	err := ioutil.WriteFile(headPath+".new", []byte(content+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(headPath+".new", headPath)
+}
+
+// advanceHead moves the current branch to sha; with a detached HEAD
+// the HEAD itself is moved
+func (p *Pvr) advanceHead(sha string) error {
+	branch, _, err := p.readHead()
+	if err != nil {
+		return err
+	}
+	if branch != "" {
+		return p.writeRef(PvrBranchesDir, branch, sha)
+	}
+	return p.writeHead(sha)
+}
+
+// SaveState stores the canonical form of state json in the state store and
+// returns its sha
+func (p *Pvr) SaveState(stateJson []byte) (string, error) {
+	buf, err := FormatJsonC(stateJson)
+	if err != nil {
+		return "", err
+	}
+
+	sha := bytesToSha(buf)
+	err = writeContentAddressed(filepath.Join(p.Pvrdir, PvrStatesDir, sha), buf)
+	if err != nil {
+		return "", err
+	}
+
+	return sha, nil
+}
+
+// GetState reads a state json previously stored with SaveState
+func (p *Pvr) GetState(stateSha string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrStatesDir, stateSha))
+	if os.IsNotExist(err) {
+		return nil, errors.New("state " + stateSha + " not found in local history")
+	}
+	return buf, err
+}
+
+// GetStateMap reads a stored state and unmarshals it to a PvrMap
+func (p *Pvr) GetStateMap(stateSha string) (PvrMap, error) {
+	buf, err := p.GetState(stateSha)
+	if err != nil {
+		return nil, err
+	}
+
+	state := PvrMap{}
+	err = pvjson.Unmarshal(buf, &state)
+	if err != nil {
+		return nil, errors.New("JSON Unmarshal (state " + stateSha + "): " + err.Error())
+	}
+	return state, nil
+}
+
+// GetRevision loads revision with full sha from the revision store
+func (p *Pvr) GetRevision(sha string) (*PvrRevision, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrRevisionsDir, sha))
+	if os.IsNotExist(err) {
+		return nil, errors.New("revision " + sha + " not found in local history")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rev := PvrRevision{}
+	err = pvjson.Unmarshal(buf, &rev)
+	if err != nil {
+		return nil, errors.New("JSON Unmarshal (revision " + sha + "): " + err.Error())
+	}
+	rev.Sha = sha
+
+	return &rev, nil
+}
+
+// recordRevision stores stateJson and a new revision on top of the current
+// HEAD and moves HEAD to it
+func (p *Pvr) recordRevision(msg string, author string, stateJson []byte) (*PvrRevision, error) {
+	stateSha, err := p.SaveState(stateJson)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := p.GetHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if author == "" {
+		author = DefaultCommitAuthor()
+	}
+
+	merges, err := p.readPendingMerges()
+	if err != nil {
+		return nil, err
+	}
+	if len(merges) == 0 {
+		merges = nil
+	}
+
+	rev := PvrRevision{
+		Parent:   parent,
+		Message:  msg,
+		Author:   author,
+		Time:     time.Now().UTC(),
+		StateSha: stateSha,
+		Merges:   merges,
+	}
+
+	buf, err := cjson.Marshal(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Sha = bytesToSha(buf)
+	err = writeContentAddressed(filepath.Join(p.Pvrdir, PvrRevisionsDir, rev.Sha), buf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.advanceHead(rev.Sha)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.clearPendingMerges()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// find the full sha of a revision from a unique prefix
+func (p *Pvr) findRevision(prefix string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(p.Pvrdir, PvrRevisionsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	match := ""
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !IsSha(name) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if match != "" {
+			return "", errors.New("revision prefix " + prefix + " is ambiguous")
+		}
+		match = name
+	}
+
+	if match == "" {
+		return "", errors.New("unknown revision: " + prefix)
+	}
+	return match, nil
+}
+
+// ResolveRevision resolves a revision reference to the full sha of a
+// revision. Supported syntax is HEAD, a branch or tag name, a full sha or
+// unique sha prefix, each optionally followed by ~N to walk N parents back.
+func (p *Pvr) ResolveRevision(ref string) (string, error) {
+	var sha string
+	var err error
+
+	base := ref
+	back := 0
+	if i := strings.Index(ref, "~"); i >= 0 {
+		base = ref[:i]
+		back = 1
+		if ref[i+1:] != "" {
+			back, err = strconv.Atoi(ref[i+1:])
+			if err != nil || back < 0 {
+				return "", errors.New("invalid revision reference: " + ref)
+			}
+		}
+	}
+
+	if base == "" || base == PvrHeadFilename {
+		sha, err = p.GetHead()
+		if err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", errors.New("no revisions in local history yet; use pvr commit first")
+		}
+	} else {
+		sha, err = p.readRef(PvrBranchesDir, base)
+		if err == nil && sha == "" {
+			sha, err = p.readRef(PvrTagsDir, base)
+		}
+		if err == nil && sha == "" {
+			sha, err = p.findRevision(base)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for ; back > 0; back-- {
+		rev, err := p.GetRevision(sha)
+		if err != nil {
+			return "", err
+		}
+		if rev.Parent == "" {
+			return "", errors.New("revision " + ref + " goes beyond the first revision")
+		}
+		sha = rev.Parent
+	}
+
+	return sha, nil
+}
+
+// Log returns the revision history starting at ref following parents.
+// max <= 0 means no limit.
+func (p *Pvr) Log(ref string, max int) ([]*PvrRevision, error) {
+	result := []*PvrRevision{}
+
+	if ref == "" {
+		head, err := p.GetHead()
+		if err != nil {
+			return nil, err
+		}
+		if head == "" {
+			return result, nil
+		}
+		ref = head
+	}
+
+	sha, err := p.ResolveRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	for sha != "" && (max <= 0 || len(result) < max) {
+		rev, err := p.GetRevision(sha)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rev)
+		sha = rev.Parent
+	}
+
+	return result, nil
+}
+
+// Checkout makes the revision referenced by ref the pristine state of the
+// repository, and resets the working directory to it. Checking out a branch
+// switches to it; everything else detaches HEAD.
+func (p *Pvr) Checkout(ref string, hardlink bool, canonicalJson bool, force bool) error {
+	branchSha, err := p.readRef(PvrBranchesDir, ref)
+	if err != nil {
+		return err
+	}
+	if branchSha != "" {
+		return p.Switch(ref, hardlink, canonicalJson, force)
+	}
+
+	sha, err := p.ResolveRevision(ref)
+	if err != nil {
+		return err
+	}
+
+	rev, err := p.GetRevision(sha)
+	if err != nil {
+		return err
+	}
+
+	return p.checkoutState(rev.StateSha, hardlink, canonicalJson, force, func() error {
+		return p.writeHead(rev.Sha)
+	})
+}
+
+// ErrUncommittedChanges is returned when a checkout would discard changes
+// to tracked files
+var ErrUncommittedChanges = errors.New("working directory has uncommitted changes; commit them or use --force to discard")
+
+// CheckClean fails with ErrUncommittedChanges if tracked files got added,
+// changed or removed since the last commit
+func (p *Pvr) CheckClean() error {
+	status, err := p.Status()
+	if err != nil {
+		return err
+	}
+	if len(status.NewFiles) > 0 || len(status.ChangedFiles) > 0 ||
+		len(status.RemovedFiles) > 0 {
+		return ErrUncommittedChanges
+	}
+	return nil
+}
+
+// checkoutState installs a state from the state store as .pvr/json and
+// resets the working directory to it; onInstalled runs after .pvr/json got
+// replaced, but before the working directory is touched. Without force it
+// refuses to discard uncommitted changes.
+func (p *Pvr) checkoutState(stateSha string, hardlink bool, canonicalJson bool,
+	force bool, onInstalled func() error) error {
+
+	if !force {
+		err := p.CheckClean()
+		if err != nil {
+			return err
+		}
+	}
+
+	stateJson, err := p.GetState(stateSha)
+	if err != nil {
+		return err
+	}
+
+	state := PvrMap{}
+	err = pvjson.Unmarshal(stateJson, &state)
+	if err != nil {
+		return errors.New("JSON Unmarshal (state " + stateSha + "): " + err.Error())
+	}
+
+	for k, v := range state {
+		if isInlineJson(k, v) || strings.HasPrefix(k, "#spec") {
+			continue
+		}
+		has, err := p.Objects.Has(v.(string))
+		if err != nil {
+			return errors.New("cannot look up object for " + k + " in " + p.Objects.String() + ": " + err.Error())
+		}
+		if !has {
+			return errors.New("object for " + k + " missing in " + p.Objects.String())
+		}
+	}
+
+	oldState := p.PristineJsonMap
+
+	jsonPath := filepath.Join(p.Pvrdir, "json")
+	err = ioutil.WriteFile(jsonPath+".new", stateJson, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(jsonPath+".new", jsonPath)
+	if err != nil {
+		return err
+	}
+
+	p.PristineJson = stateJson
+	p.PristineJsonMap = state
+
+	if onInstalled != nil {
+		err = onInstalled()
+		if err != nil {
+			return err
+		}
+	}
+
+	// drop files tracked by the previous state but not by the new one
+	for k := range oldState {
+		if _, ok := state[k]; ok || strings.HasPrefix(k, "#spec") {
+			continue
+		}
+		os.Remove(filepath.Join(p.Dir, filepath.FromSlash(k)))
+	}
+
+	return p.resetInternal(hardlink, canonicalJson, nil)
+}
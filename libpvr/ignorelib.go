@@ -0,0 +1,186 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PvrIgnoreFilename is the name of gitignore style files listing untracked
+// paths pvr should not care about. They can be put in any directory of the
+// working copy and apply to that directory and everything below it.
+const PvrIgnoreFilename = ".pvrignore"
+
+type pvrIgnoreRule struct {
+	// directory of the .pvrignore file the rule comes from, slash separated
+	// and with trailing slash; empty for the top level
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// PvrIgnore matches working copy paths against the rules of all .pvrignore
+// files. Files are loaded on first use of their directory.
+type PvrIgnore struct {
+	dir    string
+	loaded map[string][]pvrIgnoreRule
+}
+
+func NewPvrIgnore(dir string) *PvrIgnore {
+	return &PvrIgnore{
+		dir:    dir,
+		loaded: map[string][]pvrIgnoreRule{},
+	}
+}
+
+func parsePvrIgnoreLine(base string, line string) (rule pvrIgnoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	rule.base = base
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	// patterns without slash match at any depth, others are relative to
+	// the directory of the .pvrignore file
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	line = strings.TrimPrefix(line, "/")
+
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+func (ig *PvrIgnore) rulesOf(base string) []pvrIgnoreRule {
+	if rules, ok := ig.loaded[base]; ok {
+		return rules
+	}
+
+	rules := []pvrIgnoreRule{}
+	f, err := os.Open(filepath.Join(ig.dir, filepath.FromSlash(base), PvrIgnoreFilename))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parsePvrIgnoreLine(base, scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	ig.loaded[base] = rules
+	return rules
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], name[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// matchOne evaluates the rules of all .pvrignore files from the top level
+// down to the directory of relPath; the last matching rule wins
+func (ig *PvrIgnore) matchOne(relPath string, isDir bool) bool {
+	ignored := false
+	dirs := strings.Split(relPath, "/")
+	base := ""
+	for i := 0; i < len(dirs); i++ {
+		for _, rule := range ig.rulesOf(base) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if matchSegments(rule.segments, strings.Split(strings.TrimPrefix(relPath, base), "/")) {
+				ignored = !rule.negate
+			}
+		}
+		base += dirs[i] + "/"
+	}
+	return ignored
+}
+
+// Match tells if the slash separated path relative to the working copy is
+// ignored, either by itself or because one of its parent directories is.
+// .pvrignore files themselves are always ignored so they do not end up in
+// the state.
+func (ig *PvrIgnore) Match(relPath string, isDir bool) bool {
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" {
+		return false
+	}
+	if path.Base(relPath) == PvrIgnoreFilename {
+		return true
+	}
+
+	dirs := strings.Split(relPath, "/")
+	for i := 1; i < len(dirs); i++ {
+		if ig.matchOne(strings.Join(dirs[:i], "/"), true) {
+			return true
+		}
+	}
+	return ig.matchOne(relPath, isDir)
+}
+
+// isTrackedDir tells if any tracked or staged file lives below dir
+func (p *Pvr) isTrackedDir(relPathSlash string) bool {
+	prefix := strings.TrimSuffix(relPathSlash, "/") + "/"
+	for k := range p.PristineJsonMap {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	for k := range p.NewFiles {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
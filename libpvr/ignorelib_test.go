@@ -0,0 +1,78 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func ExamplePvrIgnore_Match() {
+	dir, err := ioutil.TempDir("", "pvrignore-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, PvrIgnoreFilename),
+		[]byte("# editor files\n*.swp\n!keep.swp\n/build/\nlogs/\ndocs/**/*.tmp\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", PvrIgnoreFilename),
+		[]byte("/local.bin\n"), 0644)
+
+	ignore := NewPvrIgnore(dir)
+	for _, c := range []struct {
+		path  string
+		isDir bool
+	}{
+		{"a.swp", false},
+		{"sub/a.swp", false},
+		{"keep.swp", false},
+		{"build/app.bin", false},
+		{"sub/build/app.bin", false},
+		{"logs", false},
+		{"logs", true},
+		{"sub/logs/today.txt", false},
+		{"docs/a.tmp", false},
+		{"docs/x/y/a.tmp", false},
+		{"a.tmp", false},
+		{"sub/local.bin", false},
+		{"local.bin", false},
+		{"sub/deep/local.bin", false},
+		{"sub/.pvrignore", false},
+	} {
+		fmt.Println(c.path, c.isDir, ignore.Match(c.path, c.isDir))
+	}
+	// Output:
+	// a.swp false true
+	// sub/a.swp false true
+	// keep.swp false false
+	// build/app.bin false true
+	// sub/build/app.bin false false
+	// logs false false
+	// logs true true
+	// sub/logs/today.txt false true
+	// docs/a.tmp false true
+	// docs/x/y/a.tmp false true
+	// a.tmp false false
+	// sub/local.bin false true
+	// local.bin false false
+	// sub/deep/local.bin false false
+	// sub/.pvrignore false true
+}
@@ -0,0 +1,123 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gitlab.com/pantacor/pantahub-base/logs"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// LogCheckpoint remembers how far the logs got read. Entries are sorted by
+// TimeCreated, so the time of the last entry and the fingerprints of the
+// entries with exactly that time are enough to continue without gaps or
+// duplicates. Server cursors expire, so they are not persisted.
+type LogCheckpoint struct {
+	TimeCreated time.Time `json:"time-created"`
+	Seen        []string  `json:"seen"`
+
+	path string
+}
+
+// LoadLogCheckpoint reads the checkpoint file path; a missing file gives an
+// empty checkpoint. With an empty path the checkpoint is only kept in
+// memory.
+func LoadLogCheckpoint(path string) (*LogCheckpoint, error) {
+	c := LogCheckpoint{path: path}
+	if path == "" {
+		return &c, nil
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = pvjson.Unmarshal(buf, &c)
+	if err != nil {
+		return nil, errors.New("cannot parse log checkpoint " + path + ": " + err.Error())
+	}
+	return &c, nil
+}
+
+// From is the time to query logs from to continue after the checkpoint;
+// nil if nothing got read yet. Queries have a resolution of seconds, so it
+// is a second earlier and Add skips what got read already.
+func (c *LogCheckpoint) From() *time.Time {
+	if c.TimeCreated.IsZero() {
+		return nil
+	}
+	from := c.TimeCreated.Add(-time.Second)
+	return &from
+}
+
+func logEntryFingerprint(e *logs.Entry) string {
+	buf, _ := json.Marshal(e)
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// Add advances the checkpoint to e; false if e got read already
+func (c *LogCheckpoint) Add(e *logs.Entry) bool {
+	if e.TimeCreated.Before(c.TimeCreated) {
+		return false
+	}
+
+	fingerprint := logEntryFingerprint(e)
+	if e.TimeCreated.Equal(c.TimeCreated) {
+		for _, s := range c.Seen {
+			if s == fingerprint {
+				return false
+			}
+		}
+		c.Seen = append(c.Seen, fingerprint)
+		return true
+	}
+
+	c.TimeCreated = e.TimeCreated
+	c.Seen = []string{fingerprint}
+	return true
+}
+
+// Save writes the checkpoint to its file, if it has one
+func (c *LogCheckpoint) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	buf, err := json.MarshalIndent(c, "", "	")
+	if err != nil {
+		return err
+	}
+
+	pathNew := c.path + ".new"
+	err = ioutil.WriteFile(pathNew, buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(pathNew, c.path)
+}
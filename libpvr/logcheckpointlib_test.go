@@ -0,0 +1,62 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/pantacor/pantahub-base/logs"
+)
+
+func ExampleLogCheckpoint_Add() {
+	t0 := time.Date(2026, 10, 17, 9, 41, 3, 0, time.UTC)
+	entries := []logs.Entry{
+		{TimeCreated: t0, LogText: "a"},
+		{TimeCreated: t0, LogText: "b"},
+		// read again as queries start a second early
+		{TimeCreated: t0, LogText: "a"},
+		{TimeCreated: t0.Add(-time.Second), LogText: "older"},
+		{TimeCreated: t0.Add(time.Second), LogText: "c"},
+		{TimeCreated: t0.Add(time.Second), LogText: "c"},
+	}
+
+	c, _ := LoadLogCheckpoint("")
+	for i := range entries {
+		fmt.Println(entries[i].LogText, c.Add(&entries[i]))
+	}
+	fmt.Println(c.TimeCreated.Format(time.RFC3339), len(c.Seen))
+	// Output:
+	// a true
+	// b true
+	// a false
+	// older false
+	// c true
+	// c false
+	// 2026-10-17T09:41:04Z 1
+}
+
+func ExampleLogCheckpoint_From() {
+	c, _ := LoadLogCheckpoint("")
+	fmt.Println(c.From())
+
+	c.Add(&logs.Entry{TimeCreated: time.Date(2026, 10, 17, 9, 41, 3, 0, time.UTC)})
+	fmt.Println(c.From().Format(time.RFC3339))
+	// Output:
+	// <nil>
+	// 2026-10-17T09:41:02Z
+}
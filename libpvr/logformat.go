@@ -17,19 +17,116 @@
 package libpvr
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gitlab.com/pantacor/pantahub-base/logs"
+	"golang.org/x/term"
 )
 
+// LogFormatter writes log entries. Init gets the argument of the format,
+// e.g. the columns of "csv:time,text", before the first DoLog.
 type LogFormatter interface {
 	Init(template string) error
 	DoLog(m *logs.Entry) error
 }
 
-type LogFormatterJson struct{}
+// LogFormatTemplateShort is the default format of pvr device logs
+const LogFormatTemplateShort = "{{ .Device | prn2id " +
+	"| sprintf \"%10.10s\" }}" +
+	"({{ .LogRev | sprintf \"%3s\" }}) " +
+	"{{ .TimeCreated | timeformat \"Stamp\" }}" +
+	"{{ .LogPlat | sprintf \"%12s\" }}(" +
+	"{{ .LogSource |  basename | sprintf \"%-15.15s\"}})" +
+	": {{ .LogText }}"
+
+// logFormatters are the registered formatters by name; each creates a
+// formatter writing to out, the terminal if out is nil
+var logFormatters = map[string]func(out io.Writer) LogFormatter{
+	"short": func(out io.Writer) LogFormatter {
+		return &LogFormatterTemplate{Out: out, template: LogFormatTemplateShort}
+	},
+	"json": func(out io.Writer) LogFormatter {
+		return &LogFormatterJson{Out: out}
+	},
+	"logfmt": func(out io.Writer) LogFormatter {
+		return &LogFormatterLogfmt{Out: out}
+	},
+	"csv": func(out io.Writer) LogFormatter {
+		return &LogFormatterCsv{Out: out}
+	},
+	"color": func(out io.Writer) LogFormatter {
+		return &LogFormatterColor{Out: out}
+	},
+}
+
+// RegisterLogFormatter makes a formatter available under name
+func RegisterLogFormatter(name string, newFormatter func(out io.Writer) LogFormatter) {
+	logFormatters[name] = newFormatter
+}
+
+// LogFormatterNames lists the registered formatters
+func LogFormatterNames() []string {
+	names := []string{}
+	for k := range logFormatters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewLogFormatter creates the formatter for format writing to out: the name
+// of a registered formatter, optionally followed by ':' and its argument,
+// a go template or a golang time layout for the short format with that
+// time format. An empty format is "short".
+func NewLogFormatter(format string, out io.Writer) (LogFormatter, error) {
+	if format == "" {
+		format = "short"
+	}
+
+	name, arg := format, ""
+	if i := strings.Index(format, ":"); i > 0 {
+		name, arg = format[:i], format[i+1:]
+	}
+
+	var formatter LogFormatter
+	if newFormatter, ok := logFormatters[name]; ok && !strings.Contains(format, "{{") {
+		formatter = newFormatter(out)
+	} else if strings.Contains(format, "{{") {
+		formatter = &LogFormatterTemplate{Out: out}
+		arg = format
+	} else if time.Unix(0, 0).Format(format) != format {
+		formatter = &LogFormatterTemplate{Out: out}
+		arg = strings.Replace(LogFormatTemplateShort, "\"Stamp\"", strconv.Quote(format), 1)
+	} else {
+		return nil, errors.New("unknown log format '" + format + "'; use one of " +
+			strings.Join(LogFormatterNames(), ", ") + ", a go template or a golang time layout")
+	}
+
+	if arg == "" {
+		return formatter, nil
+	}
+	err := formatter.Init(arg)
+	if err != nil {
+		return nil, err
+	}
+	return formatter, nil
+}
+
+// LogFormatterJson writes entries as json lines to Out, stderr if nil
+type LogFormatterJson struct {
+	Out io.Writer
+}
 
 func (s *LogFormatterJson) Init(format string) error {
 	return nil
@@ -40,11 +137,18 @@ func (s *LogFormatterJson) DoLog(m *logs.Entry) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(os.Stderr, string(buf))
-	return nil
+	out := s.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	_, err = fmt.Fprintln(out, string(buf))
+	return err
 }
 
+// LogFormatterTemplate writes entries formatted with a go template to Out,
+// stdout if nil
 type LogFormatterTemplate struct {
+	Out      io.Writer
 	template string
 }
 
@@ -58,6 +162,232 @@ func (s *LogFormatterTemplate) DoLog(v *logs.Entry) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(os.Stdout, r)
+	out := s.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, err = fmt.Fprintln(out, r)
+	return err
+}
+
+// logColumns are the fields of log entries logfmt and csv can write
+var logColumns = map[string]func(e *logs.Entry) string{
+	"time":     func(e *logs.Entry) string { return e.TimeCreated.Format(time.RFC3339Nano) },
+	"device":   func(e *logs.Entry) string { return e.Device[strings.LastIndex(e.Device, "/")+1:] },
+	"rev":      func(e *logs.Entry) string { return e.LogRev },
+	"platform": func(e *logs.Entry) string { return e.LogPlat },
+	"source":   func(e *logs.Entry) string { return e.LogSource },
+	"level":    func(e *logs.Entry) string { return e.LogLevel },
+	"text":     func(e *logs.Entry) string { return e.LogText },
+}
+
+var logColumnsDefault = []string{"time", "device", "rev", "platform", "source", "level", "text"}
+
+// parseLogColumns parses a comma separated list of logColumns
+func parseLogColumns(arg string) ([]string, error) {
+	columns := []string{}
+	for _, c := range strings.Split(arg, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if logColumns[c] == nil {
+			return nil, errors.New("unknown log column '" + c + "'; use any of " +
+				strings.Join(logColumnsDefault, ","))
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no log columns given")
+	}
+	return columns, nil
+}
+
+// LogFormatterLogfmt writes entries as logfmt lines, key=value pairs, to
+// Out, stdout if nil. Init selects the columns, e.g. "time,level,text".
+type LogFormatterLogfmt struct {
+	Out     io.Writer
+	columns []string
+}
+
+func (s *LogFormatterLogfmt) Init(format string) (err error) {
+	s.columns, err = parseLogColumns(format)
+	return err
+}
+
+func (s *LogFormatterLogfmt) DoLog(m *logs.Entry) error {
+	columns := s.columns
+	if columns == nil {
+		columns = logColumnsDefault
+	}
+
+	pairs := []string{}
+	for _, c := range columns {
+		v := logColumns[c](m)
+		if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+			v = strconv.Quote(v)
+		}
+		pairs = append(pairs, c+"="+v)
+	}
+
+	out := s.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, err := fmt.Fprintln(out, strings.Join(pairs, " "))
+	return err
+}
+
+// LogFormatterCsv writes entries as csv with a header line to Out, stdout
+// if nil. Init selects the columns, e.g. "time,level,text". Appending to a
+// file that has content already does not repeat the header.
+type LogFormatterCsv struct {
+	Out     io.Writer
+	columns []string
+	w       *csv.Writer
+}
+
+func (s *LogFormatterCsv) Init(format string) (err error) {
+	s.columns, err = parseLogColumns(format)
+	return err
+}
+
+func (s *LogFormatterCsv) DoLog(m *logs.Entry) error {
+	if s.columns == nil {
+		s.columns = logColumnsDefault
+	}
+	if s.w == nil {
+		out := s.Out
+		if out == nil {
+			out = os.Stdout
+		}
+		s.w = csv.NewWriter(out)
+		if !hasContent(out) {
+			err := s.w.Write(s.columns)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	record := []string{}
+	for _, c := range s.columns {
+		record = append(record, logColumns[c](m))
+	}
+	err := s.w.Write(record)
+	if err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// hasContent tells if out is a regular file that is not empty
+func hasContent(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+// isTerminal tells if out is a terminal
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// terminal colors of log levels
+var logLevelColors = map[string]string{
+	"FATAL": "\033[1;31m",
+	"ERROR": "\033[31m",
+	"WARN":  "\033[33m",
+	"INFO":  "\033[32m",
+	"DEBUG": "\033[2m",
+	"ALL":   "\033[2m",
+}
+
+// LogFormatterColor writes entries like the short format to Out, stdout if
+// nil, with the level colored if Out is a terminal. Errors stand out in red.
+type LogFormatterColor struct {
+	Out io.Writer
+}
+
+func (s *LogFormatterColor) Init(format string) error {
 	return nil
 }
+
+func (s *LogFormatterColor) DoLog(m *logs.Entry) error {
+	out := s.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	level := strings.ToUpper(m.LogLevel)
+	text := m.LogText
+	color := ""
+	if isTerminal(out) {
+		for prefix, c := range logLevelColors {
+			if strings.HasPrefix(level, prefix) {
+				color = c
+				break
+			}
+		}
+	}
+
+	level = fmt.Sprintf("%-5.5s", level)
+	if color != "" {
+		if strings.HasPrefix(level, "ERROR") || strings.HasPrefix(level, "FATAL") {
+			text = color + text + "\033[0m"
+		}
+		level = color + level + "\033[0m"
+	}
+
+	_, err := fmt.Fprintf(out, "%10.10s(%3s) %s%12s(%-15.15s) %s: %s\n",
+		m.Device[strings.LastIndex(m.Device, "/")+1:], m.LogRev,
+		m.TimeCreated.Local().Format(time.Stamp), m.LogPlat, path.Base(m.LogSource), level, text)
+	return err
+}
+
+// LogFormatterGrep passes the entries whose text matches Grep and does not
+// match GrepV, if set, on to Next
+type LogFormatterGrep struct {
+	Next  LogFormatter
+	Grep  *regexp.Regexp
+	GrepV *regexp.Regexp
+}
+
+// NewLogFormatterGrep filters the entries for next by the regular
+// expressions grep and grepV; empty ones do not filter
+func NewLogFormatterGrep(next LogFormatter, grep string, grepV string) (LogFormatter, error) {
+	var err error
+	s := LogFormatterGrep{Next: next}
+	if grep != "" {
+		s.Grep, err = regexp.Compile(grep)
+		if err != nil {
+			return nil, errors.New("invalid --grep expression: " + err.Error())
+		}
+	}
+	if grepV != "" {
+		s.GrepV, err = regexp.Compile(grepV)
+		if err != nil {
+			return nil, errors.New("invalid --grep-v expression: " + err.Error())
+		}
+	}
+	return &s, nil
+}
+
+func (s *LogFormatterGrep) Init(format string) error {
+	return s.Next.Init(format)
+}
+
+func (s *LogFormatterGrep) DoLog(m *logs.Entry) error {
+	if s.Grep != nil && !s.Grep.MatchString(m.LogText) {
+		return nil
+	}
+	if s.GrepV != nil && s.GrepV.MatchString(m.LogText) {
+		return nil
+	}
+	return s.Next.DoLog(m)
+}
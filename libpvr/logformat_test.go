@@ -0,0 +1,93 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gitlab.com/pantacor/pantahub-base/logs"
+)
+
+var testLogEntry = logs.Entry{
+	Device:      "prn:::devices:/5f1e9a0b2c3d4e5f6a7b8c9d",
+	TimeCreated: time.Date(2026, 10, 17, 9, 41, 3, 0, time.UTC),
+	LogRev:      "7",
+	LogPlat:     "pantavisor",
+	LogSource:   "/pantavisor.log",
+	LogLevel:    "ERROR",
+	LogText:     "cannot mount rootfs",
+}
+
+func ExampleNewLogFormatter() {
+	for _, format := range []string{
+		"",
+		"json",
+		"csv:time,level,text",
+		"{{ .LogLevel }}: {{ .LogText }}",
+		"2006-01-02T15:04:05",
+		"15:04:05",
+		"bogus",
+	} {
+		formatter, err := NewLogFormatter(format, nil)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%q %T\n", format, formatter)
+	}
+	// Output:
+	// "" *libpvr.LogFormatterTemplate
+	// "json" *libpvr.LogFormatterJson
+	// "csv:time,level,text" *libpvr.LogFormatterCsv
+	// "{{ .LogLevel }}: {{ .LogText }}" *libpvr.LogFormatterTemplate
+	// "2006-01-02T15:04:05" *libpvr.LogFormatterTemplate
+	// "15:04:05" *libpvr.LogFormatterTemplate
+	// unknown log format 'bogus'; use one of color, csv, json, logfmt, short, a go template or a golang time layout
+}
+
+func ExampleLogFormatterCsv() {
+	f, _ := ioutil.TempFile("", "pvr-logs-*.csv")
+	defer os.Remove(f.Name())
+
+	// the second run appends without repeating the header
+	for i := 0; i < 2; i++ {
+		formatter, _ := NewLogFormatter("csv:level,text", f)
+		formatter.DoLog(&testLogEntry)
+	}
+	f.Close()
+
+	buf, _ := ioutil.ReadFile(f.Name())
+	fmt.Print(string(buf))
+	// Output:
+	// level,text
+	// ERROR,cannot mount rootfs
+	// ERROR,cannot mount rootfs
+}
+
+func ExampleLogFormatterColor() {
+	// no colors unless writing to a terminal
+	out := bytes.Buffer{}
+	formatter, _ := NewLogFormatter("color", &out)
+	formatter.DoLog(&testLogEntry)
+	fmt.Println(bytes.Contains(out.Bytes(), []byte("\033[")))
+	// Output:
+	// false
+}
@@ -0,0 +1,756 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cjson "github.com/gibson042/canonicaljson-go"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+const (
+	// PvrConflictsFilename holds unresolved conflicts of the last merge;
+	// commits are refused while it exists
+	PvrConflictsFilename = "conflicts"
+
+	// PvrPendingMergesFilename maps merge sources to the state sha we got
+	// from them since the last commit; pvr commit records them in the
+	// revision (see PvrRevision.Merges)
+	PvrPendingMergesFilename = "merges"
+
+	// MergeStrategyConflict records conflicting changes as conflicts and
+	// keeps the local side in the state (default)
+	MergeStrategyConflict = "conflict"
+
+	// MergeStrategyOurs resolves conflicting changes to the local side
+	MergeStrategyOurs = "ours"
+
+	// MergeStrategyTheirs resolves conflicting changes to the incoming side
+	MergeStrategyTheirs = "theirs"
+)
+
+const (
+	ConflictSideBase   = "base"
+	ConflictSideOurs   = "ours"
+	ConflictSideTheirs = "theirs"
+)
+
+// PvrConflict is a conflicting change of a state key or, for inline json
+// files, of a JSON pointer inside that file. Sides that do not have the
+// key are listed in Absent, which tells them apart from a JSON null value.
+type PvrConflict struct {
+	Key     string      `json:"key"`
+	Pointer string      `json:"pointer,omitempty"`
+	Base    interface{} `json:"base"`
+	Ours    interface{} `json:"ours"`
+	Theirs  interface{} `json:"theirs"`
+	Absent  []string    `json:"absent,omitempty"`
+}
+
+// IsAbsent tells if side (ConflictSideBase, ConflictSideOurs or
+// ConflictSideTheirs) does not have the conflicting key
+func (c PvrConflict) IsAbsent(side string) bool {
+	return SliceContainsItem(c.Absent, side)
+}
+
+func (c PvrConflict) String() string {
+	if c.Pointer == "" {
+		return c.Key
+	}
+	return c.Key + " @ " + c.Pointer
+}
+
+// PvrMergeConflicts is the content of .pvr/conflicts
+type PvrMergeConflicts struct {
+	Source    string        `json:"source"`
+	Conflicts []PvrConflict `json:"conflicts"`
+}
+
+func ValidateMergeStrategy(strategy string) error {
+	switch strategy {
+	case "", MergeStrategyConflict, MergeStrategyOurs, MergeStrategyTheirs:
+		return nil
+	}
+	return errors.New("unknown merge strategy '" + strategy + "'; use one of conflict, ours or theirs")
+}
+
+// side of a three-way merge; ok is false if the side does not have the value
+type mergeSide struct {
+	v  interface{}
+	ok bool
+}
+
+func sameSide(a, b mergeSide) bool {
+	if a.ok != b.ok {
+		return false
+	}
+	if !a.ok {
+		return true
+	}
+	ab, err := cjson.Marshal(a.v)
+	if err != nil {
+		return false
+	}
+	bb, err := cjson.Marshal(b.v)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+func sideOf(m map[string]interface{}, k string) mergeSide {
+	if m == nil {
+		return mergeSide{}
+	}
+	v, ok := m[k]
+	return mergeSide{v: v, ok: ok}
+}
+
+func escapeJsonPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapeJsonPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// merge3 merges a single value. Objects changed on both sides are merged
+// recursively so conflicts get reported per JSON pointer.
+func merge3(key string, pointer string, base, ours, theirs mergeSide,
+	strategy string) (mergeSide, []PvrConflict) {
+
+	if sameSide(ours, theirs) || sameSide(base, theirs) {
+		return ours, nil
+	}
+	if sameSide(base, ours) {
+		return theirs, nil
+	}
+
+	oursMap, oursIsMap := ours.v.(map[string]interface{})
+	theirsMap, theirsIsMap := theirs.v.(map[string]interface{})
+	baseMap, baseIsMap := base.v.(map[string]interface{})
+	if ours.ok && theirs.ok && oursIsMap && theirsIsMap && (!base.ok || baseIsMap) {
+		merged := map[string]interface{}{}
+		conflicts := []PvrConflict{}
+		keys := map[string]bool{}
+		for k := range oursMap {
+			keys[k] = true
+		}
+		for k := range theirsMap {
+			keys[k] = true
+		}
+		for k := range baseMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			r, c := merge3(key, pointer+"/"+escapeJsonPointer(k),
+				sideOf(baseMap, k), sideOf(oursMap, k), sideOf(theirsMap, k), strategy)
+			if r.ok {
+				merged[k] = r.v
+			}
+			conflicts = append(conflicts, c...)
+		}
+		return mergeSide{v: merged, ok: true}, conflicts
+	}
+
+	switch strategy {
+	case MergeStrategyOurs:
+		return ours, nil
+	case MergeStrategyTheirs:
+		return theirs, nil
+	}
+
+	absent := []string{}
+	for _, s := range []struct {
+		name string
+		side mergeSide
+	}{{ConflictSideBase, base}, {ConflictSideOurs, ours}, {ConflictSideTheirs, theirs}} {
+		if !s.side.ok {
+			absent = append(absent, s.name)
+		}
+	}
+
+	return ours, []PvrConflict{{
+		Key:     key,
+		Pointer: pointer,
+		Base:    base.v,
+		Ours:    ours.v,
+		Theirs:  theirs.v,
+		Absent:  absent,
+	}}
+}
+
+// MergeState does a three-way merge of the keys in scope between base, ours
+// and theirs. Keys out of scope are taken from ours. With a nil scope all
+// keys of the three states are merged. Conflicts are resolved according to
+// strategy; with MergeStrategyConflict ours is kept and the conflict is
+// returned.
+func MergeState(base, ours, theirs map[string]interface{}, scope func(string) bool,
+	strategy string) (PvrMap, []PvrConflict) {
+
+	result := PvrMap{}
+	conflicts := []PvrConflict{}
+
+	keys := map[string]bool{}
+	for _, m := range []map[string]interface{}{base, ours, theirs} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+
+	for k := range keys {
+		o := sideOf(ours, k)
+		if scope != nil && !scope(k) {
+			if o.ok {
+				result[k] = o.v
+			}
+			continue
+		}
+		r, c := merge3(k, "", sideOf(base, k), o, sideOf(theirs, k), strategy)
+		if r.ok {
+			result[k] = r.v
+		}
+		conflicts = append(conflicts, c...)
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Key != conflicts[j].Key {
+			return conflicts[i].Key < conflicts[j].Key
+		}
+		return conflicts[i].Pointer < conflicts[j].Pointer
+	})
+
+	return result, conflicts
+}
+
+func filterByParts(m map[string]interface{}, partPrefixes []string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	result := map[string]interface{}{}
+	for k, v := range m {
+		found := true
+		for _, part := range partPrefixes {
+			if k == part {
+				found = true
+				break
+			}
+			if !strings.HasSuffix(part, "/") {
+				part += "/"
+			}
+			found = strings.HasPrefix(k, part)
+			if found {
+				break
+			}
+		}
+		if found {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// mergeIncoming merges the part filtered incoming state theirs into ours.
+// Without merge the parts selected by partPrefixes are replaced, with merge
+// theirs is merged on top of ours. If we know the state we got from this
+// source last time (base) changes on both sides are detected and handled
+// according to the merge strategy of the repo.
+func (p *Pvr) mergeIncoming(ours PvrMap, theirs map[string]interface{}, base map[string]interface{},
+	merge bool, partPrefixes []string, unpartPrefixes []string) (PvrMap, []PvrConflict) {
+
+	strategy := p.MergeStrategy
+	if strategy == "" {
+		strategy = MergeStrategyConflict
+	}
+
+	// the base covers the same parts as the incoming state
+	base = filterByParts(base, partPrefixes)
+
+	// merging drops unparts locally first so they can come back from theirs
+	if merge && len(unpartPrefixes) > 0 {
+		ours = removeParts(ours, unpartPrefixes)
+	}
+
+	var scope func(string) bool
+	if !merge {
+		replacePrefixes := partPrefixes
+		if len(replacePrefixes) == 0 {
+			replacePrefixes = []string{""}
+		}
+		scope = func(k string) bool {
+			if _, ok := theirs[k]; ok {
+				return true
+			}
+			for _, partPrefix := range replacePrefixes {
+				if strings.HasPrefix(k, partPrefix) {
+					return true
+				}
+			}
+			return false
+		}
+		// without history we replace like we always did
+		if base == nil {
+			base = map[string]interface{}{}
+			for k, v := range ours {
+				if scope(k) {
+					base[k] = v
+				}
+			}
+		}
+	} else {
+		scope = func(k string) bool {
+			_, inTheirs := theirs[k]
+			_, inBase := base[k]
+			return inTheirs || inBase
+		}
+	}
+
+	result, conflicts := MergeState(base, ours, theirs, scope, strategy)
+
+	if !merge {
+		result = removeParts(result, unpartPrefixes)
+	}
+
+	return result, conflicts
+}
+
+func removeParts(m PvrMap, unpartPrefixes []string) PvrMap {
+	result := PvrMap{}
+	for k, v := range m {
+		found := false
+		for _, unpartPrefix := range unpartPrefixes {
+			if strings.HasPrefix(k, unpartPrefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// mergeIntoState merges the incoming json of source into state and returns
+// the merged state as canonical json. sourceRepo is the repository of a local
+// source with its own history, at sourceRef; nil for all other sources. If
+// the pristine state gets updated the conflicts are returned for recording
+// with recordMerge.
+func (p *Pvr) mergeIntoState(source string, sourceRepo *Pvr, sourceRef string,
+	state *PvrMap, updatePristine bool, jsonMap map[string]interface{},
+	merge bool, partPrefixes []string, unpartPrefixes []string) ([]byte, []PvrConflict, error) {
+
+	var base map[string]interface{}
+	if updatePristine {
+		err := p.checkNoConflicts()
+		if err != nil {
+			return nil, nil, err
+		}
+		base, err = p.getMergeBase(source, sourceRepo, sourceRef)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	merged, conflicts := p.mergeIncoming(*state, jsonMap, base, merge, partPrefixes, unpartPrefixes)
+
+	jsonMerged, err := cjson.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// state might be the caller's map; refill it in place
+	for k := range *state {
+		delete(*state, k)
+	}
+	err = pvjson.Unmarshal(jsonMerged, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jsonMerged, conflicts, nil
+}
+
+// recordMerge remembers incoming as merged from source, so the next commit
+// records it in its revision, and stores the conflicts of that merge
+func (p *Pvr) recordMerge(source string, incoming []byte, conflicts []PvrConflict) error {
+	err := p.addPendingMerge(source, incoming)
+	if err != nil {
+		return err
+	}
+
+	err = p.writeConflicts(&PvrMergeConflicts{
+		Source:    mergeSourceKey(source),
+		Conflicts: conflicts,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		p.emit(PvrEvent{
+			Type:    EventMergeConflict,
+			Name:    c.Key,
+			Message: "CONFLICT: " + c.String(),
+		})
+	}
+	return nil
+}
+
+func mergeSourceKey(source string) string {
+	if i := strings.Index(source, "#"); i >= 0 {
+		return source[:i]
+	}
+	return source
+}
+
+func (p *Pvr) readPendingMerges() (map[string]string, error) {
+	merges := map[string]string{}
+	buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrPendingMergesFilename))
+	if os.IsNotExist(err) {
+		return merges, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = pvjson.Unmarshal(buf, &merges)
+	if err != nil {
+		return nil, errors.New("JSON Unmarshal (" + PvrPendingMergesFilename + "): " + err.Error())
+	}
+	return merges, nil
+}
+
+// addPendingMerge stores the full incoming state of source and remembers
+// it for the next commit
+func (p *Pvr) addPendingMerge(source string, stateJson []byte) error {
+	stateSha, err := p.SaveState(stateJson)
+	if err != nil {
+		return err
+	}
+
+	merges, err := p.readPendingMerges()
+	if err != nil {
+		return err
+	}
+	merges[mergeSourceKey(source)] = stateSha
+
+	buf, err := json.MarshalIndent(merges, "", "	")
+	if err != nil {
+		return err
+	}
+
+	mergesPath := filepath.Join(p.Pvrdir, PvrPendingMergesFilename)
+	err = ioutil.WriteFile(mergesPath+".new", buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(mergesPath+".new", mergesPath)
+}
+
+// clearPendingMerges forgets the pending merges once a revision recorded them
+func (p *Pvr) clearPendingMerges() error {
+	err := os.Remove(filepath.Join(p.Pvrdir, PvrPendingMergesFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// commonAncestor returns the newest revision of our history at HEAD that is
+// also in the history of sourceRepo at sourceRef; nil if there is none
+func (p *Pvr) commonAncestor(sourceRepo *Pvr, sourceRef string) (*PvrRevision, error) {
+	theirs, err := sourceRepo.Log(sourceRef, 0)
+	if err != nil {
+		// sources without history have no common ancestor
+		return nil, nil
+	}
+	if len(theirs) == 0 {
+		return nil, nil
+	}
+	theirShas := map[string]bool{}
+	for _, rev := range theirs {
+		theirShas[rev.Sha] = true
+	}
+
+	ours, err := p.Log("", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range ours {
+		if theirShas[rev.Sha] {
+			return rev, nil
+		}
+	}
+	return nil, nil
+}
+
+// getMergeBase computes the base for merging from source out of the revision
+// history. If we merged from source since the last commit that state is the
+// base. Otherwise a source repository sharing history with ours uses the
+// newest common revision, and all other sources the state the newest
+// revision at or before HEAD recorded as merged from source. Returns nil if
+// there is none.
+func (p *Pvr) getMergeBase(source string, sourceRepo *Pvr, sourceRef string) (map[string]interface{}, error) {
+	key := mergeSourceKey(source)
+
+	merges, err := p.readPendingMerges()
+	if err != nil {
+		return nil, err
+	}
+	stateSha, ok := merges[key]
+
+	if !ok && sourceRepo != nil {
+		rev, err := p.commonAncestor(sourceRepo, sourceRef)
+		if err != nil {
+			return nil, err
+		}
+		if rev != nil {
+			stateSha, ok = rev.StateSha, true
+		}
+	}
+
+	if !ok {
+		revs, err := p.Log("", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revs {
+			if stateSha, ok = rev.Merges[key]; ok {
+				break
+			}
+		}
+	}
+
+	if !ok {
+		return nil, nil
+	}
+	state, err := p.GetStateMap(stateSha)
+	if err != nil {
+		// history got pruned; behave like we never saw that source
+		return nil, nil
+	}
+	return state, nil
+}
+
+// GetConflicts returns the unresolved conflicts of the last merge; nil if
+// there are none
+func (p *Pvr) GetConflicts() (*PvrMergeConflicts, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrConflictsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := PvrMergeConflicts{}
+	err = pvjson.Unmarshal(buf, &conflicts)
+	if err != nil {
+		return nil, errors.New("JSON Unmarshal (" + PvrConflictsFilename + "): " + err.Error())
+	}
+	if len(conflicts.Conflicts) == 0 {
+		return nil, nil
+	}
+	return &conflicts, nil
+}
+
+func (p *Pvr) writeConflicts(conflicts *PvrMergeConflicts) error {
+	conflictsPath := filepath.Join(p.Pvrdir, PvrConflictsFilename)
+	if conflicts == nil || len(conflicts.Conflicts) == 0 {
+		err := os.Remove(conflictsPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	buf, err := json.MarshalIndent(conflicts, "", "	")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(conflictsPath+".new", buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(conflictsPath+".new", conflictsPath)
+}
+
+// checkNoConflicts fails if the last merge left unresolved conflicts
+func (p *Pvr) checkNoConflicts() error {
+	conflicts, err := p.GetConflicts()
+	if err != nil {
+		return err
+	}
+	if conflicts == nil {
+		return nil
+	}
+	keys := []string{}
+	for _, c := range conflicts.Conflicts {
+		keys = append(keys, c.String())
+	}
+	return errors.New("unresolved merge conflicts from " + conflicts.Source + ": " +
+		strings.Join(keys, ", ") + "; resolve them with pvr resolve")
+}
+
+// ResolveConflicts marks the conflicts of the given keys as resolved; no
+// keys means all. With MergeStrategyOurs or MergeStrategyTheirs the value of
+// that side is written to the working directory first, otherwise the working
+// directory is taken as the resolution.
+func (p *Pvr) ResolveConflicts(keys []string, strategy string) error {
+	conflicts, err := p.GetConflicts()
+	if err != nil {
+		return err
+	}
+	if conflicts == nil {
+		return errors.New("no merge conflicts to resolve")
+	}
+
+	remaining := []PvrConflict{}
+	resolved := 0
+	for _, c := range conflicts.Conflicts {
+		if len(keys) > 0 && !SliceContainsItem(keys, c.Key) {
+			remaining = append(remaining, c)
+			continue
+		}
+
+		switch strategy {
+		case MergeStrategyOurs:
+			err = p.writeConflictSide(c, ConflictSideOurs, c.Ours)
+		case MergeStrategyTheirs:
+			err = p.writeConflictSide(c, ConflictSideTheirs, c.Theirs)
+		}
+		if err != nil {
+			return err
+		}
+		p.emit(PvrEvent{
+			Type:    EventMergeResolved,
+			Name:    c.Key,
+			Status:  strategy,
+			Message: "Resolved " + c.String(),
+		})
+		resolved++
+	}
+
+	if resolved == 0 {
+		return errors.New("no merge conflicts for " + strings.Join(keys, ", "))
+	}
+
+	conflicts.Conflicts = remaining
+	return p.writeConflicts(conflicts)
+}
+
+// writeConflictSide puts value of side into the working directory for
+// conflict c; absent sides remove the file or member
+func (p *Pvr) writeConflictSide(c PvrConflict, side string, value interface{}) error {
+	absent := c.IsAbsent(side)
+	filePath := filepath.Join(p.Dir, filepath.FromSlash(c.Key))
+
+	if c.Pointer != "" {
+		var doc interface{}
+		buf, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		err = pvjson.Unmarshal(buf, &doc)
+		if err != nil {
+			return errors.New("JSON Unmarshal (" + c.Key + "): " + err.Error())
+		}
+		if absent {
+			err = deleteJsonPointer(doc, c.Pointer)
+		} else {
+			err = setJsonPointer(doc, c.Pointer, value)
+		}
+		if err != nil {
+			return errors.New(c.String() + ": " + err.Error())
+		}
+		value = doc
+	} else if absent {
+		err := os.Remove(filePath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	if c.Pointer == "" && !isInlineJson(c.Key, value) {
+		sha, ok := value.(string)
+		if !ok {
+			return errors.New("bad object id for file '" + c.Key + "'")
+		}
+		err = p.checkoutObject(filePath+".new", sha)
+	} else {
+		var buf []byte
+		buf, err = json.MarshalIndent(value, "", "    ")
+		if err == nil {
+			err = ioutil.WriteFile(filePath+".new", buf, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(filePath+".new", filePath)
+}
+
+// setJsonPointer sets the member pointer refers to in doc. Only objects are
+// supported, which is what merge3 descends into.
+func setJsonPointer(doc interface{}, pointer string, value interface{}) error {
+	return updateJsonPointer(doc, pointer, value, false)
+}
+
+// deleteJsonPointer removes the member pointer refers to from doc
+func deleteJsonPointer(doc interface{}, pointer string) error {
+	return updateJsonPointer(doc, pointer, nil, true)
+}
+
+func updateJsonPointer(doc interface{}, pointer string, value interface{}, remove bool) error {
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return errors.New("json pointer does not refer to an object member")
+		}
+		token = unescapeJsonPointer(token)
+		if i < len(tokens)-1 {
+			next, ok := m[token]
+			if !ok {
+				next = map[string]interface{}{}
+				m[token] = next
+			}
+			doc = next
+			continue
+		}
+		if remove {
+			delete(m, token)
+		} else {
+			m[token] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+)
+
+func ExampleMergeState() {
+	base := map[string]interface{}{
+		"bsp/run.json":      map[string]interface{}{"initrd": "a", "linux": "a"},
+		"app/root.squashfs": "1111",
+	}
+	ours := map[string]interface{}{
+		"bsp/run.json":      map[string]interface{}{"initrd": "b", "linux": "a"},
+		"app/root.squashfs": "2222",
+	}
+	theirs := map[string]interface{}{
+		"bsp/run.json":      map[string]interface{}{"initrd": "c", "linux": "c"},
+		"app/root.squashfs": "1111",
+	}
+
+	merged, conflicts := MergeState(base, ours, theirs, nil, MergeStrategyConflict)
+	fmt.Println(merged["app/root.squashfs"], merged["bsp/run.json"])
+	for _, c := range conflicts {
+		fmt.Println(c, c.Ours, c.Theirs)
+	}
+	// Output:
+	// 2222 map[initrd:b linux:c]
+	// bsp/run.json @ /initrd b c
+}
@@ -0,0 +1,333 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// ObjectStore keeps the content addressed objects of a repository by their
+// sha256
+type ObjectStore interface {
+	// Has reports whether object sha is in the store
+	Has(sha string) (bool, error)
+
+	// Size returns the size of object sha without fetching it
+	Size(sha string) (int64, error)
+
+	// Get opens object sha and returns its size
+	Get(sha string) (io.ReadCloser, int64, error)
+
+	// Put stores the content of r as object sha; content that does not
+	// match sha is rejected
+	Put(sha string, r io.Reader) error
+
+	// List returns the shas of all objects in the store
+	List() ([]string, error)
+
+	// Delete removes object sha
+	Delete(sha string) error
+
+	String() string
+}
+
+// NewObjectStore opens the object store at location: s3://<host>/<bucket>[/<prefix>]
+// (s3+http:// for plain http) for an S3 compatible storage like MinIO,
+// otherwise location is an objects directory
+func NewObjectStore(location string) (ObjectStore, error) {
+	if IsObjectStoreUrl(location) {
+		return NewS3ObjectStore(location)
+	}
+	return NewLocalObjectStore(location), nil
+}
+
+// IsObjectStoreUrl reports whether location refers to a remote object store
+// rather than a directory
+func IsObjectStoreUrl(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "s3+http://")
+}
+
+// LocalObjectStore is an object store in a directory of the local
+// filesystem; objects are files named by their sha
+type LocalObjectStore struct {
+	Dir string
+}
+
+// NewLocalObjectStore returns the object store in dir
+func NewLocalObjectStore(dir string) *LocalObjectStore {
+	return &LocalObjectStore{Dir: dir}
+}
+
+// Path is the file of object sha; working copies can hardlink it
+func (l *LocalObjectStore) Path(sha string) string {
+	return filepath.Join(l.Dir, sha)
+}
+
+func (l *LocalObjectStore) Has(sha string) (bool, error) {
+	info, err := os.Stat(l.Path(sha))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+func (l *LocalObjectStore) Size(sha string) (int64, error) {
+	info, err := os.Stat(l.Path(sha))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *LocalObjectStore) Get(sha string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(l.Path(sha))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (l *LocalObjectStore) Put(sha string, r io.Reader) error {
+	err := os.MkdirAll(l.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	newPath := l.Path(sha) + ".new"
+	out, err := os.Create(newPath)
+	if err != nil {
+		return err
+	}
+
+	// a verifying reader of the same sha fails the copy on mismatch
+	// already; do not hash the content twice
+	var sum hash.Hash
+	w := io.Writer(out)
+	if v, ok := r.(*shaVerifyingReader); !ok || v.sha != sha {
+		sum = sha256.New()
+		w = io.MultiWriter(out, sum)
+	}
+
+	_, err = io.Copy(w, r)
+	cerr := out.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil && sum != nil && hex.EncodeToString(sum.Sum(nil)) != sha {
+		err = errors.New("content does not match object " + sha)
+	}
+	if err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	return os.Rename(newPath, l.Path(sha))
+}
+
+func (l *LocalObjectStore) List() ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shas := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && IsSha(e.Name()) {
+			shas = append(shas, e.Name())
+		}
+	}
+	sort.Strings(shas)
+	return shas, nil
+}
+
+func (l *LocalObjectStore) Delete(sha string) error {
+	return os.Remove(l.Path(sha))
+}
+
+func (l *LocalObjectStore) String() string {
+	return l.Dir
+}
+
+// putObjectFile stores the file at filePath as object sha unless the store
+// has it already
+func putObjectFile(store ObjectStore, sha string, filePath string) error {
+	has, err := store.Has(sha)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// sha might come from a stale stat index; never trust it, not even
+	// when the store has the object already
+	v := &shaVerifyingReader{
+		r:    f,
+		hash: sha256.New(),
+		sha:  sha,
+		name: filePath,
+	}
+	if has {
+		_, err = io.Copy(ioutil.Discard, v)
+		return err
+	}
+	return store.Put(sha, v)
+}
+
+// shaVerifyingReader hashes what is read through it and fails at the end of
+// the stream if the content does not match sha
+type shaVerifyingReader struct {
+	r    *os.File
+	hash hash.Hash
+	sha  string
+	name string
+}
+
+// Stat is the info of the file read, so stores that need the length
+// upfront do not have to spool it
+func (v *shaVerifyingReader) Stat() (os.FileInfo, error) {
+	return v.r.Stat()
+}
+
+func (v *shaVerifyingReader) Read(b []byte) (int, error) {
+	n, err := v.r.Read(b)
+	v.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(v.hash.Sum(nil)) != v.sha {
+		return n, errors.New(v.name + " changed while committing (expected " + v.sha + "); run the command again")
+	}
+	return n, err
+}
+
+// copyObject copies object sha from src to dst unless dst has it already
+func copyObject(dst ObjectStore, src ObjectStore, sha string) error {
+	has, err := dst.Has(sha)
+	if err != nil || has {
+		return err
+	}
+
+	r, _, err := src.Get(sha)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return dst.Put(sha, r)
+}
+
+// objectStoreAt opens the store configured with location relative to the
+// .pvr dir pvrDir, like ObjectsDir in .pvr/config
+func objectStoreAt(pvrDir string, location string) (ObjectStore, error) {
+	if !IsObjectStoreUrl(location) && !filepath.IsAbs(location) {
+		location = filepath.Join(pvrDir, "..", location)
+	}
+	return NewObjectStore(location)
+}
+
+// isLocalObjects reports whether the objects of p are the files in Objdir;
+// with remote object stores Objdir only stages objects for transfers
+func (p *Pvr) isLocalObjects() bool {
+	_, ok := p.Objects.(*LocalObjectStore)
+	return ok
+}
+
+// objectFile returns a local file with the content of object sha, fetching
+// it from a remote object store into Objdir if needed
+func (p *Pvr) objectFile(sha string) (string, error) {
+	objPath := filepath.Join(p.Objdir, sha)
+	if p.isLocalObjects() {
+		return objPath, nil
+	}
+
+	_, err := os.Stat(objPath)
+	if err == nil {
+		return objPath, nil
+	}
+
+	err = copyObject(NewLocalObjectStore(p.Objdir), p.Objects, sha)
+	if err != nil {
+		return "", errors.New("cannot fetch object " + sha + " from " + p.Objects.String() + ": " + err.Error())
+	}
+	return objPath, nil
+}
+
+// storeObjectFile moves object sha downloaded to Objdir into a remote
+// object store; the file stays as local copy
+func (p *Pvr) storeObjectFile(sha string) error {
+	if p.isLocalObjects() {
+		return nil
+	}
+	return putObjectFile(p.Objects, sha, filepath.Join(p.Objdir, sha))
+}
+
+// setObjectStore makes location the object store of p
+func (p *Pvr) setObjectStore(location string) error {
+	store, err := objectStoreAt(p.Pvrdir, location)
+	if err != nil {
+		return err
+	}
+	p.Objects = store
+	if local, ok := store.(*LocalObjectStore); ok {
+		p.Objdir = local.Dir
+	} else {
+		p.Objdir = filepath.Join(p.Pvrdir, "objects")
+	}
+	return nil
+}
+
+// bareRepoObjectStore opens the objects of the repository at repoPath (a
+// .pvr directory); its config can point ObjectsDir elsewhere
+func bareRepoObjectStore(repoPath string) (ObjectStore, error) {
+	config := PvrConfig{}
+	configData, err := ioutil.ReadFile(filepath.Join(repoPath, "config"))
+	// keep default config if there is no config file yet
+	if err == nil {
+		err = pvjson.Unmarshal(configData, &config)
+		if err != nil {
+			return nil, errors.New("JSON Unmarshal (config):" + err.Error())
+		}
+	}
+
+	if config.ObjectsDir == "" {
+		return NewLocalObjectStore(filepath.Join(repoPath, "objects")), nil
+	}
+	return objectStoreAt(repoPath, config.ObjectsDir)
+}
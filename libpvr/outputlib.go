@@ -0,0 +1,99 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputFormatTable = "table"
+	OutputFormatJson  = "json"
+	OutputFormatYaml  = "yaml"
+)
+
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case "", OutputFormatTable, OutputFormatJson, OutputFormatYaml:
+		return nil
+	}
+	return errors.New("unknown output format '" + format + "'; use one of table, json or yaml")
+}
+
+// PrintOutput prints v in format on stdout. The table format is the
+// human readable output of each command and is rendered by table.
+// json and yaml use the json field names of v.
+func PrintOutput(format string, v interface{}, table func() error) error {
+	switch format {
+	case "", OutputFormatTable:
+		return table()
+	case OutputFormatJson:
+		buf, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(buf))
+		return nil
+	case OutputFormatYaml:
+		// go through json so yaml honours the json tags
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+		if err != nil {
+			return err
+		}
+		buf, err = yaml.Marshal(yamlNumbers(doc))
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(buf))
+		return nil
+	}
+	return ValidateOutputFormat(format)
+}
+
+// yamlNumbers turns the json.Number values of a document decoded with
+// UseNumber into int64 or float64 so yaml prints integers as integers
+func yamlNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = yamlNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = yamlNumbers(e)
+		}
+	}
+	return v
+}
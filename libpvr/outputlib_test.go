@@ -0,0 +1,35 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+func ExamplePrintOutput() {
+	v := struct {
+		Name  string  `json:"name"`
+		Size  int64   `json:"size"`
+		Ratio float64 `json:"ratio"`
+		Parts []int   `json:"parts"`
+	}{"bsp/kernel.img", 1048576, 0.5, []int{1, 2}}
+
+	PrintOutput(OutputFormatYaml, v, nil)
+	// Output:
+	// name: bsp/kernel.img
+	// parts:
+	// - 1
+	// - 2
+	// ratio: 0.5
+	// size: 1048576
+}
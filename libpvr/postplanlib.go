@@ -0,0 +1,131 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	jsonpatch "github.com/asac/json-patch"
+	cjson "github.com/gibson042/canonicaljson-go"
+)
+
+// PvrPostObject is an object of a post plan
+type PvrPostObject struct {
+	Name string `json:"name"`
+	Sha  string `json:"sha"`
+	Size int64  `json:"size"`
+}
+
+// PvrPostPlan tells what Post would do: the JSON merge patch from the
+// current state of the remote to the local state, the objects that would
+// be posted and those skipped as the remote state has them already. The
+// remote might know some posted objects from other states and not need
+// their upload; DownloadBytes counts them anyway as the device has to
+// fetch them.
+type PvrPostPlan struct {
+	Url           string          `json:"url"`
+	Patch         json.RawMessage `json:"patch"`
+	Upload        []PvrPostObject `json:"upload"`
+	Skip          []PvrPostObject `json:"skip"`
+	DownloadBytes int64           `json:"download-bytes"`
+}
+
+// PostPlan computes what Post to uri would do without uploading or
+// changing anything
+func (p *Pvr) PostPlan(uri string) (*PvrPostPlan, error) {
+	_, url, _, err := p.postUrl(uri)
+	if err != nil {
+		return nil, err
+	}
+	plan := PvrPostPlan{
+		Url:    url.String(),
+		Upload: []PvrPostObject{},
+		Skip:   []PvrPostObject{},
+	}
+
+	remotePvr, err := p.initializeRemote(url)
+	if err != nil {
+		return nil, err
+	}
+
+	baselineState, err := p.postBaseline(remotePvr)
+	if err != nil {
+		return nil, err
+	}
+
+	baselineJson, err := cjson.Marshal(baselineState)
+	if err != nil {
+		return nil, err
+	}
+	localJson, err := cjson.Marshal(p.PristineJsonMap)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(baselineJson, localJson)
+	if err != nil {
+		return nil, err
+	}
+	plan.Patch = patch
+
+	baselineFilesAndObjects, err := listFilesAndObjectsFromJson(baselineState, []string{})
+	if err != nil {
+		return nil, err
+	}
+	refObjects := map[string]bool{}
+	for _, v := range baselineFilesAndObjects {
+		refObjects[v] = true
+	}
+
+	filesAndObjects, err := p.listFilesAndObjects([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for k := range filesAndObjects {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	shaSeen := map[string]bool{}
+	for _, k := range names {
+		sha := filesAndObjects[k]
+		object := PvrPostObject{Name: k, Sha: sha}
+
+		if refObjects[sha] {
+			plan.Skip = append(plan.Skip, object)
+			continue
+		}
+
+		// ask the store; remote stores would have to download objects
+		// to stat them
+		object.Size, err = p.Objects.Size(sha)
+		if err != nil {
+			return nil, errors.New("cannot get size of object " + sha + ": " + err.Error())
+		}
+		plan.Upload = append(plan.Upload, object)
+
+		if !shaSeen[sha] {
+			shaSeen[sha] = true
+			plan.DownloadBytes += object.Size
+		}
+	}
+
+	return &plan, nil
+}
@@ -0,0 +1,115 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// PsDeviceDoc is the document of a device summary that ps filters match
+// against: the fields of PantahubDevice under their json names and the
+// column names of pvr ps
+func PsDeviceDoc(d PantahubDevice) (map[string]interface{}, error) {
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	err = json.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	doc["id"] = d.Id
+	doc["nick"] = d.Nick
+	doc["rev"] = d.ProgressRevision
+	doc["state"] = d.StateSha
+	doc["seen"] = d.Timestamp
+	doc["ip"] = d.RealIP
+	doc["message"] = d.StatusMsg
+	return doc, nil
+}
+
+// FilterDevices returns the devices matching selector
+func FilterDevices(devices []PantahubDevice, selector DeviceSelector) ([]PantahubDevice, error) {
+	result := []PantahubDevice{}
+	for _, d := range devices {
+		doc, err := PsDeviceDoc(d)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Matches(doc) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+// psSortKeys compare two devices by a ps column
+var psSortKeys = map[string]func(a, b *PantahubDevice) bool{
+	"id":        func(a, b *PantahubDevice) bool { return a.Id < b.Id },
+	"nick":      func(a, b *PantahubDevice) bool { return a.Nick < b.Nick },
+	"rev":       func(a, b *PantahubDevice) bool { return a.ProgressRevision < b.ProgressRevision },
+	"revision":  func(a, b *PantahubDevice) bool { return a.Revision < b.Revision },
+	"status":    func(a, b *PantahubDevice) bool { return a.Status < b.Status },
+	"state":     func(a, b *PantahubDevice) bool { return a.StateSha < b.StateSha },
+	"timestamp": func(a, b *PantahubDevice) bool { return a.Timestamp.Before(b.Timestamp) },
+	"ip":        func(a, b *PantahubDevice) bool { return a.RealIP < b.RealIP },
+	"message":   func(a, b *PantahubDevice) bool { return a.StatusMsg < b.StatusMsg },
+}
+
+// PsSortKeys lists the keys SortDevices accepts
+func PsSortKeys() []string {
+	keys := []string{}
+	for k := range psSortKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SortDevices sorts devices by key, one of PsSortKeys; a leading '-'
+// sorts descending
+func SortDevices(devices []PantahubDevice, key string) error {
+	desc := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	if key == "seen" {
+		key = "timestamp"
+	}
+
+	less, ok := psSortKeys[key]
+	if !ok {
+		return errors.New("cannot sort by '" + key + "', use one of: " + strings.Join(PsSortKeys(), ", "))
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		if desc {
+			return less(&devices[j], &devices[i])
+		}
+		return less(&devices[i], &devices[j])
+	})
+	return nil
+}
+
+// PsNeedsAttention tells if a device did not pick up its latest revision
+// yet or reports an error
+func PsNeedsAttention(d PantahubDevice) bool {
+	return d.ProgressRevision != d.Revision || d.Status == StepStatusError
+}
@@ -0,0 +1,376 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	cjson "github.com/gibson042/canonicaljson-go"
+)
+
+const (
+	// PvrRefsDir holds named references to revisions of the local history
+	PvrRefsDir = "refs"
+
+	// PvrBranchesDir is the refs subdirectory for branches
+	PvrBranchesDir = "heads"
+
+	// PvrTagsDir is the refs subdirectory for tags
+	PvrTagsDir = "tags"
+
+	// PvrDefaultBranch is the branch of repositories that have no HEAD yet
+	PvrDefaultBranch = "main"
+
+	symbolicRefPrefix = "ref: "
+)
+
+var refNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/-]*$`)
+
+// PvrRef is a branch or tag pointing at a revision
+type PvrRef struct {
+	Name    string `json:"name"`
+	Sha     string `json:"sha"`
+	IsTag   bool   `json:"tag,omitempty"`
+	Current bool   `json:"current,omitempty"`
+}
+
+// bareRepo gives access to the history of a repository directory that is
+// not a working copy, e.g. the .pvr dir of another checkout or the target
+// of pvr put
+func bareRepo(dir string) *Pvr {
+	return &Pvr{Pvrdir: dir}
+}
+
+// SplitRefSuffix splits a trailing @<ref> from a local repository path
+// (e.g. ../product/.pvr@v1.2.0#bsp). A #fragment stays with the path.
+func SplitRefSuffix(repoPath string) (string, string) {
+	fragment := ""
+	if i := strings.Index(repoPath, "#"); i >= 0 {
+		fragment = repoPath[i:]
+		repoPath = repoPath[:i]
+	}
+
+	i := strings.LastIndex(repoPath, "@")
+	if i <= 0 || i == len(repoPath)-1 || strings.ContainsAny(repoPath[i+1:], "/\\") {
+		return repoPath + fragment, ""
+	}
+
+	return repoPath[:i] + fragment, repoPath[i+1:]
+}
+
+func validateRefName(name string) error {
+	if !refNameRegexp.MatchString(name) ||
+		strings.Contains(name, "..") ||
+		strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".new") ||
+		name == PvrHeadFilename {
+		return errors.New("invalid ref name: " + name)
+	}
+	return nil
+}
+
+func (p *Pvr) refPath(kind string, name string) string {
+	return filepath.Join(p.Pvrdir, PvrRefsDir, kind, filepath.FromSlash(name))
+}
+
+// readRef returns the revision sha a ref points to or empty string if the
+// ref does not exist
+func (p *Pvr) readRef(kind string, name string) (string, error) {
+	if validateRefName(name) != nil {
+		return "", nil
+	}
+	buf, err := ioutil.ReadFile(p.refPath(kind, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+func (p *Pvr) writeRef(kind string, name string, sha string) error {
+	err := validateRefName(name)
+	if err != nil {
+		return err
+	}
+
+	refPath := p.refPath(kind, name)
+	err = os.MkdirAll(filepath.Dir(refPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(refPath+".new", []byte(sha+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(refPath+".new", refPath)
+}
+
+func (p *Pvr) listRefs(kind string) ([]PvrRef, error) {
+	refs := []PvrRef{}
+	dir := filepath.Join(p.Pvrdir, PvrRefsDir, kind)
+
+	err := filepath.Walk(dir, func(walkPath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(walkPath, ".new") {
+			return nil
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(walkPath, dir+string(filepath.Separator)))
+		sha, err := p.readRef(kind, name)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, PvrRef{
+			Name:  name,
+			Sha:   sha,
+			IsTag: kind == PvrTagsDir,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// CurrentBranch returns the branch HEAD refers to; empty if HEAD is detached
+func (p *Pvr) CurrentBranch() (string, error) {
+	branch, _, err := p.readHead()
+	return branch, err
+}
+
+// ListBranches returns all local branches with the current one marked
+func (p *Pvr) ListBranches() ([]PvrRef, error) {
+	refs, err := p.listRefs(PvrBranchesDir)
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	for i := range refs {
+		refs[i].Current = refs[i].Name == current
+	}
+	return refs, nil
+}
+
+// ListTags returns all local tags
+func (p *Pvr) ListTags() ([]PvrRef, error) {
+	return p.listRefs(PvrTagsDir)
+}
+
+func (p *Pvr) createRef(kind string, name string, target string, force bool) error {
+	err := validateRefName(name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.readRef(kind, name)
+	if err != nil {
+		return err
+	}
+	if existing != "" && !force {
+		return errors.New(name + " already exists; use --force to move it")
+	}
+
+	if target == "" {
+		target = PvrHeadFilename
+	}
+	sha, err := p.ResolveRevision(target)
+	if err != nil {
+		return err
+	}
+
+	return p.writeRef(kind, name, sha)
+}
+
+// CreateBranch creates branch name at revision target (default: HEAD)
+func (p *Pvr) CreateBranch(name string, target string, force bool) error {
+	current, err := p.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if force && current == name {
+		return errors.New("cannot move the current branch " + name + "; use pvr checkout instead")
+	}
+	return p.createRef(PvrBranchesDir, name, target, force)
+}
+
+// CreateTag creates tag name at revision target (default: HEAD)
+func (p *Pvr) CreateTag(name string, target string, force bool) error {
+	return p.createRef(PvrTagsDir, name, target, force)
+}
+
+// DeleteBranch removes a branch; the current branch cannot be deleted
+func (p *Pvr) DeleteBranch(name string) error {
+	current, err := p.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if current == name {
+		return errors.New("cannot delete the current branch " + name)
+	}
+	return p.deleteRef(PvrBranchesDir, name)
+}
+
+// DeleteTag removes a tag
+func (p *Pvr) DeleteTag(name string) error {
+	return p.deleteRef(PvrTagsDir, name)
+}
+
+func (p *Pvr) deleteRef(kind string, name string) error {
+	sha, err := p.readRef(kind, name)
+	if err != nil {
+		return err
+	}
+	if sha == "" {
+		return errors.New("no such ref: " + name)
+	}
+	return os.Remove(p.refPath(kind, name))
+}
+
+// Switch makes branch the current branch and resets the pristine state as
+// well as the working directory to the revision it points to
+func (p *Pvr) Switch(branch string, hardlink bool, canonicalJson bool, force bool) error {
+	sha, err := p.readRef(PvrBranchesDir, branch)
+	if err != nil {
+		return err
+	}
+	if sha == "" {
+		return errors.New("no such branch: " + branch)
+	}
+
+	rev, err := p.GetRevision(sha)
+	if err != nil {
+		return err
+	}
+
+	return p.checkoutState(rev.StateSha, hardlink, canonicalJson, force, func() error {
+		return p.writeHead(symbolicRefPrefix + PvrRefsDir + "/" + PvrBranchesDir + "/" + branch)
+	})
+}
+
+// GetRefState returns the state json of the revision ref resolves to
+func (p *Pvr) GetRefState(ref string) ([]byte, error) {
+	sha, err := p.ResolveRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := p.GetRevision(sha)
+	if err != nil {
+		return nil, err
+	}
+	return p.GetState(rev.StateSha)
+}
+
+// copyHistory copies revision sha and all its ancestors together with their
+// states into the history of dst
+func (p *Pvr) copyHistory(dst *Pvr, sha string) error {
+	for sha != "" {
+		dstRevPath := filepath.Join(dst.Pvrdir, PvrRevisionsDir, sha)
+		if _, err := os.Stat(dstRevPath); err == nil {
+			break
+		}
+
+		rev, err := p.GetRevision(sha)
+		if err != nil {
+			return err
+		}
+
+		state, err := p.GetState(rev.StateSha)
+		if err != nil {
+			return err
+		}
+		err = writeContentAddressed(filepath.Join(dst.Pvrdir, PvrStatesDir, rev.StateSha), state)
+		if err != nil {
+			return err
+		}
+
+		buf, err := ioutil.ReadFile(filepath.Join(p.Pvrdir, PvrRevisionsDir, sha))
+		if err != nil {
+			return err
+		}
+		err = writeContentAddressed(dstRevPath, buf)
+		if err != nil {
+			return err
+		}
+
+		sha = rev.Parent
+	}
+	return nil
+}
+
+// putLocalRef publishes HEAD as ref in the local repository at repoPath.
+// An existing tag of that name gets moved only with force; otherwise the
+// ref is a branch.
+func (p *Pvr) putLocalRef(repoPath string, ref string, force bool) error {
+	head, err := p.GetHead()
+	if err != nil {
+		return err
+	}
+	if head == "" {
+		return errors.New("no revision to put as " + ref + "; use pvr commit first")
+	}
+
+	rev, err := p.GetRevision(head)
+	if err != nil {
+		return err
+	}
+
+	pristine, err := cjson.Marshal(p.PristineJsonMap)
+	if err != nil {
+		return err
+	}
+	if bytesToSha(pristine) != rev.StateSha {
+		return errors.New("repository state differs from HEAD revision; use pvr commit first")
+	}
+
+	dst := bareRepo(repoPath)
+	err = p.copyHistory(dst, head)
+	if err != nil {
+		return err
+	}
+
+	tagSha, err := dst.readRef(PvrTagsDir, ref)
+	if err != nil {
+		return err
+	}
+	if tagSha != "" {
+		if tagSha != head && !force {
+			return errors.New("tag " + ref + " already exists in " + repoPath + "; use --force to move it")
+		}
+		return dst.writeRef(PvrTagsDir, ref, head)
+	}
+
+	return dst.writeRef(PvrBranchesDir, ref, head)
+}
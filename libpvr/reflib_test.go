@@ -0,0 +1,38 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+)
+
+func ExampleSplitRefSuffix() {
+	for _, v := range []string{
+		"../product/.pvr@v1.2.0",
+		"../product/.pvr@variant-b#bsp,app",
+		"../product/.pvr",
+		"../user@host/.pvr",
+	} {
+		repoPath, ref := SplitRefSuffix(v)
+		fmt.Printf("%q %q\n", repoPath, ref)
+	}
+	// Output:
+	// "../product/.pvr" "v1.2.0"
+	// "../product/.pvr#bsp,app" "variant-b"
+	// "../product/.pvr" ""
+	// "../user@host/.pvr" ""
+}
@@ -0,0 +1,372 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// PvrDefaultRemote is the remote used by get, put and post without
+	// arguments; the first repository a working copy talks to becomes it
+	PvrDefaultRemote = "origin"
+
+	remoteGet  = "get"
+	remotePut  = "put"
+	remotePost = "post"
+)
+
+var remoteNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// PvrRemoteConfig is a named remote in .pvr/config
+type PvrRemoteConfig struct {
+	Url string `json:"url"`
+
+	// PutUrl and PostUrl replace Url for pvr put and pvr post
+	PutUrl  string `json:"put-url,omitempty"`
+	PostUrl string `json:"post-url,omitempty"`
+
+	// AuthEndpoint and AuthRealm pick the login (see pvr whoami) whose
+	// access token is sent to this remote
+	AuthEndpoint string `json:"auth-endpoint,omitempty"`
+	AuthRealm    string `json:"auth-realm,omitempty"`
+
+	// Proxy is 'system', 'no' or a proxy url, like --http-proxy
+	Proxy string `json:"proxy,omitempty"`
+
+	// Insecure skips tls verification; CaCert is a pem file with
+	// additional certificates to trust
+	Insecure bool   `json:"insecure,omitempty"`
+	CaCert   string `json:"ca-cert,omitempty"`
+}
+
+// PvrNamedRemote is a remote together with its name as listed by
+// ListRemotes
+type PvrNamedRemote struct {
+	Name string `json:"name"`
+	PvrRemoteConfig
+}
+
+func (r *PvrRemoteConfig) urlFor(verb string) string {
+	switch {
+	case verb == remotePut && r.PutUrl != "":
+		return r.PutUrl
+	case verb == remotePost && r.PostUrl != "":
+		return r.PostUrl
+	}
+	return r.Url
+}
+
+// migrateRemotes turns the Default*Url of configs written by older pvr
+// versions into the default remote
+func (c *PvrConfig) migrateRemotes() {
+	if c.Remotes == nil {
+		c.Remotes = map[string]*PvrRemoteConfig{}
+	}
+
+	if c.DefaultGetUrl == "" && c.DefaultPutUrl == "" && c.DefaultPostUrl == "" {
+		return
+	}
+
+	if c.Remotes[PvrDefaultRemote] == nil {
+		remote := &PvrRemoteConfig{Url: c.DefaultGetUrl}
+		if remote.Url == "" {
+			remote.Url = c.DefaultPutUrl
+		}
+		if remote.Url == "" {
+			remote.Url = c.DefaultPostUrl
+		}
+		if c.DefaultPutUrl != remote.Url {
+			remote.PutUrl = c.DefaultPutUrl
+		}
+		if c.DefaultPostUrl != remote.Url {
+			remote.PostUrl = c.DefaultPostUrl
+		}
+		c.Remotes[PvrDefaultRemote] = remote
+	}
+
+	c.DefaultGetUrl = ""
+	c.DefaultPutUrl = ""
+	c.DefaultPostUrl = ""
+}
+
+func validateRemote(remote *PvrRemoteConfig) error {
+	if remote.Url == "" {
+		return errors.New("remote needs an url")
+	}
+
+	if remote.Proxy != "" && remote.Proxy != "system" && remote.Proxy != "no" {
+		_, err := url.Parse(remote.Proxy)
+		if err != nil {
+			return errors.New("proxy is not a valid url: " + err.Error())
+		}
+	}
+
+	if remote.CaCert != "" {
+		_, err := ioutil.ReadFile(remote.CaCert)
+		if err != nil {
+			return errors.New("cannot read ca certificate: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// AddRemote stores remote under name; an existing remote with that name
+// is only replaced with force
+func (p *Pvr) AddRemote(name string, remote PvrRemoteConfig, force bool) error {
+	if !remoteNameRegexp.MatchString(name) {
+		return errors.New("invalid remote name: " + name)
+	}
+
+	err := validateRemote(&remote)
+	if err != nil {
+		return err
+	}
+
+	if p.Pvrconfig.Remotes == nil {
+		p.Pvrconfig.Remotes = map[string]*PvrRemoteConfig{}
+	}
+	if p.Pvrconfig.Remotes[name] != nil && !force {
+		return errors.New("remote " + name + " already exists")
+	}
+
+	p.Pvrconfig.Remotes[name] = &remote
+	return p.SaveConfig()
+}
+
+// RemoveRemote deletes the remote name
+func (p *Pvr) RemoveRemote(name string) error {
+	if p.Pvrconfig.Remotes[name] == nil {
+		return errors.New("no such remote: " + name)
+	}
+
+	delete(p.Pvrconfig.Remotes, name)
+	return p.SaveConfig()
+}
+
+// ListRemotes returns all remotes sorted by name
+func (p *Pvr) ListRemotes() []PvrNamedRemote {
+	result := []PvrNamedRemote{}
+	for name, remote := range p.Pvrconfig.Remotes {
+		result = append(result, PvrNamedRemote{Name: name, PvrRemoteConfig: *remote})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetRemote returns the remote called name; nil if there is none
+func (p *Pvr) GetRemote(name string) *PvrRemoteConfig {
+	return p.Pvrconfig.Remotes[name]
+}
+
+// resolveRemote turns a remote name (with optional #parts) into the url
+// to use for verb and applies the settings of the remote; an empty uri
+// refers to the default remote. Other uris are returned unchanged.
+func (p *Pvr) resolveRemote(uri string, verb string) (resolved string, isRemote bool, err error) {
+	name := uri
+	fragment := ""
+	if i := strings.Index(uri, "#"); i >= 0 {
+		name = uri[:i]
+		fragment = uri[i:]
+	}
+	if name == "" && fragment == "" {
+		name = PvrDefaultRemote
+	}
+
+	remote := p.Pvrconfig.Remotes[name]
+	if remote == nil {
+		return uri, false, nil
+	}
+
+	resolved = remote.urlFor(verb)
+	if fragment != "" {
+		if i := strings.Index(resolved, "#"); i >= 0 {
+			resolved = resolved[:i]
+		}
+		resolved += fragment
+	}
+
+	err = p.applyRemoteSettings(remote)
+	if err != nil {
+		return "", true, err
+	}
+
+	return resolved, true, nil
+}
+
+// rememberRemote makes uri the default remote unless there is one already
+func (p *Pvr) rememberRemote(uri string) {
+	if uri == "" || p.Pvrconfig.Remotes[PvrDefaultRemote] != nil {
+		return
+	}
+	if p.Pvrconfig.Remotes == nil {
+		p.Pvrconfig.Remotes = map[string]*PvrRemoteConfig{}
+	}
+	p.Pvrconfig.Remotes[PvrDefaultRemote] = &PvrRemoteConfig{Url: uri}
+}
+
+// FixupRepoRef resolves remote names of this repository before falling
+// back to the package level FixupRepoRef for urls, paths, IPs and
+// <user-nick>/<device-nick> refs
+func (p *Pvr) FixupRepoRef(repoUri string) (string, error) {
+	return p.fixupRepoRef(repoUri, remoteGet)
+}
+
+// FixupPostRepoRef is FixupRepoRef for repositories that get posted to; a
+// remote name resolves to its post url
+func (p *Pvr) FixupPostRepoRef(repoUri string) (string, error) {
+	return p.fixupRepoRef(repoUri, remotePost)
+}
+
+func (p *Pvr) fixupRepoRef(repoUri string, verb string) (string, error) {
+	resolved, isRemote, err := p.resolveRemote(repoUri, verb)
+	if err != nil {
+		return "", err
+	}
+	if isRemote {
+		return resolved, nil
+	}
+	return FixupRepoRef(repoUri)
+}
+
+// RemoteTransport sends requests to the hosts of the remotes resolved so
+// far through a transport with the proxy and tls settings of that remote;
+// all other requests go through Base (http.DefaultTransport if nil)
+type RemoteTransport struct {
+	Base http.RoundTripper
+
+	mu    sync.RWMutex
+	hosts map[string]http.RoundTripper
+}
+
+// DefaultRemoteTransport is the transport pvr routes all http requests
+// through
+var DefaultRemoteTransport = &RemoteTransport{}
+
+// DefaultRemoteClient is the http client for requests to remotes outside of
+// resty, like object uploads to put urls
+var DefaultRemoteClient = &http.Client{Transport: DefaultRemoteTransport}
+
+func (t *RemoteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	rt := t.hosts[req.URL.Host]
+	t.mu.RUnlock()
+	if rt == nil {
+		rt = t.Base
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return rt.RoundTrip(req)
+}
+
+// route makes requests to host go through rt
+func (t *RemoteTransport) route(host string, rt http.RoundTripper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts == nil {
+		t.hosts = map[string]http.RoundTripper{}
+	}
+	t.hosts[host] = rt
+}
+
+// newRemoteTransport builds the transport for the proxy and tls settings of
+// remote on top of a copy of the default transport
+func newRemoteTransport(remote *PvrRemoteConfig) (*http.Transport, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("cannot apply remote settings to custom http transport")
+	}
+	transport := base.Clone()
+
+	switch remote.Proxy {
+	case "":
+	case "system":
+		transport.Proxy = http.ProxyFromEnvironment
+	case "no":
+		transport.Proxy = nil
+	default:
+		u, err := url.Parse(remote.Proxy)
+		if err != nil {
+			return nil, errors.New("proxy of remote is not a valid url: " + err.Error())
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if remote.Insecure || remote.CaCert != "" {
+		tlsConfig := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+		if remote.Insecure {
+			tlsConfig.InsecureSkipVerify = true
+		}
+		if remote.CaCert != "" {
+			pem, err := ioutil.ReadFile(remote.CaCert)
+			if err != nil {
+				return nil, errors.New("cannot read ca certificate of remote: " + err.Error())
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificates found in " + remote.CaCert)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// applyRemoteSettings makes requests to the hosts of remote use its proxy
+// and tls settings and its credentials for the rest of the session
+func (p *Pvr) applyRemoteSettings(remote *PvrRemoteConfig) error {
+	if remote.Proxy != "" || remote.Insecure || remote.CaCert != "" {
+		transport, err := newRemoteTransport(remote)
+		if err != nil {
+			return err
+		}
+		for _, u := range []string{remote.Url, remote.PutUrl, remote.PostUrl} {
+			parsed, err := url.Parse(u)
+			if err != nil || parsed.Host == "" {
+				continue
+			}
+			DefaultRemoteTransport.route(parsed.Host, transport)
+		}
+	}
+
+	if remote.AuthEndpoint != "" && p.Session != nil {
+		p.Session.useLogin(remote.AuthEndpoint, remote.AuthRealm)
+	}
+
+	return nil
+}
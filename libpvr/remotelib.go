@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 
 	pvrapi "gitlab.com/pantacor/pvr/api"
@@ -173,3 +174,109 @@ func (p *Pvr) RemoteInfo(pvrRef string) (*pvrapi.PvrRemote, error) {
 
 	return &pvrRemote, nil
 }
+
+// RollbackDevice posts the state of an earlier revision of the trail of
+// device deviceId as a new revision. toRev picks the revision; if negative
+// the latest revision before the current one that the device finished
+// successfully is used. All objects of that state must still be available
+// on the objects endpoint of the trail. An empty commitMsg gets generated.
+func (p *Pvr) RollbackDevice(baseURL string, deviceId string, toRev int, commitMsg string) (*PvrPostResult, error) {
+	summary, err := p.Session.GetTrailSummary(baseURL, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	var step *PantahubStep
+	if toRev < 0 {
+		before := summary.Revision
+		for step == nil && before > 0 {
+			page, err := p.Session.getTrailStepsPage(baseURL, deviceId, before, trailStepsPageSize)
+			if err != nil {
+				return nil, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			for i := range page {
+				if StepSucceeded(page[i].Progress.Status) {
+					step = &page[i]
+					break
+				}
+			}
+			before = page[len(page)-1].Rev
+		}
+		if step == nil {
+			return nil, errors.New("device " + deviceId + " has no earlier revision that finished successfully; use --to")
+		}
+	} else {
+		if toRev == summary.Revision {
+			return nil, fmt.Errorf("revision %d is the current revision of device %s", toRev, deviceId)
+		}
+		step, err = p.Session.GetTrailStep(baseURL, deviceId, toRev)
+		if err == ErrStepNotFound {
+			return nil, fmt.Errorf("device %s has no revision %d", deviceId, toRev)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := p.Session.GetTrailStepState(baseURL, deviceId, step.Rev)
+	if err != nil {
+		return nil, err
+	}
+
+	trailURL, err := url.Parse(strings.TrimSuffix(baseURL, "/") + PhTrailsEp + "/" + deviceId)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := p.initializeRemote(trailURL)
+	if err != nil {
+		return nil, err
+	}
+
+	filesAndObjects, err := listFilesAndObjectsFromJson(state, []string{})
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for name, sha := range filesAndObjects {
+		_, _, err := p.getObjectInfo(remote, sha)
+		if err != nil {
+			missing = append(missing, name+" ("+sha+"): "+err.Error())
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("cannot roll back to revision %d, %d objects are not available anymore:\n\t%s",
+			step.Rev, len(missing), strings.Join(missing, "\n\t"))
+	}
+
+	if commitMsg == "" {
+		commitMsg = fmt.Sprintf("Rollback to revision %d", step.Rev)
+		if step.CommitMsg != "" {
+			commitMsg += ": " + step.CommitMsg
+		}
+	}
+
+	body, err := p.postRemoteJson(remote, state, "", commitMsg, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parsePostResult(body)
+	if err != nil {
+		return nil, err
+	}
+
+	p.emit(PvrEvent{
+		Type:   EventRevisionPosted,
+		Name:   result.TrailId,
+		Sha:    result.StateSha,
+		Status: EventStatusOk,
+		Message: fmt.Sprintf("Successfully posted Revision %s (%s) to device id %s", result.Rev,
+			result.StateSha[:Min(8, len(result.StateSha))], result.TrailId),
+	})
+
+	return result, nil
+}
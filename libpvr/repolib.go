@@ -25,12 +25,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -44,17 +44,16 @@ import (
 	pvrapi "gitlab.com/pantacor/pvr/api"
 	"gitlab.com/pantacor/pvr/utils/pvjson"
 	"golang.org/x/term"
-	"gopkg.in/cheggaaa/pb.v1"
 )
 
 const PvrCheckpointFilename = "checkpoint.json"
 
 type PvrStatus struct {
-	NewFiles       []string
-	RemovedFiles   []string
-	ChangedFiles   []string
-	UntrackedFiles []string
-	JsonDiff       *[]byte
+	NewFiles       []string `json:"new"`
+	RemovedFiles   []string `json:"removed"`
+	ChangedFiles   []string `json:"changed"`
+	UntrackedFiles []string `json:"untracked"`
+	JsonDiff       *[]byte  `json:"-"`
 }
 
 // stringify of file status for "pvr status" list...
@@ -89,18 +88,35 @@ type Pvr struct {
 	Pvrdir          string
 	Pvdir           string
 	Objdir          string
+	Objects         ObjectStore
 	Pvrconfig       PvrConfig
 	PristineJson    []byte
 	PristineJsonMap PvrMap
 	NewFiles        PvrIndex
 	Session         *Session
+
+	// MergeStrategy decides how GetRepo handles conflicting changes; see
+	// MergeStrategyConflict, MergeStrategyOurs and MergeStrategyTheirs
+	MergeStrategy string
+
+	// Retries is how often failed or corrupt object downloads are
+	// fetched again before giving up
+	Retries int
 }
 
 type PvrConfig struct {
-	DefaultGetUrl  string
-	DefaultPutUrl  string
-	DefaultPostUrl string
-	ObjectsDir     string
+	// Deprecated: only read to migrate configs of older pvr versions to
+	// Remotes
+	DefaultGetUrl  string `json:",omitempty"`
+	DefaultPutUrl  string `json:",omitempty"`
+	DefaultPostUrl string `json:",omitempty"`
+
+	// ObjectsDir is the objects directory or the url of a remote
+	// object store; see NewObjectStore
+	ObjectsDir string
+
+	// named remotes; see PvrDefaultRemote
+	Remotes map[string]*PvrRemoteConfig
 
 	// tokens by realm
 	AccessTokens  map[string]string
@@ -158,6 +174,7 @@ func NewPvrInit(s *Session, dir string) (*Pvr, error) {
 		pvr.Initialized = false
 		return &pvr, nil
 	}
+	pvr.Initialized = true
 
 	jPath := filepath.Join(pvr.Pvrdir, "json")
 	_, err = os.Stat(jPath)
@@ -207,12 +224,16 @@ func NewPvrInit(s *Session, dir string) (*Pvr, error) {
 		}
 	}
 
+	pvr.Pvrconfig.migrateRemotes()
+
+	pvr.Objects = NewLocalObjectStore(pvr.Objdir)
 	if pvr.Pvrconfig.ObjectsDir != "" {
-		pvr.Objdir = pvr.Pvrconfig.ObjectsDir
-		if !filepath.IsAbs(pvr.Objdir) {
-			pvr.Objdir = path.Join(pvr.Pvrdir, "..", pvr.Objdir)
+		err = pvr.setObjectStore(pvr.Pvrconfig.ObjectsDir)
+		if err != nil {
+			return nil, err
 		}
 	}
+
 	return &pvr, nil
 }
 
@@ -236,6 +257,23 @@ func (p *Pvr) addPvrFile(path string, forceObject bool) error {
 // XXX: make this git style
 func (p *Pvr) AddFile(globs []string, forceObject bool) error {
 
+	ignore := NewPvrIgnore(p.Dir)
+
+	// named tells if walkPath, or for directories anything below it, is
+	// given literally on the command line
+	named := func(walkPath string, isDir bool) bool {
+		for _, glob := range globs {
+			absglob := glob
+			if !filepath.IsAbs(absglob) && absglob[0] != '/' {
+				absglob = p.Dir + glob
+			}
+			if absglob == walkPath || (isDir && strings.HasPrefix(absglob, walkPath+"/")) {
+				return true
+			}
+		}
+		return false
+	}
+
 	err := filepath.Walk(p.Dir, func(walkPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -245,6 +283,25 @@ func (p *Pvr) AddFile(globs []string, forceObject bool) error {
 			return nil
 		}
 
+		// files matching .pvrignore are only added if we track them already
+		// or if they are named explicitly
+		relPathSlash := filepath.ToSlash(strings.TrimPrefix(walkPath, p.Dir))
+		if ignore.Match(relPathSlash, info.IsDir()) {
+			if info.IsDir() && !p.isTrackedDir(relPathSlash) && !named(walkPath, true) {
+				return filepath.SkipDir
+			}
+			if _, ok := p.PristineJsonMap[relPathSlash]; !ok && !info.IsDir() {
+				if !named(walkPath, false) || filepath.Base(walkPath) == PvrIgnoreFilename {
+					return nil
+				}
+				p.emit(PvrEvent{
+					Type:    EventWarning,
+					Name:    relPathSlash,
+					Message: "adding " + relPathSlash + " although it matches " + PvrIgnoreFilename,
+				})
+			}
+		}
+
 		// no globs specified: add all
 		if len(globs) == 0 || (len(globs) == 1 && globs[0] == ".") {
 			p.addPvrFile(walkPath, forceObject)
@@ -408,16 +465,23 @@ func (p *Pvr) GetWorkingJson() ([]byte, []string, error) {
 		workingJson["#spec"] = "pantavisor-service-system@1"
 	}
 
+	ignore := NewPvrIgnore(p.Dir)
+	statIndex := p.loadStatIndex()
+	hashJobs := []statHashJob{}
 	err := filepath.Walk(p.Dir, func(filePath string, info os.FileInfo, err error) error {
 		relPath := strings.TrimPrefix(filePath, p.Dir)
 		if relPath == "" {
 			return nil
 		}
+		relPathSlash := filepath.ToSlash(relPath)
 		if info.IsDir() {
+			// no need to look into ignored dirs unless we track files there
+			if ignore.Match(relPathSlash, true) && !p.isTrackedDir(relPathSlash) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		relPathSlash := filepath.ToSlash(relPath)
 		// ignore .pvr and .pv directories
 		if _, ok := p.PristineJsonMap[relPathSlash]; !ok {
 			if _, ok1 := p.NewFiles[relPathSlash]; !ok1 {
@@ -427,6 +491,9 @@ func (p *Pvr) GetWorkingJson() ([]byte, []string, error) {
 				if strings.HasPrefix(relPathSlash, ".pv/") {
 					return nil
 				}
+				if ignore.Match(relPathSlash, false) {
+					return nil
+				}
 				untrackedFiles = append(untrackedFiles, relPath)
 				return nil
 			}
@@ -447,12 +514,15 @@ func (p *Pvr) GetWorkingJson() ([]byte, []string, error) {
 				return errors.New("JSON Unmarshal (" + strings.TrimPrefix(filePath, p.Dir) + "): " + err.Error())
 			}
 			workingJson[relPathSlash] = jsonFile
-		} else {
-			sha, err := FiletoSha(filePath)
-			if err != nil {
-				return err
-			}
+		} else if sha, ok := statIndex.Lookup(relPathSlash, info); ok {
 			workingJson[relPathSlash] = sha
+		} else {
+			// hashed in parallel once we know all changed files
+			hashJobs = append(hashJobs, statHashJob{
+				relPath:  relPathSlash,
+				filePath: filePath,
+				info:     info,
+			})
 		}
 
 		return nil
@@ -462,6 +532,18 @@ func (p *Pvr) GetWorkingJson() ([]byte, []string, error) {
 		return []byte{}, []string{}, err
 	}
 
+	shas, err := statIndex.hashFiles(hashJobs)
+	if err != nil {
+		return []byte{}, []string{}, err
+	}
+	for k, sha := range shas {
+		workingJson[k] = sha
+	}
+
+	// the index is just a cache; never fail because of it
+	statIndex.Retain(workingJson)
+	statIndex.Save()
+
 	b, err := cjson.Marshal(workingJson)
 
 	if err != nil {
@@ -496,13 +578,19 @@ func (p *Pvr) InitCustom(customInitJson string, objectsDir string) error {
 
 	// allow overwrite and remember abs path in config
 	if objectsDir != "" {
-		p.Objdir, err = filepath.Abs(objectsDir)
+		if !IsObjectStoreUrl(objectsDir) {
+			objectsDir, err = filepath.Abs(objectsDir)
+			if err != nil {
+				return errors.New("Unexpected Error 1: " + err.Error())
+			}
+		}
 
+		err = p.setObjectStore(objectsDir)
 		if err != nil {
-			return errors.New("Unexpected Error 1: " + err.Error())
+			return err
 		}
 
-		p.Pvrconfig.ObjectsDir = p.Objdir
+		p.Pvrconfig.ObjectsDir = objectsDir
 		p.SaveConfig()
 	}
 
@@ -549,7 +637,11 @@ func (p *Pvr) Diff() (*[]byte, error) {
 }
 
 func (p *Pvr) Status() (*PvrStatus, error) {
-	rs := PvrStatus{}
+	rs := PvrStatus{
+		NewFiles:     []string{},
+		RemovedFiles: []string{},
+		ChangedFiles: []string{},
+	}
 
 	workingJson, untrackedFiles, err := p.GetWorkingJson()
 	if err != nil {
@@ -639,7 +731,12 @@ exit:
 	return err
 }
 
-func (p *Pvr) Commit(msg string, isCheckpoint bool) (err error) {
+func (p *Pvr) Commit(msg string, author string, isCheckpoint bool) (err error) {
+
+	err = p.checkNoConflicts()
+	if err != nil {
+		return err
+	}
 
 	// lets generate checkpoint file
 	if isCheckpoint {
@@ -667,21 +764,28 @@ func (p *Pvr) Commit(msg string, isCheckpoint bool) (err error) {
 		iface := wMap[v]
 
 		if isInlineJson(v, iface) {
-			fmt.Fprintln(os.Stderr, "Committing (inline): "+filepath.Join(p.Dir, v))
+			p.emit(PvrEvent{
+				Type:    EventFileCommitted,
+				Name:    v,
+				Status:  EventStatusChanged,
+				Message: "Committing (inline): " + filepath.Join(p.Dir, v),
+			})
 			continue
 		}
-		fmt.Fprintln(os.Stderr, "Committing (raw): "+filepath.Join(p.Dir, v))
 
-		sha, err := FiletoSha(v)
-		if err != nil {
-			return err
-		}
-		err = Copy(filepath.Join(p.Objdir, sha+".new"), v)
-		if err != nil {
-			return err
-		}
-		err = os.Rename(filepath.Join(p.Objdir, sha+".new"),
-			path.Join(p.Objdir, sha))
+		// hashed (or taken from the stat index) by GetWorkingJson already
+		sha, ok := iface.(string)
+		if !ok {
+			return errors.New("no object sha for file " + v)
+		}
+		p.emit(PvrEvent{
+			Type:    EventFileCommitted,
+			Name:    v,
+			Sha:     sha,
+			Status:  EventStatusChanged,
+			Message: "Committing (raw): " + filepath.Join(p.Dir, v),
+		})
+		err = putObjectFile(p.Objects, sha, filepath.Join(p.Dir, v))
 		if err != nil {
 			return err
 		}
@@ -692,37 +796,40 @@ func (p *Pvr) Commit(msg string, isCheckpoint bool) (err error) {
 		if strings.HasSuffix(v, ".json") {
 			addInfo, ok := p.NewFiles[v]
 			if !ok || !addInfo.ForceObject {
-				fmt.Fprintln(os.Stderr, "Adding inline "+v)
+				p.emit(PvrEvent{
+					Type:    EventFileCommitted,
+					Name:    v,
+					Status:  EventStatusAdded,
+					Message: "Adding inline " + v,
+				})
 				continue
 			}
 		}
-		v = filepath.Join(p.Dir, v)
-		sha, err := FiletoSha(v)
-		if err != nil {
-			return err
-		}
-		fmt.Fprintln(os.Stderr, "Adding raw "+v+" with "+sha)
-		_, err = os.Stat(filepath.Join(p.Objdir, sha))
-		// if not exists, then copy; otherwise continue
-		if err != nil {
-
-			err = Copy(filepath.Join(p.Objdir, sha+".new"), v)
-			if err != nil {
-				return err
-			}
-			err = os.Rename(filepath.Join(p.Objdir, sha+".new"),
-				path.Join(p.Objdir, sha))
-			if err != nil {
-				return err
-			}
-		}
+		sha, ok := wMap[v].(string)
+		if !ok {
+			return errors.New("no object sha for file " + v)
+		}
+		p.emit(PvrEvent{
+			Type:    EventFileCommitted,
+			Name:    v,
+			Sha:     sha,
+			Status:  EventStatusAdded,
+			Message: "Adding raw " + filepath.Join(p.Dir, v) + " with " + sha,
+		})
+		// only stored if not there yet
+		err = putObjectFile(p.Objects, sha, filepath.Join(p.Dir, v))
 		if err != nil {
 			return err
 		}
 	}
 
 	for _, v := range status.RemovedFiles {
-		fmt.Fprintln(os.Stderr, "Removing "+v)
+		p.emit(PvrEvent{
+			Type:    EventFileCommitted,
+			Name:    v,
+			Status:  EventStatusRemoved,
+			Message: "Removing " + v,
+		})
 	}
 
 	ioutil.WriteFile(filepath.Join(p.Pvrdir, "commitmsg.new"), []byte(msg), 0644)
@@ -758,10 +865,28 @@ func (p *Pvr) Commit(msg string, isCheckpoint bool) (err error) {
 	// ignore error here as new might not exist
 	os.Remove(filepath.Join(p.Pvrdir, "new"))
 
+	rev, err := p.recordRevision(msg, author, newJson)
+	if err != nil {
+		return err
+	}
+	p.emit(PvrEvent{
+		Type:    EventRevisionCommitted,
+		Sha:     rev.Sha,
+		Message: "Committed revision " + rev.Sha[:12],
+	})
+
+	err = p.TrackObjectCache()
+
 	return err
 }
 
 func (p *Pvr) PutLocal(repoPath string) error {
+	return p.putLocal(repoPath, true)
+}
+
+// putLocal copies all objects to the repository at repoPath; with
+// updateJson the pristine json of this repo becomes its json.
+func (p *Pvr) putLocal(repoPath string, updateJson bool) error {
 
 	_, err := os.Stat(repoPath)
 	if err != os.ErrNotExist {
@@ -771,51 +896,24 @@ func (p *Pvr) PutLocal(repoPath string) error {
 		return err
 	}
 
-	tP, err := NewPvr(p.Session, repoPath)
+	objects, err := bareRepoObjectStore(repoPath)
 	if err != nil {
 		return err
 	}
 
-	objectsPath := tP.Pvrconfig.ObjectsDir
-
-	info, err := os.Stat(objectsPath)
-	if err == nil && !info.IsDir() {
-		return errors.New("PVR repo directory in inusable state (objects is not a directory)")
-	} else if err != nil {
-		err = os.MkdirAll(objectsPath, 0755)
-	}
-	if err != nil && !os.IsExist(err) {
-		return err
-	}
-
 	// push all objects
 	for k, v := range p.PristineJsonMap {
-		if isInlineJson(k, v) {
+		if isInlineJson(k, v) || strings.HasPrefix(k, "#spec") {
 			continue
 		}
-		vs := p.PristineJsonMap[k].(string)
-		Copy(filepath.Join(objectsPath, vs)+".new", filepath.Join(p.Dir, ".pvr", vs))
-	}
-	err = filepath.Walk(p.Objdir, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		// ignore directories
-		if info.IsDir() {
-			return nil
-		}
-		base := path.Base(filePath)
-		err = Copy(filepath.Join(objectsPath, base+".new"), filePath)
+		err = copyObject(objects, p.Objects, v.(string))
 		if err != nil {
-			return err
+			return errors.New("cannot put object for " + k + ": " + err.Error())
 		}
+	}
 
-		err = os.Rename(filepath.Join(objectsPath, base+".new"),
-			path.Join(objectsPath, base))
-		return err
-	})
-	if err != nil {
-		return err
+	if !updateJson {
+		return nil
 	}
 
 	err = Copy(filepath.Join(repoPath, "json.new"), filepath.Join(p.Pvrdir, "json"))
@@ -852,12 +950,18 @@ func (p *Pvr) initializeRemote(repoUrl *url.URL) (pvrapi.PvrRemote, error) {
 	pvrRemoteUrl.Path = path.Join(pvrRemoteUrl.Path, ".pvrremote")
 
 	response, err := p.Session.DoAuthCall(true, func(req *resty.Request) (response *resty.Response, err error) {
-		fmt.Fprintf(os.Stderr, "Getting remote repository info ... ")
+		event := PvrEvent{
+			Type:    EventRemoteInfo,
+			Name:    pvrRemoteUrl.String(),
+			Status:  EventStatusOk,
+			Message: "Getting remote repository info ... [OK]",
+		}
 		if response, err = req.Get(pvrRemoteUrl.String()); err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR "+err.Error()+"]\n")
-			return response, err
+			event.Status = EventStatusError
+			event.Error = err.Error()
+			event.Message = "Getting remote repository info ... [ERROR " + err.Error() + "]"
 		}
-		fmt.Fprintf(os.Stderr, "[OK]\n")
+		p.emit(event)
 		return response, err
 	})
 
@@ -1054,168 +1158,388 @@ type FilePut struct {
 	putUrl     string
 	objName    string
 	objType    string
-	res        *http.Response
-	err        error
-	bar        *pb.ProgressBar
+
+	// objectsUrl and object are used to request a fresh putUrl once the
+	// signed one expired during retries
+	objectsUrl string
+	object     ObjectWithAccess
+
+	// resumable is set if the object storage announced that interrupted
+	// uploads can be continued; see HttpHeaderPvrResumableUpload
+	resumable bool
+
+	res *http.Response
+	err error
 }
 
 const (
+	// PoolSize is the default number of parallel transfers; see --jobs
 	PoolSize = 5
 )
 
+// interval between progress events of a single transfer
+const progressEventInterval = 200 * time.Millisecond
+
+const (
+	// number of attempts to upload a single object before giving up
+	uploadMaxAttempts = 6
+
+	// wait before the first retry of an upload; doubled for each further
+	// attempt up to uploadRetryMaxBackoff
+	uploadRetryBackoff    = time.Second
+	uploadRetryMaxBackoff = 30 * time.Second
+)
+
 type AsyncBody struct {
 	Delegate io.ReadCloser
-	bar      *pb.ProgressBar
+	emit     func(PvrEvent)
+	name     string
+	total    int64
+	bytes    int64
+	last     time.Time
 }
 
 func (a *AsyncBody) Read(p []byte) (n int, err error) {
 
 	n, err = a.Delegate.Read(p)
-	a.bar.Add(n)
+	a.bytes += int64(n)
+
+	if time.Since(a.last) >= progressEventInterval || err == io.EOF {
+		a.last = time.Now()
+		a.emit(PvrEvent{
+			Type:  EventObjectUploadProgress,
+			Name:  a.name,
+			Bytes: a.bytes,
+			Total: a.total,
+		})
+	}
 
 	return n, err
 }
 
-func worker(jobs chan FilePut, done chan FilePut) {
+func (p *Pvr) worker(jobs chan FilePut, done chan FilePut) {
 
 	for j := range jobs {
-		fstat, err := os.Stat(j.sourceFile)
-		if err != nil {
-			log.Println("ERROR: " + err.Error())
-			continue
-		}
-		reader, err := os.Open(j.sourceFile)
-		if err != nil {
-			log.Println("ERROR: " + err.Error())
-			continue
-		}
-		defer reader.Close()
+		j.res, j.err = p.uploadObject(&j)
+		done <- j
+	}
+}
+
+// isRetryableUploadStatus tells whether an upload answered with status
+// might succeed when tried again
+func isRetryableUploadStatus(status int) bool {
+	switch status {
+	case http.StatusPermanentRedirect, // incomplete resumable upload
+		http.StatusUnauthorized,
+		http.StatusForbidden, // expired signed url
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests:
+		return true
+	}
+	return status >= 500
+}
+
+// uploadObject puts the object of j to its signed url. Failed uploads are
+// retried with exponential backoff, continuing where they broke off if the
+// storage supports it; expired urls are signed again by the objects endpoint.
+func (p *Pvr) uploadObject(j *FilePut) (*http.Response, error) {
+	objBaseName := filepath.Base(j.objName)
+	sha := filepath.Base(j.sourceFile)
 
-		j.bar.Total = fstat.Size()
-		j.bar.Units = pb.U_BYTES
-		j.bar.UnitsWidth = 25
-		j.bar.ShowSpeed = true
-		j.bar.ShowCounters = false
+	fstat, err := os.Stat(j.sourceFile)
+	if err != nil {
+		p.emit(PvrEvent{Type: EventWarning, Message: err.Error()})
+		return nil, err
+	}
+	size := fstat.Size()
+
+	p.emit(PvrEvent{
+		Type:  EventObjectUploadStarted,
+		Name:  objBaseName,
+		Sha:   sha,
+		Total: size,
+	})
+
+	var res *http.Response
+	var offset int64
+	backoff := uploadRetryBackoff
 
-		objBaseName := filepath.Base(j.objName)
-		j.bar.Prefix(objBaseName[:Min(len(objBaseName)-1, 12)] + " ")
+	// continue uploads an earlier pvr run did not finish
+	var complete bool
+	if j.resumable {
+		offset, complete = p.uploadOffset(j.putUrl, size)
+	}
 
-		r := &AsyncBody{
-			Delegate: reader,
-			bar:      j.bar,
+	for attempt := 1; ; attempt++ {
+		if complete {
+			res, err = &http.Response{StatusCode: http.StatusOK, Status: "200 OK"}, nil
+			break
 		}
 
-		var res *http.Response
-		if resty.DefaultClient.Debug {
-			var restyresponse *resty.Response
-			r := resty.
-				R().
-				SetBody(r).
-				SetContentLength(true).
-				SetHeader("Content-Length", strconv.FormatInt(fstat.Size(), 10))
+		res, err = p.putObjectData(j, objBaseName, size, offset)
+		if err == nil && (res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated) {
+			break
+		}
+		if err == nil {
+			err = errors.New("REST call failed. " + strconv.Itoa(res.StatusCode) + "  " + res.Status)
+			if !isRetryableUploadStatus(res.StatusCode) {
+				break
+			}
+		}
+		if attempt >= uploadMaxAttempts {
+			break
+		}
 
-			restyresponse, err = r.Put(j.putUrl)
-			res = restyresponse.RawResponse
-		} else {
-			req, err := http.NewRequest(http.MethodPut, j.putUrl, r)
-			req.ContentLength = fstat.Size()
-			if err != nil {
-				j.bar.Finish()
-				j.err = err
-				j.res = nil
+		p.emit(PvrEvent{
+			Type:  EventWarning,
+			Name:  objBaseName,
+			Sha:   sha,
+			Error: err.Error(),
+			Message: fmt.Sprintf("upload of %s failed (attempt %d/%d), retrying in %s: %s",
+				objBaseName, attempt, uploadMaxAttempts, backoff, err.Error()),
+		})
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > uploadRetryMaxBackoff {
+			backoff = uploadRetryMaxBackoff
+		}
 
-				done <- j
-				continue
+		if res != nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+			refreshErr := p.refreshPutUrl(j)
+			if refreshErr != nil {
+				err = refreshErr
+				break
 			}
-			res, err = http.DefaultClient.Do(req)
 		}
 
+		offset = 0
+		if j.resumable {
+			offset, complete = p.uploadOffset(j.putUrl, size)
+		}
+	}
+
+	event := PvrEvent{
+		Type:   EventObjectUploadDone,
+		Name:   objBaseName,
+		Sha:    sha,
+		Status: EventStatusOk,
+		Bytes:  size,
+		Total:  size,
+	}
+	if err != nil {
+		event.Status = EventStatusError
+		event.Error = err.Error()
+	} else if j.objType == objects.ObjectTypeLink {
+		event.Status = EventStatusLink
+	}
+	p.emit(event)
+
+	return res, err
+}
+
+// putObjectData sends the object content from offset on to the put url
+func (p *Pvr) putObjectData(j *FilePut, name string, size int64, offset int64) (*http.Response, error) {
+	reader, err := os.Open(j.sourceFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if offset > 0 {
+		_, err = reader.Seek(offset, io.SeekStart)
 		if err != nil {
-			j.bar.Postfix(" [ERROR]")
-		} else {
-			if j.objType == objects.ObjectTypeLink {
-				j.bar.Postfix(" [LK]")
-			} else if j.objType == objects.ObjectTypeObject {
-				j.bar.Postfix(" [OK]")
-			} else {
-				j.bar.Postfix(" [OK]")
-			}
+			return nil, err
 		}
+	}
 
-		j.bar.ShowFinalTime = true
-		j.bar.ShowPercent = false
-		j.bar.ShowCounters = false
-		j.bar.ShowTimeLeft = false
-		j.bar.ShowSpeed = false
-		j.bar.ShowBar = true
-		j.bar.Set64(j.bar.Total)
-		j.bar.UnitsWidth = 25
-		j.bar.Finish()
+	r := &AsyncBody{
+		Delegate: p.rateLimiter().LimitReader(reader),
+		emit:     p.emit,
+		name:     name,
+		total:    size,
+		bytes:    offset,
+	}
 
-		j.err = err
-		j.res = res
-		done <- j
+	contentRange := ""
+	if offset > 0 {
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size)
+	}
+
+	if resty.DefaultClient.Debug {
+		req := resty.
+			R().
+			SetBody(r).
+			SetContentLength(true).
+			SetHeader("Content-Length", strconv.FormatInt(size-offset, 10))
+		if contentRange != "" {
+			req.SetHeader("Content-Range", contentRange)
+		}
+
+		restyresponse, err := req.Put(j.putUrl)
+		if restyresponse != nil {
+			return restyresponse.RawResponse, err
+		}
+		return nil, err
 	}
+
+	req, err := http.NewRequest(http.MethodPut, j.putUrl, r)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size - offset
+	if contentRange != "" {
+		req.Header.Set("Content-Range", contentRange)
+	}
+
+	res, err := DefaultRemoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	return res, nil
 }
 
-func (p *Pvr) putFiles(filePut ...FilePut) []FilePut {
-	jobs := make(chan FilePut, 100)
-	results := make(chan FilePut, 100)
+// uploadOffset asks a resumable put url how much of the object it already
+// has; complete is set if the upload actually finished
+func (p *Pvr) uploadOffset(putUrl string, size int64) (offset int64, complete bool) {
+	req, err := http.NewRequest(http.MethodPut, putUrl, nil)
+	if err != nil {
+		return 0, false
+	}
+	req.ContentLength = 0
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
 
-	fileOutPut := []FilePut{}
+	res, err := DefaultRemoteClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated {
+		return size, true
+	}
+	if res.StatusCode != http.StatusPermanentRedirect {
+		return 0, false
+	}
+
+	// Range: bytes=0-<last byte received>
+	received := strings.TrimPrefix(res.Header.Get("Range"), "bytes=0-")
+	last, err := strconv.ParseInt(received, 10, 64)
+	if err != nil || last+1 > size {
+		return 0, false
+	}
+	return last + 1, false
+}
 
-	pool, err := pb.StartPool()
+// refreshPutUrl asks the objects endpoint for a newly signed put url
+func (p *Pvr) refreshPutUrl(j *FilePut) error {
+	if j.objectsUrl == "" {
+		return errors.New("signed put url for " + j.objName + " expired")
+	}
 
+	response, err := p.postObjectInfo(j.objectsUrl, j.object)
 	if err != nil {
-		log.Fatalf("FATAL: starting progressbar pool failed: %s\n", err.Error())
+		return err
+	}
+	if response.StatusCode() != http.StatusOK &&
+		response.StatusCode() != http.StatusConflict {
+		return errors.New("Error posting object " + strconv.Itoa(response.StatusCode()))
 	}
 
-	for i := 0; i < PoolSize; i++ {
-		go worker(jobs, results)
+	object := ObjectWithAccess{}
+	err = pvjson.Unmarshal(response.Body(), &object)
+	if err != nil {
+		return err
 	}
+	if object.SignedPutUrl == "" {
+		return errors.New("objects endpoint returned no put url for " + j.objName)
+	}
+
+	j.putUrl = object.SignedPutUrl
+	j.resumable = response.Header().Get(HttpHeaderPvrResumableUpload) != ""
+	return nil
+}
+
+func (p *Pvr) putFiles(filePut ...FilePut) []FilePut {
+	jobs := make(chan FilePut, 100)
+	results := make(chan FilePut, 100)
+
+	fileOutPut := []FilePut{}
 
-	for _, p := range filePut {
-		p.bar = pb.New(1)
-		pool.Add(p.bar)
-		jobs <- p
+	for i := 0; i < p.transferJobs(); i++ {
+		go p.worker(jobs, results)
 	}
-	close(jobs)
+
+	go func() {
+		for _, f := range filePut {
+			jobs <- f
+		}
+		close(jobs)
+	}()
 
 	for i := 0; i < len(filePut); i++ {
-		p := <-results
-		fileOutPut = append(fileOutPut, p)
-		p.bar.Finish()
+		f := <-results
+		fileOutPut = append(fileOutPut, f)
 	}
 	close(results)
-	pool.Stop()
 
 	return fileOutPut
 }
 
+// postObjectInfo announces an object to the objects endpoint uri; the
+// response carries the signed urls to transfer it
+func (p *Pvr) postObjectInfo(uri string, remoteObject ObjectWithAccess) (*resty.Response, error) {
+	return p.Session.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
+		return req.SetBody(remoteObject).Post(uri)
+	})
+}
+
+// postBaseline returns the current state of pvrRemote which objects
+// already there are not posted again for
+func (p *Pvr) postBaseline(pvrRemote pvrapi.PvrRemote) (map[string]interface{}, error) {
+	baselineState := map[string]interface{}{}
+
+	// we have no getUrl in device create and pubobjects case
+	if pvrRemote.JsonGetUrl == "" {
+		return baselineState, nil
+	}
+
+	buf, err := p.getJSONBuf(pvrRemote)
+	if err != nil {
+		p.emit(PvrEvent{
+			Type:    EventRemoteInfo,
+			Name:    pvrRemote.JsonGetUrl,
+			Status:  EventStatusError,
+			Error:   err.Error(),
+			Message: "Synching baseline state with device [ERROR: " + err.Error() + "]",
+		})
+		return nil, err
+	}
+
+	// remotes without state yet answer with an error document
+	pvjson.Unmarshal(buf, &baselineState)
+	p.emit(PvrEvent{
+		Type:    EventRemoteInfo,
+		Name:    pvrRemote.JsonGetUrl,
+		Status:  EventStatusOk,
+		Message: "Synching baseline state with device [OK]",
+	})
+
+	return baselineState, nil
+}
+
 func (p *Pvr) postObjects(pvrRemote pvrapi.PvrRemote, force bool) error {
 
 	var baselineState map[string]interface{}
-	var filePutResults []FilePut
-	var shaSeen map[string]interface{}
-	var filePuts []FilePut
 	var filesAndObjects, baselineFilesAndObjects map[string]string
 	var refObjects map[string]interface{}
 	var err error
 
-	// we have no getUrl in device create and pubobjects case
-	if pvrRemote.JsonGetUrl != "" {
-		fmt.Fprintf(os.Stderr, "Synching baseline state with device")
-
-		buf, err := p.getJSONBuf(pvrRemote)
-		if err != nil {
-			return errout(err)
-		}
-
-		pvjson.Unmarshal(buf, &baselineState)
-		if err != nil {
-			return errout(err)
-		}
-		fmt.Fprintf(os.Stderr, " [OK]\n")
+	baselineState, err = p.postBaseline(pvrRemote)
+	if err != nil {
+		return err
 	}
 
 	baselineFilesAndObjects, err = listFilesAndObjectsFromJson(baselineState, []string{})
@@ -1234,19 +1558,47 @@ func (p *Pvr) postObjects(pvrRemote pvrapi.PvrRemote, force bool) error {
 		return err
 	}
 
+	return p.uploadObjects(pvrRemote.ObjectsEndpointUrl, filesAndObjects, refObjects, force)
+}
+
+// uploadObjects posts the local objects of filesAndObjects to the objects
+// endpoint objectsUrl, skipping those in refObjects
+func (p *Pvr) uploadObjects(objectsUrl string, filesAndObjects map[string]string,
+	refObjects map[string]interface{}, force bool) error {
+
+	var filePutResults []FilePut
+	var shaSeen map[string]interface{}
+	var filePuts []FilePut
+
 	filePuts = []FilePut{}
 
 	shaSeen = map[string]interface{}{}
 
-	// push all objects
-	for k, v := range filesAndObjects {
-
+	infoError := func(name string, sha string, err error) error {
+		p.emit(PvrEvent{
+			Type:    EventObjectInfoPosted,
+			Name:    name,
+			Sha:     sha,
+			Status:  EventStatusError,
+			Error:   err.Error(),
+			Message: "Posting object info for: " + name + " ... [ERROR: " + err.Error() + "]",
+		})
+		return err
+	}
+
+	// push all objects
+	for k, v := range filesAndObjects {
+
 		// we skip objects already in baseline state
 		if refObjects[v] != nil {
 			continue
 		}
 
-		info, err := os.Stat(filepath.Join(p.Objdir, v))
+		fileName, err := p.objectFile(v)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(fileName)
 		if err != nil {
 			return err
 		}
@@ -1258,34 +1610,29 @@ func (p *Pvr) postObjects(pvrRemote pvrapi.PvrRemote, force bool) error {
 		remoteObject.Sha = v
 		remoteObject.ObjectName = k
 
-		uri := pvrRemote.ObjectsEndpointUrl
+		uri := objectsUrl
 		if !strings.HasSuffix(uri, "/") {
 			uri += "/"
 		}
 
-		fmt.Fprintf(os.Stderr, "Posting object info for: "+k+" ... ")
-
-		response, err := p.Session.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
-			res, err := req.SetBody(remoteObject).Post(uri)
-
-			if err != nil {
-				fmt.Fprintf(os.Stderr, " [ERROR: "+err.Error()+"]")
-			}
-			return res, err
-		})
+		response, err := p.postObjectInfo(uri, remoteObject)
 
 		if err != nil {
-			return errout(err)
+			return infoError(k, v, err)
 		}
 
 		if response == nil {
 			err = errors.New("BAD STATE; no respo")
-			return errout(err)
+			return infoError(k, v, err)
 		}
 
 		if shaSeen[remoteObject.Sha] != nil {
-			_str := remoteObject.ObjectName[0:Min(len(remoteObject.ObjectName)-1, 12)] + " "
-			fmt.Fprintln(os.Stderr, _str+"[OK - Dupe]")
+			p.emit(PvrEvent{
+				Type:   EventObjectUploadDone,
+				Name:   remoteObject.ObjectName,
+				Sha:    remoteObject.Sha,
+				Status: EventStatusDupe,
+			})
 			continue
 		}
 		shaSeen[remoteObject.Sha] = "yes"
@@ -1293,40 +1640,40 @@ func (p *Pvr) postObjects(pvrRemote pvrapi.PvrRemote, force bool) error {
 		if response.StatusCode() != http.StatusOK &&
 			response.StatusCode() != http.StatusConflict {
 			err = errors.New("Error posting object " + strconv.Itoa(response.StatusCode()))
-			return errout(err)
+			return infoError(k, v, err)
 		}
 
 		if response.StatusCode() == http.StatusConflict {
-			_str := remoteObject.ObjectName[0:Min(len(remoteObject.ObjectName)-1, 12)] + " "
 			objectType := response.Header().Get(objects.HttpHeaderPantahubObjectType)
-			if !force {
-				if objectType == objects.ObjectTypeLink {
-					fmt.Fprintln(os.Stderr, _str+"[LK]")
-				} else if objectType == objects.ObjectTypeObject {
-					fmt.Fprintln(os.Stderr, _str+"[OK]")
-				} else {
-					fmt.Fprintln(os.Stderr, _str+"[OK]")
-				}
-				continue
+			existsEvent := PvrEvent{
+				Type:   EventObjectUploadDone,
+				Name:   remoteObject.ObjectName,
+				Sha:    remoteObject.Sha,
+				Status: EventStatusOk,
 			}
-
-			// if force
 			if objectType == objects.ObjectTypeLink {
-				fmt.Fprintln(os.Stderr, _str+"[LK]")
+				existsEvent.Status = EventStatusLink
+			}
+
+			// with force we upload again unless it is just a link
+			if !force || objectType == objects.ObjectTypeLink {
+				p.emit(existsEvent)
 				continue
 			}
 		}
 
 		err = pvjson.Unmarshal(response.Body(), &remoteObject)
 		if err != nil {
-			return errout(err)
+			return infoError(k, v, err)
 		}
 
-		fileName := filepath.Join(p.Objdir, v)
 		filePut := FilePut{
 			sourceFile: fileName,
 			objName:    remoteObject.ObjectName,
 			putUrl:     remoteObject.SignedPutUrl,
+			objectsUrl: uri,
+			object:     remoteObject,
+			resumable:  response.Header().Get(HttpHeaderPvrResumableUpload) != "",
 		}
 
 		if response.StatusCode() == http.StatusConflict && force {
@@ -1339,29 +1686,31 @@ func (p *Pvr) postObjects(pvrRemote pvrapi.PvrRemote, force bool) error {
 			filePut.objType = objects.ObjectTypeObject
 		}
 		filePuts = append(filePuts, filePut)
-		fmt.Fprintln(os.Stderr, " [OK]")
+		p.emit(PvrEvent{
+			Type:    EventObjectInfoPosted,
+			Name:    k,
+			Sha:     v,
+			Status:  EventStatusOk,
+			Message: "Posting object info for: " + k + " ... [OK]",
+		})
 	}
 
 	filePutResults = p.putFiles(filePuts...)
 
+	failed := []string{}
 	for _, v := range filePutResults {
 		if v.err != nil {
-			err = fmt.Errorf("error putting file %s: %s", v.objName, v.err.Error())
-			return errout(err)
-		}
-		if v.res.StatusCode != 200 {
-			err = errors.New("REST call failed. " +
-				strconv.Itoa(v.res.StatusCode) + "  " + v.res.Status)
-			return errout(err)
+			failed = append(failed, v.objName+": "+v.err.Error())
 		}
 	}
 
-	return nil
-}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%d of %d object uploads failed:\n\t%s", len(failed),
+			len(filePutResults), strings.Join(failed, "\n\t"))
+	}
 
-func errout(err error) error {
-	fmt.Fprintf(os.Stderr, " [ERROR: "+err.Error()+"]")
-	return err
+	return nil
 }
 
 func (p *Pvr) PutRemote(repoPath *url.URL, force bool) error {
@@ -1416,8 +1765,12 @@ func (p *Pvr) PutRemote(repoPath *url.URL, force bool) error {
 
 func (p *Pvr) Put(uri string, force bool) error {
 
+	uri, isRemote, err := p.resolveRemote(uri, remotePut)
+	if err != nil {
+		return err
+	}
 	if uri == "" {
-		uri = p.Pvrconfig.DefaultPutUrl
+		return errors.New("no destination given and no default remote; see pvr remote add")
 	}
 
 	url, err := url.Parse(uri)
@@ -1427,11 +1780,16 @@ func (p *Pvr) Put(uri string, force bool) error {
 	}
 
 	if url.Scheme == "" {
-		_, err := os.Stat(filepath.Join(uri, "json"))
-		// if we get pointed at a pvr repo on disk, go local
+		repoPath, ref := SplitRefSuffix(uri)
+		_, err := os.Stat(filepath.Join(repoPath, "json"))
+		// if we get pointed at a pvr repo on disk, go local; with @ref we
+		// only update that branch or tag and leave its json alone
 		if err == nil {
-			err = p.PutLocal(uri)
-			return p.saveWithError(uri, err)
+			err = p.putLocal(repoPath, ref == "")
+			if err == nil && ref != "" {
+				err = p.putLocalRef(repoPath, ref, force)
+			}
+			return p.saveWithError(uri, !isRemote, err)
 		} else if !os.IsNotExist(err) {
 			return errors.New("error testing existance of json file in provided path: " + err.Error())
 		}
@@ -1457,15 +1815,13 @@ func (p *Pvr) Put(uri string, force bool) error {
 	return err
 }
 
-func (p *Pvr) saveWithError(uri string, err error) error {
-	if p.Pvrconfig.DefaultGetUrl == "" {
-		p.Pvrconfig.DefaultGetUrl = uri
-	}
-	if p.Pvrconfig.DefaultPutUrl == "" {
-		p.Pvrconfig.DefaultPostUrl = uri
-	}
+// saveWithError saves the config after a successful operation; with
+// remember uri becomes the default remote if there is none yet
+func (p *Pvr) saveWithError(uri string, remember bool, err error) error {
 	if err == nil {
-		p.Pvrconfig.DefaultPutUrl = uri
+		if remember {
+			p.rememberRemote(uri)
+		}
 		err = p.SaveConfig()
 	}
 
@@ -1562,96 +1918,137 @@ func (p *Pvr) postRemoteJson(remotePvr pvrapi.PvrRemote, pvrMap PvrMap, envelope
 	return response.Body(), nil
 }
 
-// make a json post to a REST endpoint. You can provide metainfo etc. in post
-// argument as json. postKey if set will be used as key that refers to the posted
-// json. Example usage: json blog post, json revision repo with commit message etc
-func (p *Pvr) Post(uri string, envelope string, commitMsg string, rev int, force bool) error {
+// postUrl resolves the destination of Post
+func (p *Pvr) postUrl(uri string) (resolved string, repoUrl *url.URL, isRemote bool, err error) {
 
+	uri, isRemote, err = p.resolveRemote(uri, remotePost)
+	if err != nil {
+		return "", nil, false, err
+	}
 	if uri == "" {
-		uri = p.Pvrconfig.DefaultPostUrl
+		return "", nil, false, errors.New("no destination given and no default remote; see pvr remote add")
 	}
+
 	url, err := url.Parse(uri)
 
 	if err != nil {
-		return err
+		return "", nil, false, err
 	}
 
 	if url.Scheme == "" {
 		_, err := os.Stat(filepath.Join(uri, "json"))
 		// if we get pointed at a pvr repo on disk, go local
 		if err == nil {
-			return errors.New("Post must be a remote REST endpoint, not: " + uri)
+			return "", nil, false, errors.New("Post must be a remote REST endpoint, not: " + uri)
 		} else if !os.IsNotExist(err) {
-			return errors.New("error testing existance of json file in provided path: " + err.Error())
+			return "", nil, false, errors.New("error testing existance of json file in provided path: " + err.Error())
 		}
 
 		repoBaseURL, err := url.Parse(p.Session.GetApp().Metadata["PVR_REPO_BASEURL"].(string))
 		if err != nil {
-			return errors.New("error parsing PVR_REPO_BASEURL setting, see --help - ERROR:" + err.Error())
+			return "", nil, false, errors.New("error parsing PVR_REPO_BASEURL setting, see --help - ERROR:" + err.Error())
 		}
 
-		if !path.IsAbs(uri) {
-			uri = "/" + uri
+		refUri := uri
+		if !path.IsAbs(refUri) {
+			refUri = "/" + refUri
 		}
 
-		refURL, err := url.Parse(uri)
+		refURL, err := url.Parse(refUri)
 		if err != nil {
-			return errors.New("error parsing provided repo name, see --help - ERROR:" + err.Error())
+			return "", nil, false, errors.New("error parsing provided repo name, see --help - ERROR:" + err.Error())
 		}
 
 		url = repoBaseURL.ResolveReference(refURL)
 	}
 
-	remotePvr, err := p.initializeRemote(url)
+	return uri, url, isRemote, nil
+}
+
+// PvrPostResult is the revision a post created
+type PvrPostResult struct {
+	Rev      string `json:"rev"`
+	StateSha string `json:"state-sha"`
+	TrailId  string `json:"trail-id"`
+}
 
+// parsePostResult reads the response of a post url
+func parsePostResult(body []byte) (*PvrPostResult, error) {
+	responseMap := map[string]interface{}{}
+	err := pvjson.Unmarshal(body, &responseMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = p.postObjects(remotePvr, force)
+	result := PvrPostResult{}
+	result.StateSha, _ = responseMap["state-sha"].(string)
+	result.TrailId, _ = responseMap["trail-id"].(string)
+	revLocalNumber, _ := responseMap["rev"].(json.Number)
+	result.Rev = fmt.Sprintf("%s", revLocalNumber)
+	if result.Rev == "-1" {
+		result.Rev, _ = responseMap["revlocal"].(string)
+	}
 
+	return &result, nil
+}
+
+// make a json post to a REST endpoint. You can provide metainfo etc. in post
+// argument as json. postKey if set will be used as key that refers to the posted
+// json. Example usage: json blog post, json revision repo with commit message etc
+func (p *Pvr) Post(uri string, envelope string, commitMsg string, rev int, force bool) (*PvrPostResult, error) {
+
+	uri, url, isRemote, err := p.postUrl(uri)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	body, err := p.postRemoteJson(remotePvr, p.PristineJsonMap, envelope, commitMsg, rev, force)
+	remotePvr, err := p.initializeRemote(url)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	responseMap := map[string]interface{}{}
-	err = pvjson.Unmarshal(body, &responseMap)
+	err = p.postObjects(remotePvr, force)
+
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	stateSha := responseMap["state-sha"].(string)
-	revLocalNumber := responseMap["rev"].(json.Number)
-	revLocal := fmt.Sprintf("%s", revLocalNumber)
-	if revLocal == "-1" {
-		revLocal = responseMap["revlocal"].(string)
-	}
+	body, err := p.postRemoteJson(remotePvr, p.PristineJsonMap, envelope, commitMsg, rev, force)
 
-	fmt.Fprintf(os.Stderr, "Successfully posted Revision %s (%s) to device id %s\n", revLocal,
-		stateSha[:Min(8, len(stateSha))], responseMap["trail-id"])
+	if err != nil {
+		return nil, err
+	}
 
-	p.Pvrconfig.DefaultPostUrl = uri
-	if p.Pvrconfig.DefaultGetUrl == "" {
-		p.Pvrconfig.DefaultGetUrl = uri
+	result, err := parsePostResult(body)
+	if err != nil {
+		return nil, err
 	}
 
-	if p.Pvrconfig.DefaultPutUrl == "" {
-		p.Pvrconfig.DefaultPutUrl = uri
+	p.emit(PvrEvent{
+		Type:   EventRevisionPosted,
+		Name:   result.TrailId,
+		Sha:    result.StateSha,
+		Status: EventStatusOk,
+		Message: fmt.Sprintf("Successfully posted Revision %s (%s) to device id %s", result.Rev,
+			result.StateSha[:Min(8, len(result.StateSha))], result.TrailId),
+	})
+
+	if isRemote {
+		return result, nil
 	}
 
+	p.rememberRemote(uri)
 	err = p.SaveConfig()
 
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "WARNING: couldnt save config "+err.Error())
+		p.emit(PvrEvent{
+			Type:    EventWarning,
+			Message: "couldnt save config " + err.Error(),
+		})
 	}
 
-	return nil
+	return result, nil
 }
 
 func (p *Pvr) UnpackRepo(repoPath, outDir string, options []string) error {
@@ -1666,8 +2063,9 @@ func (p *Pvr) GetStateJson(uri string) (
 	var u *url.URL
 	var data []byte
 
-	if uri == "" {
-		uri = p.Pvrconfig.DefaultGetUrl
+	uri, _, err = p.resolveRemote(uri, remoteGet)
+	if err != nil {
+		return
 	}
 
 	u, err = url.Parse(uri)
@@ -1785,7 +2183,7 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 		return objectsCount, err
 	}
 
-	repoPath := repoUri.Path
+	repoPath, ref := SplitRefSuffix(repoUri.Path)
 
 	// lets keep only those matching prefix
 	partPrefixes := []string{}
@@ -1807,15 +2205,24 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 		return objectsCount, err
 	}
 
-	// if we dont have a dir for local we might have a tarball export
-	if !f.IsDir() {
+	// if we dont have a dir for local we might have a tarball export, which
+	// has no history
+	var sourceRepo *Pvr
+	if f.IsDir() {
+		sourceRepo = bareRepo(repoPath)
+	} else {
+		if ref != "" {
+			return objectsCount, errors.New("exported repositories have no branches or tags; cannot get @" + ref)
+		}
+
+		tarPath := repoPath
 		repoPath, err = ioutil.TempDir(os.TempDir(), "pvr-tmprepo-")
 		if err != nil {
 			return objectsCount, err
 		}
 		defer os.RemoveAll(repoPath)
 
-		err = p.UnpackRepo(repoUri.Path, repoPath, []string{})
+		err = p.UnpackRepo(tarPath, repoPath, []string{})
 		if err != nil {
 			return objectsCount, err
 		}
@@ -1829,7 +2236,12 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 		return objectsCount, err
 	}
 
-	jsonData, err := ioutil.ReadFile(jsonRepo)
+	var jsonData []byte
+	if ref != "" {
+		jsonData, err = bareRepo(repoPath).GetRefState(ref)
+	} else {
+		jsonData, err = ioutil.ReadFile(jsonRepo)
+	}
 	if err != nil {
 		return objectsCount, err
 	}
@@ -1862,19 +2274,9 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 		}
 	}
 
-	// first copy new json, but only rename at the very end after all else succeed
-	configRepo := filepath.Join(repoPath, "config")
-
-	var config *PvrConfig
-
-	configData, _ := ioutil.ReadFile(configRepo)
-	config = new(PvrConfig)
-	// keep default config if there is no config file yet
-	if configData != nil {
-		err = pvjson.Unmarshal(configData, config)
-		if err != nil {
-			return objectsCount, errors.New("JSON Unmarshal (config.new):" + err.Error())
-		}
+	objects, err := bareRepoObjectStore(repoPath)
+	if err != nil {
+		return objectsCount, err
 	}
 
 	for k, v := range jsonMap {
@@ -1884,124 +2286,44 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 		if strings.HasPrefix(k, "#spec") {
 			continue
 		}
-		getPath := filepath.Join(repoPath, "objects", v.(string))
-
-		// config can overload objectsdir for remote repo; not abs and abs
-		if config != nil && config.ObjectsDir != "" {
-			if !filepath.IsAbs(config.ObjectsDir) {
-				getPath = filepath.Join(repoPath, "..", config.ObjectsDir, v.(string))
-			} else {
-				getPath = filepath.Join(config.ObjectsDir, v.(string))
-			}
-		}
-
-		objPathNew := filepath.Join(p.Objdir, v.(string)+".new")
-		objPath := filepath.Join(p.Objdir, v.(string))
-		fileExists, err := IsFileExists(objPath)
-
+		sha := v.(string)
+		fileExists, err := p.Objects.Has(sha)
 		if err != nil {
 			return objectsCount, err
 		}
 
+		event := PvrEvent{
+			Type:   EventObjectCopied,
+			Name:   k,
+			Sha:    sha,
+			Status: EventStatusOk,
+		}
 		if showFilenames {
 			cache := " cache"
 			if !fileExists {
 				cache = ""
-			}
-
-			if len(k) >= 15 {
-				fmt.Fprintln(os.Stderr, k[:15]+" [OK"+cache+"]")
 			} else {
-				fmt.Fprintln(os.Stderr, k+" [OK"+cache+"]")
+				event.Status = EventStatusCached
 			}
-
+			event.Message = k[:Min(15, len(k))] + " [OK" + cache + "]"
 		} else {
-			fmt.Fprintln(os.Stderr, "pulling objects file "+getPath+"-> "+objPathNew)
+			event.Message = "pulling object " + sha + " from " + objects.String() + " -> " + p.Objects.String()
 		}
 
-		err = Copy(objPathNew, getPath)
-
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "ERROR : "+err.Error())
-			return objectsCount, err
-		}
-		err = os.Rename(objPathNew, objPath)
+		err = copyObject(p.Objects, objects, sha)
 		if err != nil {
+			event.Status = EventStatusError
+			event.Error = err.Error()
+			event.Message = "ERROR : " + err.Error()
+			p.emit(event)
 			return objectsCount, err
 		}
+		p.emit(event)
 		objectsCount++
 	}
 
-	var jsonMerged []byte
-	if merge {
-		pJSONMap := *state
-		for _, unpartPrefix := range unpartPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, unpartPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-		}
-		jsonBytes, err := cjson.Marshal(pJSONMap)
-		if err != nil {
-			return objectsCount, err
-		}
-
-		jsonDataSelect, err := cjson.Marshal(jsonMap)
-		if err != nil {
-			return objectsCount, err
-		}
-
-		jsonMerged, err = jsonpatch.MergePatchIndent(jsonBytes, jsonDataSelect, "", "	")
-		if err != nil {
-			return objectsCount, err
-		}
-	} else {
-		// manually remove everything not matching the part from fragement ...
-		pJSONMap := *state
-
-		if len(partPrefixes) == 0 {
-			partPrefixes = append(partPrefixes, "")
-		}
-
-		for _, partPrefix := range partPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, partPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-			// add back all from new map
-			for k, v := range jsonMap {
-				if strings.HasPrefix(k, partPrefix) {
-					pJSONMap[k] = v
-				}
-			}
-		}
-		for _, unpartPrefix := range unpartPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, unpartPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-		}
-
-		jsonMerged, err = cjson.Marshal(pJSONMap)
-	}
-
-	if err != nil {
-		return objectsCount, err
-	}
-
-	err = pvjson.Unmarshal(jsonMerged, state)
-	if err != nil {
-		return objectsCount, err
-	}
-
-	jsonMerged, err = cjson.Marshal(state)
-
+	jsonMerged, conflicts, err := p.mergeIntoState(getPath, sourceRepo, ref, state,
+		updatePristineJson, jsonMap, merge, partPrefixes, unpartPrefixes)
 	if err != nil {
 		return objectsCount, err
 	}
@@ -2016,6 +2338,11 @@ func (p *Pvr) GetRepoLocal(getPath string, merge bool, showFilenames bool, state
 
 		// all succeeded, atomically commiting the json
 		err = os.Rename(filepath.Join(p.Pvrdir, "json.new"), filepath.Join(p.Pvrdir, "json"))
+		if err != nil {
+			return objectsCount, err
+		}
+
+		err = p.recordMerge(getPath, jsonData, conflicts)
 	}
 
 	return objectsCount, err
@@ -2051,48 +2378,72 @@ func (p *Pvr) getURLBuf(url string) ([]byte, error) {
 	return jsonData, nil
 }
 
+// grabFailure is a download grabObjects could not complete
+type grabFailure struct {
+	req *grab.Request
+	err error
+}
+
+// finishObjectDownload verifies the object downloaded to its .new file
+// against the sha it is named after and moves it into place
+func finishObjectDownload(tmpPath string) error {
+	objPath := strings.TrimSuffix(tmpPath, ".new")
+	sha := filepath.Base(objPath)
+
+	fileSha, err := FiletoSha(tmpPath)
+	if err != nil {
+		return err
+	}
+	if fileSha != sha {
+		os.Remove(tmpPath)
+		return errors.New("object " + sha + " is corrupt: downloaded content has sha " + fileSha)
+	}
+
+	return os.Rename(tmpPath, objPath)
+}
+
+func grabTotal(resp *grab.Response) int64 {
+	if resp.HTTPResponse == nil {
+		return 0
+	}
+	return resp.HTTPResponse.ContentLength
+}
+
+// grabObjects downloads all requests to their .new files and moves them
+// into place once their content matches the sha. Interrupted downloads
+// keep their .new file so that another attempt continues them.
 func (p *Pvr) grabObjects(showFilenames bool, requests ...*grab.Request) (
 	objectsCount int,
-	err error,
+	failures []grabFailure,
 ) {
 	client := grab.NewClient()
-	client.HTTPClient.Transport = http.DefaultTransport
+	client.HTTPClient.Transport = p.rateLimiter().LimitTransport(DefaultRemoteTransport)
 
 	client.UserAgent = "PVR client"
-	respch := client.DoBatch(4, requests...)
+	respch := client.DoBatch(p.transferJobs(), requests...)
 
 	// start a ticker to update progress every 200ms
-	t := time.NewTicker(200 * time.Millisecond)
-
-	progressBars := map[*grab.Request]*pb.ProgressBar{}
-	progressBarSlice := make([]*pb.ProgressBar, 0)
+	t := time.NewTicker(progressEventInterval)
+	defer t.Stop()
 
+	names := map[*grab.Request]string{}
 	for _, v := range requests {
 		if showFilenames {
-			fileName := v.Label
-			if len(v.Label) >= 15 {
-				fileName = v.Label[:15]
-			}
-			progressBars[v] = pb.New(0).Prefix(fileName)
+			names[v] = v.Label
 		} else {
-			shortFile := filepath.Base(v.Filename)[:15]
-			progressBars[v] = pb.New(0).Prefix(shortFile)
+			names[v] = strings.TrimSuffix(filepath.Base(v.Filename), ".new")
 		}
-		progressBars[v].ShowCounters = false
-		progressBars[v].SetUnits(pb.KB)
-		progressBarSlice = append(progressBarSlice, progressBars[v])
+		p.emit(PvrEvent{
+			Type: EventObjectDownloadStarted,
+			Name: names[v],
+			Sha:  strings.TrimSuffix(filepath.Base(v.Filename), ".new"),
+		})
 	}
 
 	// monitor downloads
 	completed := 0
-	inProgress := 0
 	responses := make([]*grab.Response, 0)
 
-	pool, err := pb.StartPool(progressBarSlice...)
-	if err != nil {
-		goto err
-	}
-
 	for completed < len(requests) {
 		select {
 		case resp := <-respch:
@@ -2107,41 +2458,32 @@ func (p *Pvr) grabObjects(showFilenames bool, requests ...*grab.Request) (
 			for i, resp := range responses {
 				if resp != nil && resp.IsComplete() {
 					req := resp.Request
-					// print final result
-					if resp.Err() != nil && grab.ErrFileExists != resp.Err() {
-						log.Println("ERROR: Downloading " + resp.Err().Error())
-						progressBars[req].Finish()
-						progressBars[req].ShowBar = false
-						progressBars[req].ShowPercent = false
-						progressBars[req].ShowCounters = false
-						progressBars[req].ShowFinalTime = false
-						goto err
-
-					} else {
-						progressBars[req].Finish()
-						progressBars[req].ShowFinalTime = false
-						progressBars[req].ShowPercent = false
-						progressBars[req].ShowCounters = false
-						progressBars[req].ShowTimeLeft = false
-						progressBars[req].ShowBar = false
-						if grab.ErrFileExists == resp.Err() {
-							if req.Tag == objects.ObjectTypeLink {
-								progressBars[req].Postfix(" [LK cache]")
-							} else if req.Tag == objects.ObjectTypeObject {
-								progressBars[req].Postfix(" [OK cache]")
-							} else {
-								progressBars[req].Postfix(" [OK cache]")
-							}
-						} else if req.Tag == objects.ObjectTypeLink {
-							progressBars[req].Postfix(" [LK]")
-						} else if req.Tag == objects.ObjectTypeObject {
-							progressBars[req].Postfix(" [OK]")
-						} else {
-							progressBars[req].Postfix(" [OK]")
-						}
-						progressBars[req].Set64(progressBars[req].Total)
+					event := PvrEvent{
+						Type:   EventObjectDownloadDone,
+						Name:   names[req],
+						Sha:    strings.TrimSuffix(filepath.Base(req.Filename), ".new"),
+						Status: EventStatusOk,
+						Bytes:  resp.BytesComplete(),
+						Total:  grabTotal(resp),
+					}
+
+					err := resp.Err()
+					if err == nil {
+						err = finishObjectDownload(req.Filename)
+					}
+					if err == nil {
+						err = p.storeObjectFile(event.Sha)
 					}
 
+					if err != nil {
+						event.Status = EventStatusError
+						event.Error = err.Error()
+						failures = append(failures, grabFailure{req: req, err: err})
+					} else if req.Tag == objects.ObjectTypeLink {
+						event.Status = EventStatusLink
+					}
+					p.emit(event)
+
 					// mark completed
 					responses[i] = nil
 					completed++
@@ -2149,31 +2491,70 @@ func (p *Pvr) grabObjects(showFilenames bool, requests ...*grab.Request) (
 			}
 
 			// update downloads in progress
-			inProgress = 0
 			for _, resp := range responses {
 				if resp != nil {
 					req := resp.Request
-					inProgress++
-					progressBars[req].Total = resp.HTTPResponse.ContentLength
-					progressBars[req].ShowTimeLeft = true
-					progressBars[req].ShowCounters = true
-					progressBars[req].ShowPercent = true
-					progressBars[req].Set64(resp.BytesComplete())
-					progressBars[req].SetUnits(pb.KB)
+					p.emit(PvrEvent{
+						Type:  EventObjectDownloadProgress,
+						Name:  names[req],
+						Sha:   strings.TrimSuffix(filepath.Base(req.Filename), ".new"),
+						Bytes: resp.BytesComplete(),
+						Total: grabTotal(resp),
+					})
 				}
 			}
 		}
 	}
 
-err:
-	if pool != nil {
-		pool.Stop()
+	return completed - len(failures), failures
+}
+
+// getObjectInfo asks the objects endpoint of pvrRemote for a signed get url
+// of object sha
+func (p *Pvr) getObjectInfo(pvrRemote pvrapi.PvrRemote, sha string) (
+	remoteObject ObjectWithAccess,
+	objectType string,
+	err error,
+) {
+	uri := pvrRemote.ObjectsEndpointUrl + "/" + sha
+
+	response, err := p.Session.DoAuthCall(true, func(req *resty.Request) (*resty.Response, error) {
+		return req.Get(uri)
+	})
+	if err != nil {
+		return remoteObject, "", err
+	}
+
+	if response.StatusCode() != 200 {
+		return remoteObject, "", errors.New("REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	err = pvjson.Unmarshal(response.Body(), &remoteObject)
+	if err != nil {
+		return remoteObject, "", err
+	}
+
+	return remoteObject, response.Header().Get(objects.HttpHeaderPantahubObjectType), nil
+}
+
+// newObjectGrab requests the download of object sha to its .new file in
+// the objects dir
+func (p *Pvr) newObjectGrab(pvrRemote pvrapi.PvrRemote, sha string) (*grab.Request, error) {
+	remoteObject, objectType, err := p.getObjectInfo(pvrRemote, sha)
+	if err != nil {
+		return nil, err
 	}
-	t.Stop()
 
-	objectsCount = completed
+	// we grab them to .new file ... and rename them when verified
+	req, err := grab.NewRequest(path.Join(p.Objdir, sha)+".new", remoteObject.SignedGetUrl)
+	if err != nil {
+		return nil, err
+	}
+	req.Tag = objectType
+	req.Label = remoteObject.ObjectName
 
-	return objectsCount, nil
+	return req, nil
 }
 
 func (p *Pvr) getObjects(showFilenames bool, pvrRemote pvrapi.PvrRemote, jsonMap map[string]interface{}) (
@@ -2188,9 +2569,6 @@ func (p *Pvr) getObjects(showFilenames bool, pvrRemote pvrapi.PvrRemote, jsonMap
 
 	for k, v := range jsonMap {
 		var req *grab.Request
-		var remoteObject ObjectWithAccess
-		var response *resty.Response
-		var uri string
 
 		if isInlineJson(k, v) {
 			continue
@@ -2201,18 +2579,32 @@ func (p *Pvr) getObjects(showFilenames bool, pvrRemote pvrapi.PvrRemote, jsonMap
 
 		v := jsonMap[k].(string)
 
+		// remote object stores might have it from other machines
+		if !p.isLocalObjects() {
+			has, err := p.Objects.Has(v)
+			if err != nil {
+				return objectsCount, err
+			}
+			if has {
+				continue
+			}
+		}
+
 		fullPathV := path.Join(p.Objdir, v)
 
 		fSha, err := FiletoSha(fullPathV)
 		if err != nil && !os.IsNotExist(err) {
-			log.Println("ERROR: error calculating sha for existing file " + fullPathV + ": " + err.Error())
-			return objectsCount, err
+			return objectsCount, errors.New("cannot calculate sha of existing file " + fullPathV + ": " + err.Error())
 		}
 
 		if err == nil && fSha != v {
 			err = os.Remove(fullPathV)
 			if err != nil {
-				log.Println("WARNING: error removing not sha-matching local object: " + fullPathV + " - " + err.Error())
+				p.emit(PvrEvent{
+					Type:    EventWarning,
+					Name:    v,
+					Message: "error removing not sha-matching local object: " + fullPathV + " - " + err.Error(),
+				})
 			}
 		}
 
@@ -2221,8 +2613,6 @@ func (p *Pvr) getObjects(showFilenames bool, pvrRemote pvrapi.PvrRemote, jsonMap
 			continue
 		}
 
-		fmt.Fprintf(os.Stderr, "Getting object info for: "+k+" ... ")
-
 		// only add to downloads if we have not seen this sha already
 		if shaMap[v] != nil {
 			goto cont
@@ -2230,45 +2620,68 @@ func (p *Pvr) getObjects(showFilenames bool, pvrRemote pvrapi.PvrRemote, jsonMap
 			shaMap[v] = "seen"
 		}
 
-		uri = pvrRemote.ObjectsEndpointUrl + "/" + v
-
-		fmt.Fprintf(os.Stderr, "[OK]\n")
-
-		if response, err = p.Session.DoAuthCall(true, func(req *resty.Request) (*resty.Response, error) {
-			return req.Get(uri)
-		}); err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR "+err.Error()+"]\n")
+		req, err = p.newObjectGrab(pvrRemote, v)
+		if err != nil {
+			p.emit(PvrEvent{
+				Type:    EventObjectInfoFetched,
+				Name:    k,
+				Sha:     v,
+				Status:  EventStatusError,
+				Error:   err.Error(),
+				Message: "Getting object info for: " + k + " ... [ERROR " + err.Error() + "]",
+			})
 			return objectsCount, err
 		}
+		p.emit(PvrEvent{
+			Type:    EventObjectInfoFetched,
+			Name:    k,
+			Sha:     v,
+			Status:  EventStatusOk,
+			Message: "Getting object info for: " + k + " ... [OK]",
+		})
+		req.Label = k
 
-		if response.StatusCode() != 200 {
-			return objectsCount, errors.New("REST call failed. " +
-				strconv.Itoa(response.StatusCode()) + "  " + response.Status())
-		}
+		grabs = append(grabs, req)
 
-		err = pvjson.Unmarshal(response.Body(), &remoteObject)
+	cont:
+	}
 
-		if err != nil {
-			return objectsCount, err
+	for attempt := 0; ; attempt++ {
+		count, failures := p.grabObjects(showFilenames, grabs...)
+		objectsCount += count
+
+		if len(failures) == 0 {
+			return objectsCount, nil
 		}
 
-		// we grab them to .new file ... and rename them when completed
-		req, err = grab.NewRequest(fullPathV, remoteObject.SignedGetUrl)
-		if err != nil {
-			return objectsCount, err
+		if attempt >= p.Retries {
+			failed := []string{}
+			for _, f := range failures {
+				failed = append(failed, f.req.Label+": "+f.err.Error())
+			}
+			sort.Strings(failed)
+			return objectsCount, fmt.Errorf("%d object downloads failed:\n\t%s",
+				len(failures), strings.Join(failed, "\n\t"))
 		}
-		req.SkipExisting = true
-		req.Tag = response.Header().Get(objects.HttpHeaderPantahubObjectType)
-		req.Label = remoteObject.ObjectName
 
-		grabs = append(grabs, req)
+		p.emit(PvrEvent{
+			Type: EventWarning,
+			Message: fmt.Sprintf("retrying %d failed object downloads (attempt %d/%d)",
+				len(failures), attempt+1, p.Retries),
+		})
 
-	cont:
+		// signed urls might have expired meanwhile, so ask again
+		grabs = make([]*grab.Request, 0, len(failures))
+		for _, f := range failures {
+			sha := strings.TrimSuffix(filepath.Base(f.req.Filename), ".new")
+			req, err := p.newObjectGrab(pvrRemote, sha)
+			if err != nil {
+				return objectsCount, err
+			}
+			req.Label = f.req.Label
+			grabs = append(grabs, req)
+		}
 	}
-
-	objectsCount, err = p.grabObjects(showFilenames, grabs...)
-
-	return objectsCount, err
 }
 
 func (p *Pvr) GetRepoRemote(url *url.URL, merge bool, showFilenames bool, state *PvrMap) (
@@ -2348,79 +2761,8 @@ func (p *Pvr) GetRepoRemote(url *url.URL, merge bool, showFilenames bool, state
 		return objectsCount, err
 	}
 
-	var jsonMerged []byte
-	if merge {
-
-		pJSONMap := *state
-
-		for _, unpartPrefix := range unpartPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, unpartPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-		}
-
-		json, err := cjson.Marshal(pJSONMap)
-		if err != nil {
-			return objectsCount, err
-		}
-
-		jsonDataSelect, err := cjson.Marshal(jsonMap)
-		if err != nil {
-			return objectsCount, err
-		}
-
-		jsonMerged, err = jsonpatch.MergePatch(json, jsonDataSelect)
-		if err != nil {
-			return objectsCount, err
-		}
-	} else {
-		// manually remove everything not matching the part from fragment ...
-		pJSONMap := *state
-
-		if len(partPrefixes) == 0 {
-			partPrefixes = append(partPrefixes, "")
-		}
-
-		for _, partPrefix := range partPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, partPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-			// add back all from new map
-			for k, v := range jsonMap {
-				if strings.HasPrefix(k, partPrefix) {
-					pJSONMap[k] = v
-				}
-			}
-		}
-
-		for _, unpartPrefix := range unpartPrefixes {
-			// remove all files for name "app/"
-			for k := range pJSONMap {
-				if strings.HasPrefix(k, unpartPrefix) {
-					delete(pJSONMap, k)
-				}
-			}
-		}
-
-		jsonMerged, err = cjson.Marshal(pJSONMap)
-	}
-
-	if err != nil {
-		return objectsCount, err
-	}
-
-	err = pvjson.Unmarshal(jsonMerged, state)
-	if err != nil {
-		return objectsCount, err
-	}
-
-	jsonMerged, err = cjson.Marshal(state)
+	jsonMerged, conflicts, err := p.mergeIntoState(url.String(), nil, "", state,
+		updatePrinstineJson, jsonMap, merge, partPrefixes, unpartPrefixes)
 	if err != nil {
 		return objectsCount, err
 	}
@@ -2435,6 +2777,11 @@ func (p *Pvr) GetRepoRemote(url *url.URL, merge bool, showFilenames bool, state
 
 		// all succeeded, atomically commiting the json
 		err = os.Rename(filepath.Join(p.Pvrdir, "json.new"), filepath.Join(p.Pvrdir, "json"))
+		if err != nil {
+			return objectsCount, err
+		}
+
+		err = p.recordMerge(url.String(), jsonData, conflicts)
 	}
 
 	return objectsCount, err
@@ -2446,8 +2793,20 @@ func (p *Pvr) GetRepo(uri string, merge bool, showFilenames bool, state *PvrMap)
 ) {
 	objectsCount = 0
 
+	uri, isRemote, err := p.resolveRemote(uri, remoteGet)
+	if err != nil {
+		return objectsCount, err
+	}
+
+	// new working copies share the object cache
+	if !p.Initialized {
+		err = p.useObjectCache()
+		if err != nil {
+			return objectsCount, err
+		}
+	}
 	if uri == "" {
-		uri = p.Pvrconfig.DefaultPutUrl
+		return objectsCount, errors.New("no repository given and no default remote; see pvr remote add")
 	}
 
 	url, err := url.Parse(uri)
@@ -2456,8 +2815,6 @@ func (p *Pvr) GetRepo(uri string, merge bool, showFilenames bool, state *PvrMap)
 		return objectsCount, err
 	}
 
-	p.Pvrconfig.DefaultGetUrl = uri
-
 	// if no url scheme try following in order;
 	//  1. is uri a local .pvr repo directory -> GetRepoLocal
 	//  2. if a path with one or two elements -> Prepend https://pvr.pantahub.com
@@ -2485,14 +2842,6 @@ func (p *Pvr) GetRepo(uri string, merge bool, showFilenames bool, state *PvrMap)
 
 	}
 
-	if p.Pvrconfig.DefaultPutUrl == "" {
-		p.Pvrconfig.DefaultPutUrl = uri
-	}
-
-	if p.Pvrconfig.DefaultPostUrl == "" {
-		p.Pvrconfig.DefaultPostUrl = uri
-	}
-
 	objectsCount, err = p.GetRepoRemote(url, merge, showFilenames, state)
 
 	if err != nil {
@@ -2500,9 +2849,15 @@ func (p *Pvr) GetRepo(uri string, merge bool, showFilenames bool, state *PvrMap)
 	}
 
 save:
+	if !isRemote {
+		p.rememberRemote(uri)
+	}
 	err = p.SaveConfig()
+	if err != nil {
+		return objectsCount, err
+	}
 
-	return objectsCount, err
+	return objectsCount, p.TrackObjectCache()
 }
 
 func (p *Pvr) Cleanup() error {
@@ -2512,6 +2867,7 @@ func (p *Pvr) Cleanup() error {
 		return err
 	}
 
+	// files matching .pvrignore are not reported as untracked and stay
 	for _, v := range status.UntrackedFiles {
 		err = os.RemoveAll(path.Join(p.Dir, v))
 		if err != nil {
@@ -2611,10 +2967,9 @@ func (p *Pvr) resetInternal(hardlink bool, canonicalJson bool, state *PvrMap) (e
 				return err
 			}
 		} else {
-			objectP := filepath.Join(p.Objdir, v.(string))
 			if !hardlink {
 				newFileName := targetP + ".new"
-				err = Copy(newFileName, objectP)
+				err = p.checkoutObject(newFileName, v.(string))
 				if err != nil {
 					return err
 				}
@@ -2631,8 +2986,20 @@ func (p *Pvr) resetInternal(hardlink bool, canonicalJson bool, state *PvrMap) (e
 				if err != nil {
 					return err
 				}
-			} else {
-				err = Hardlink(targetP, objectP)
+			} else if hardlink {
+				local, ok := p.Objects.(*LocalObjectStore)
+				if !ok {
+					return errors.New("cannot hardlink objects of " + p.Objects.String() + "; checkouts from remote object stores are copies")
+				}
+				// the objects are shared with other working copies;
+				// keep them from getting edited in place
+				if p.UsesObjectCache() {
+					err = os.Chmod(local.Path(v.(string)), 0444)
+					if err != nil {
+						return err
+					}
+				}
+				err = Hardlink(targetP, local.Path(v.(string)))
 				if err != nil {
 					return err
 				}
@@ -2643,6 +3010,50 @@ func (p *Pvr) resetInternal(hardlink bool, canonicalJson bool, state *PvrMap) (e
 	return nil
 }
 
+// checkoutObject writes the content of object sha to file dst
+func (p *Pvr) checkoutObject(dst string, sha string) error {
+	r, _, err := p.Objects.Get(sha)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	cerr := out.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// addObjectToTar adds object sha of store to writer as archivePath
+func addObjectToTar(writer *tar.Writer, archivePath string, store ObjectStore, sha string) error {
+	object, size, err := store.Get(sha)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	header := new(tar.Header)
+	header.Name = archivePath
+	header.Size = size
+	header.Mode = 0644
+	header.ModTime = time.Now()
+
+	err = writer.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, object)
+	return err
+}
+
 func addToTar(writer *tar.Writer, archivePath, sourcePath string) error {
 
 	stat, err := os.Stat(sourcePath)
@@ -2680,12 +3091,27 @@ func addToTar(writer *tar.Writer, archivePath, sourcePath string) error {
 }
 
 // Export will put the 'json' file first into the archive to allow for
-// stream parsing and validation of json before processing objects
-func (p *Pvr) Export(parts []string, dst string) error {
+// stream parsing and validation of json before processing objects. With a
+// ref the state of that branch or tag is exported instead of the pristine
+// state.
+func (p *Pvr) Export(parts []string, dst string, ref string) error {
 
 	var file *os.File
 	var err error
 
+	state := p.PristineJsonMap
+	if ref != "" {
+		buf, err := p.GetRefState(ref)
+		if err != nil {
+			return err
+		}
+		state = PvrMap{}
+		err = pvjson.Unmarshal(buf, &state)
+		if err != nil {
+			return err
+		}
+	}
+
 	if dst == "-" {
 		file = os.Stdout
 	} else {
@@ -2716,7 +3142,7 @@ func (p *Pvr) Export(parts []string, dst string) error {
 
 	filteredMap := map[string]interface{}{}
 
-	for k, v := range p.PristineJsonMap {
+	for k, v := range state {
 		found := true
 		for _, p := range parts {
 			// full key match (explicit file part) is here
@@ -2765,15 +3191,14 @@ func (p *Pvr) Export(parts []string, dst string) error {
 		return err
 	}
 
-	filesAndObjects, err := p.listFilesAndObjects(parts)
+	filesAndObjects, err := listFilesAndObjectsFromJson(state, parts)
 	if err != nil {
 		return err
 	}
 
 	for _, v := range filesAndObjects {
 		apath := "objects/" + v
-		ipath := filepath.Join(p.Objdir, v)
-		err := addToTar(tw, apath, ipath)
+		err := addObjectToTar(tw, apath, p.Objects, v)
 
 		if err != nil {
 			return err
@@ -2823,12 +3248,15 @@ func (p *Pvr) Import(src string) error {
 			continue
 		}
 
-		var filePath string
 		if filepath.Base(filepath.Dir(header.Name)) == "objects" {
-			filePath = filepath.Join(p.Objdir, filepath.Base(header.Name))
-		} else {
-			filePath = filepath.Join(p.Pvrdir, header.Name)
+			err = p.Objects.Put(filepath.Base(header.Name), tw)
+			if err != nil {
+				return err
+			}
+			continue
 		}
+
+		filePath := filepath.Join(p.Pvrdir, header.Name)
 		filePathNew := filePath + ".new"
 
 		file, err := os.OpenFile(filePathNew, os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
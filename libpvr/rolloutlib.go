@@ -0,0 +1,490 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// status of a rollout
+const (
+	RolloutRunning = "running"
+	RolloutHalted  = "halted"
+	RolloutDone    = "done"
+	RolloutAborted = "aborted"
+)
+
+// status of a device in a rollout
+const (
+	RolloutDevicePending    = "pending"
+	RolloutDevicePosting    = "posting"
+	RolloutDevicePosted     = "posted"
+	RolloutDeviceDone       = "done"
+	RolloutDeviceFailed     = "failed"
+	RolloutDeviceRolledBack = "rolled-back"
+)
+
+// ErrRolloutHalted is returned by RunRollout if the failure threshold got
+// exceeded
+var ErrRolloutHalted = errors.New("rollout halted, failure threshold exceeded")
+
+// PvrRolloutDevice is a device taking part in a rollout. PreviousRev is the
+// revision the device had before the rollout, Stage the index of the stage
+// updating it, -1 until it got one.
+type PvrRolloutDevice struct {
+	PvrFleetDevice
+	Stage       int    `json:"stage"`
+	PreviousRev int    `json:"previous-rev"`
+	Rev         string `json:"rev,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// PvrRollout is a staged rollout of the local state to a fleet of devices.
+// It is kept in .pvr/rollout.json so that an interrupted rollout can be
+// resumed or aborted.
+type PvrRollout struct {
+	BaseUrl          string             `json:"base-url"`
+	Selector         string             `json:"selector"`
+	StateSha         string             `json:"state-sha"`
+	Part             string             `json:"part,omitempty"`
+	Envelope         string             `json:"envelope,omitempty"`
+	CommitMsg        string             `json:"commit-msg,omitempty"`
+	Stages           []string           `json:"stages"`
+	FailureThreshold float64            `json:"failure-threshold"`
+	Stage            int                `json:"stage"`
+	Status           string             `json:"status"`
+	Devices          []PvrRolloutDevice `json:"devices"`
+	Created          time.Time          `json:"created"`
+	Updated          time.Time          `json:"updated"`
+
+	mu sync.Mutex
+}
+
+func (p *Pvr) rolloutFile() string {
+	return filepath.Join(p.Pvrdir, "rollout.json")
+}
+
+// ParseRatio parses a ratio given as percentage, "10%", or fraction, "0.1"
+func ParseRatio(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return 0, errors.New("invalid percentage '" + s + "'")
+		}
+		return v / 100, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("invalid ratio '" + s + "'")
+	}
+	return v, nil
+}
+
+// rolloutStageSize returns how many of total devices have to be updated
+// at the end of stage, a number of devices or a percentage
+func rolloutStageSize(stage string, total int) (int, error) {
+	var n int
+	if strings.HasSuffix(stage, "%") {
+		ratio, err := ParseRatio(stage)
+		if err != nil {
+			return 0, err
+		}
+		n = int(math.Ceil(ratio * float64(total)))
+	} else {
+		v, err := strconv.Atoi(stage)
+		if err != nil {
+			return 0, errors.New("invalid stage '" + stage + "', expected a number of devices or a percentage")
+		}
+		n = v
+	}
+	if n < 0 {
+		return 0, errors.New("invalid stage '" + stage + "'")
+	}
+	if n > total {
+		n = total
+	}
+	return n, nil
+}
+
+// NewRollout prepares a rollout of the local state to the devices matching
+// selector in stages, e.g. "1,10%,100%", each one giving the number of
+// devices updated when it is finished. The rollout halts when the ratio
+// of failed devices exceeds failureThreshold, e.g. "10%". The current
+// revision of each device is recorded for aborting.
+func (p *Pvr) NewRollout(baseURL string, selector string, part string, envelope string,
+	commitMsg string, stages string, failureThreshold string) (*PvrRollout, error) {
+
+	previous, err := p.LoadRollout()
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.Status != RolloutDone && previous.Status != RolloutAborted {
+		return nil, errors.New("there is a " + previous.Status + " rollout already; resume or abort it first")
+	}
+
+	sel, err := ParseDeviceSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	stateSha, err := p.rolloutStateSha()
+	if err != nil {
+		return nil, err
+	}
+
+	r := PvrRollout{
+		BaseUrl:   baseURL,
+		Selector:  selector,
+		Part:      part,
+		Envelope:  envelope,
+		CommitMsg: commitMsg,
+		Status:    RolloutRunning,
+		StateSha:  stateSha,
+		Devices:   []PvrRolloutDevice{},
+		Created:   time.Now(),
+	}
+
+	r.FailureThreshold, err = ParseRatio(failureThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range strings.Split(stages, ",") {
+		stage = strings.TrimSpace(stage)
+		if stage == "" {
+			continue
+		}
+		if _, err := rolloutStageSize(stage, 0); err != nil {
+			return nil, err
+		}
+		r.Stages = append(r.Stages, stage)
+	}
+	if len(r.Stages) == 0 {
+		return nil, errors.New("a rollout needs at least one stage")
+	}
+
+	devices, err := p.Session.SelectDevices(baseURL, sel)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no device matches selector '" + selector + "'")
+	}
+
+	for _, d := range devices {
+		summary, err := p.Session.GetTrailSummary(baseURL, d.Id)
+		if err != nil {
+			return nil, errors.New("cannot get revision of device " + d.Nick + ": " + err.Error())
+		}
+		r.Devices = append(r.Devices, PvrRolloutDevice{
+			PvrFleetDevice: d,
+			Stage:          -1,
+			PreviousRev:    summary.Revision,
+			Status:         RolloutDevicePending,
+		})
+	}
+
+	err = p.SaveRollout(&r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// LoadRollout reads the rollout of the checkout; nil if there is none
+func (p *Pvr) LoadRollout() (*PvrRollout, error) {
+	buf, err := ioutil.ReadFile(p.rolloutFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := PvrRollout{}
+	err = pvjson.Unmarshal(buf, &r)
+	if err != nil {
+		return nil, errors.New("cannot parse " + p.rolloutFile() + ": " + err.Error())
+	}
+	return &r, nil
+}
+
+// SaveRollout writes r to the checkout
+func (p *Pvr) SaveRollout(r *PvrRollout) error {
+	r.Updated = time.Now()
+	buf, err := json.MarshalIndent(r, "", "	")
+	if err != nil {
+		return err
+	}
+
+	rolloutNew := p.rolloutFile() + ".new"
+	err = ioutil.WriteFile(rolloutNew, buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(rolloutNew, p.rolloutFile())
+}
+
+// FailureRatio is the ratio of failed devices among those a stage was
+// started for
+func (r *PvrRollout) FailureRatio() float64 {
+	started, failed := 0, 0
+	for _, d := range r.Devices {
+		if d.Stage < 0 {
+			continue
+		}
+		started++
+		if d.Status == RolloutDeviceFailed {
+			failed++
+		}
+	}
+	if started == 0 {
+		return 0
+	}
+	return float64(failed) / float64(started)
+}
+
+// updateDevice records the outcome for device i and saves the rollout
+func (p *Pvr) updateDevice(r *PvrRollout, i int, status string, rev string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Devices[i].Status = status
+	if rev != "" {
+		r.Devices[i].Rev = rev
+	}
+	r.Devices[i].Error = ""
+	if err != nil {
+		r.Devices[i].Error = err.Error()
+	}
+
+	if err := p.SaveRollout(r); err != nil {
+		p.emit(PvrEvent{
+			Type:    EventWarning,
+			Error:   err.Error(),
+			Message: "cannot save rollout: " + err.Error(),
+		})
+	}
+}
+
+// resolvePosting settles device i of r that was being posted to when the
+// rollout got interrupted: if the trail of the device moved past the
+// revision it had before the rollout, the post made it, otherwise it is
+// pending again
+func (p *Pvr) resolvePosting(r *PvrRollout, i int) error {
+	d := r.Devices[i]
+	summary, err := p.Session.GetTrailSummary(r.BaseUrl, d.Id)
+	if err != nil {
+		return errors.New("cannot get revision of device " + d.Nick + ": " + err.Error())
+	}
+	if summary.Revision > d.PreviousRev {
+		p.updateDevice(r, i, RolloutDevicePosted, strconv.Itoa(summary.Revision), nil)
+	} else {
+		p.updateDevice(r, i, RolloutDevicePending, "", nil)
+	}
+	return nil
+}
+
+// rolloutStateSha is the sha of the local state as it gets rolled out
+func (p *Pvr) rolloutStateSha() (string, error) {
+	buf, err := p.GetCPristineJson()
+	if err != nil {
+		return "", err
+	}
+	buf, err = FormatJsonC(buf)
+	if err != nil {
+		return "", err
+	}
+	return bytesToSha(buf), nil
+}
+
+// RunRollout runs the stages of r from where it stopped. Each stage posts
+// to its devices, then waits up to timeout for every device to finish the
+// new revision. Once the failure ratio exceeds the threshold the rollout
+// halts with ErrRolloutHalted. State is saved after every change, so an
+// interrupted rollout continues where it stopped.
+func (p *Pvr) RunRollout(r *PvrRollout, maxParallel int, timeout time.Duration,
+	interval time.Duration) error {
+
+	if r.Status == RolloutDone || r.Status == RolloutAborted {
+		return errors.New("rollout is " + r.Status)
+	}
+
+	// devices not posted to yet get the local state; it has to be the one
+	// the rollout started with
+	stateSha, err := p.rolloutStateSha()
+	if err != nil {
+		return err
+	}
+	if r.StateSha != "" && stateSha != r.StateSha {
+		return errors.New("the checkout has state " + stateSha + ", not " + r.StateSha +
+			" the rollout started with; check that state out again to continue")
+	}
+	r.Status = RolloutRunning
+
+	for ; r.Stage < len(r.Stages); r.Stage++ {
+		size, err := rolloutStageSize(r.Stages[r.Stage], len(r.Devices))
+		if err != nil {
+			return err
+		}
+
+		stage := []int{}
+		for i := range r.Devices {
+			if r.Devices[i].Stage < 0 && i < size {
+				r.Devices[i].Stage = r.Stage
+			}
+			if r.Devices[i].Stage == r.Stage {
+				stage = append(stage, i)
+			}
+		}
+		err = p.SaveRollout(r)
+		if err != nil {
+			return err
+		}
+
+		p.emit(PvrEvent{
+			Type:    EventRolloutStage,
+			Name:    r.Stages[r.Stage],
+			Message: fmt.Sprintf("Stage %d/%d (%s): %d devices", r.Stage+1, len(r.Stages), r.Stages[r.Stage], len(stage)),
+		})
+
+		// a post got interrupted before its outcome was recorded; the
+		// trail tells whether it made it
+		for _, i := range stage {
+			if r.Devices[i].Status == RolloutDevicePosting {
+				err = p.resolvePosting(r, i)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// post to devices of the stage not posted yet
+		pending := []int{}
+		devices := []PvrFleetDevice{}
+		for _, i := range stage {
+			if r.Devices[i].Status == RolloutDevicePending {
+				pending = append(pending, i)
+				devices = append(devices, r.Devices[i].PvrFleetDevice)
+				r.Devices[i].Status = RolloutDevicePosting
+			}
+		}
+		if len(devices) > 0 {
+			err = p.SaveRollout(r)
+			if err != nil {
+				return err
+			}
+			p.FleetPost(r.BaseUrl, devices, r.Part, r.Envelope, r.CommitMsg, maxParallel, false,
+				func(j int, result PvrFleetResult) {
+					if result.Error != "" {
+						p.updateDevice(r, pending[j], RolloutDeviceFailed, "", errors.New(result.Error))
+					} else {
+						p.updateDevice(r, pending[j], RolloutDevicePosted, result.Rev, nil)
+					}
+				})
+		}
+
+		// wait for the devices of the stage to finish their new revision
+		fleetEach(len(stage), maxParallel, func(j int) {
+			i := stage[j]
+			d := r.Devices[i]
+			if d.Status != RolloutDevicePosted {
+				return
+			}
+			rev, err := strconv.Atoi(d.Rev)
+			if err != nil {
+				p.updateDevice(r, i, RolloutDeviceFailed, "", errors.New("cannot wait for revision '"+d.Rev+"'"))
+				return
+			}
+			step, err := p.Session.WaitForStep(r.BaseUrl, d.Id, rev, timeout, interval, nil)
+			if err == ErrStepFailed {
+				err = fmt.Errorf("%s %s", step.Progress.Status, step.Progress.StatusMsg)
+			}
+			if err != nil {
+				p.updateDevice(r, i, RolloutDeviceFailed, "", err)
+				return
+			}
+			p.updateDevice(r, i, RolloutDeviceDone, "", nil)
+		})
+
+		if r.FailureRatio() > r.FailureThreshold {
+			r.Status = RolloutHalted
+			err = p.SaveRollout(r)
+			if err != nil {
+				return err
+			}
+			return ErrRolloutHalted
+		}
+	}
+
+	r.Status = RolloutDone
+	return p.SaveRollout(r)
+}
+
+// AbortRollout re-posts the revision each device had before the rollout
+// to all devices the rollout posted to
+func (p *Pvr) AbortRollout(r *PvrRollout) error {
+	failed := []string{}
+	for i := range r.Devices {
+		if r.Devices[i].Status == RolloutDevicePosting {
+			err := p.resolvePosting(r, i)
+			if err != nil {
+				failed = append(failed, r.Devices[i].Nick+": "+err.Error())
+				continue
+			}
+		}
+		d := r.Devices[i]
+		if d.Rev == "" || d.Status == RolloutDeviceRolledBack {
+			continue
+		}
+		if d.PreviousRev < 0 {
+			failed = append(failed, d.Nick+": no previous revision")
+			continue
+		}
+
+		msg := fmt.Sprintf("Abort rollout, back to revision %d", d.PreviousRev)
+		_, err := p.RollbackDevice(r.BaseUrl, d.Id, d.PreviousRev, msg)
+		if err != nil {
+			failed = append(failed, d.Nick+": "+err.Error())
+			p.updateDevice(r, i, d.Status, "", err)
+			continue
+		}
+		p.updateDevice(r, i, RolloutDeviceRolledBack, "", nil)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d devices could not be rolled back:\n\t%s", len(failed),
+			strings.Join(failed, "\n\t"))
+	}
+
+	r.Status = RolloutAborted
+	return p.SaveRollout(r)
+}
@@ -0,0 +1,55 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+)
+
+func Example_rolloutStageSize() {
+	for _, v := range []struct {
+		stage string
+		total int
+	}{
+		{"1", 10},
+		{"10%", 10},
+		{"10%", 25},
+		{"100%", 7},
+		{"20", 7},
+		{"0", 7},
+		{"-1", 7},
+		{"most", 7},
+		{"x%", 7},
+	} {
+		n, err := rolloutStageSize(v.stage, v.total)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%s of %d: %d\n", v.stage, v.total, n)
+	}
+	// Output:
+	// 1 of 10: 1
+	// 10% of 10: 1
+	// 10% of 25: 3
+	// 100% of 7: 7
+	// 20 of 7: 7
+	// 0 of 7: 0
+	// invalid stage '-1'
+	// invalid stage 'most', expected a number of devices or a percentage
+	// invalid percentage 'x%'
+}
@@ -0,0 +1,402 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion   = "us-east-1"
+	s3EmptyPayloadSha = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat      = "20060102T150405Z"
+)
+
+// S3ObjectStore keeps objects in a bucket of an S3 compatible storage like
+// MinIO or AWS S3 so CI runners and developer machines can share a single
+// object pool. Credentials come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN; the region from AWS_REGION
+// or the region query parameter of the store url.
+type S3ObjectStore struct {
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	Client *http.Client
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// NewS3ObjectStore opens the bucket referenced by
+// s3://<host>[:port]/<bucket>[/<prefix>][?region=<region>]; s3+http://
+// talks plain http. Buckets are addressed path style.
+func NewS3ObjectStore(location string) (*S3ObjectStore, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.New("bad object store url: " + err.Error())
+	}
+
+	scheme := "https"
+	if u.Scheme == "s3+http" {
+		scheme = "http"
+	}
+
+	path := strings.Trim(u.Path, "/")
+	if u.Host == "" || path == "" {
+		return nil, errors.New("object store url needs host and bucket: " + location)
+	}
+	parts := strings.SplitN(path, "/", 2)
+
+	store := &S3ObjectStore{
+		Endpoint:     scheme + "://" + u.Host,
+		Bucket:       parts[0],
+		Region:       u.Query().Get("region"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       http.DefaultClient,
+	}
+	if len(parts) > 1 {
+		store.Prefix = parts[1] + "/"
+	}
+	if store.Region == "" {
+		store.Region = os.Getenv("AWS_REGION")
+	}
+	if store.Region == "" {
+		store.Region = s3DefaultRegion
+	}
+
+	return store, nil
+}
+
+func (s *S3ObjectStore) Has(sha string) (bool, error) {
+	res, err := s.do(http.MethodHead, s.Prefix+sha, nil, nil, 0, s3EmptyPayloadSha)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, s3ResponseError(res, "HEAD", sha)
+}
+
+func (s *S3ObjectStore) Size(sha string) (int64, error) {
+	res, err := s.do(http.MethodHead, s.Prefix+sha, nil, nil, 0, s3EmptyPayloadSha)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, s3ResponseError(res, "HEAD", sha)
+	}
+	return res.ContentLength, nil
+}
+
+func (s *S3ObjectStore) Get(sha string) (io.ReadCloser, int64, error) {
+	res, err := s.do(http.MethodGet, s.Prefix+sha, nil, nil, 0, s3EmptyPayloadSha)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, 0, s3ResponseError(res, "GET", sha)
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// Put uploads object sha. The sha is the payload hash of the signed
+// request, so the storage itself rejects content that does not match.
+func (s *S3ObjectStore) Put(sha string, r io.Reader) error {
+	// S3 needs the length upfront; spool streams to a temporary file
+	f, ok := r.(interface {
+		io.Reader
+		Stat() (os.FileInfo, error)
+	})
+	if !ok {
+		tmp, err := ioutil.TempFile(os.TempDir(), "pvr-s3-put-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		_, err = io.Copy(tmp, r)
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		f = tmp
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(http.MethodPut, s.Prefix+sha, nil, f, info.Size(), sha)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return s3ResponseError(res, "PUT", sha)
+	}
+	return nil
+}
+
+func (s *S3ObjectStore) List() ([]string, error) {
+	shas := []string{}
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if s.Prefix != "" {
+			query.Set("prefix", s.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(http.MethodGet, "", query, nil, 0, s3EmptyPayloadSha)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			defer res.Body.Close()
+			return nil, s3ResponseError(res, "LIST", s.Prefix)
+		}
+
+		result := s3ListResult{}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.New("cannot parse object list: " + err.Error())
+		}
+
+		for _, c := range result.Contents {
+			sha := strings.TrimPrefix(c.Key, s.Prefix)
+			if IsSha(sha) {
+				shas = append(shas, sha)
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(shas)
+	return shas, nil
+}
+
+func (s *S3ObjectStore) Delete(sha string) error {
+	res, err := s.do(http.MethodDelete, s.Prefix+sha, nil, nil, 0, s3EmptyPayloadSha)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return s3ResponseError(res, "DELETE", sha)
+	}
+	return nil
+}
+
+func (s *S3ObjectStore) String() string {
+	return s.Endpoint + "/" + s.Bucket + "/" + s.Prefix
+}
+
+// do sends a request for key of the bucket signed with AWS signature
+// version 4
+func (s *S3ObjectStore) do(method string, key string, query url.Values,
+	body io.Reader, size int64, payloadSha string) (*http.Response, error) {
+
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("no credentials for object store " + s.String() +
+			"; set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	path := "/" + s.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawPath = s3Escape(path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	s.sign(req, payloadSha, time.Now().UTC())
+
+	return s.Client.Do(req)
+}
+
+func (s *S3ObjectStore) sign(req *http.Request, payloadSha string, now time.Time) {
+	amzDate := now.Format(s3TimeFormat)
+	day := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadSha)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadSha,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+
+	key := s3Hmac([]byte("AWS4"+s.SecretKey), day)
+	key = s3Hmac(key, s.Region)
+	key = s3Hmac(key, "s3")
+	key = s3Hmac(key, "aws4_request")
+	signature := hex.EncodeToString(s3Hmac(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent encodes everything but unreserved characters (and
+// slashes unless encodeSlash) as required for signing
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func s3ResponseError(res *http.Response, op string, key string) error {
+	s3err := s3Error{}
+	body, _ := ioutil.ReadAll(res.Body)
+	msg := res.Status
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		msg += " " + s3err.Code + ": " + s3err.Message
+	}
+	return errors.New("object store " + op + " " + key + " failed: " + msg)
+}
@@ -0,0 +1,40 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+)
+
+func ExampleNewS3ObjectStore() {
+	for _, v := range []string{
+		"s3://minio.lan:9000/pvr-objects?region=eu-central-1",
+		"s3+http://minio.lan:9000/shared/team-a/objects",
+		"s3://minio.lan:9000/",
+	} {
+		store, err := NewS3ObjectStore(v)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%s %q %q\n", store.Endpoint, store.Bucket, store.Prefix)
+	}
+	// Output:
+	// https://minio.lan:9000 "pvr-objects" ""
+	// http://minio.lan:9000 "shared" "team-a/objects/"
+	// object store url needs host and bucket: s3://minio.lan:9000/
+}
@@ -60,6 +60,7 @@ type layerData struct {
 	OutputDir   string
 	Number      int
 	Downloads   chan<- *downloadData
+	Limiter     *RateLimiter
 }
 
 // UpdateIfNecessary update pvr if is necesary but only check on time at the day
@@ -224,6 +225,9 @@ func (pvr *Pvr) getDockerContent(dockerURL string, outputDir, username, password
 
 	fmt.Fprintf(os.Stderr, "\n\rDownloading layers %d ... \r\n", totalLayers)
 
+	// at most --jobs layers are downloaded at once
+	slots := make(chan struct{}, pvr.transferJobs())
+
 	waitGroup.Add(totalLayers)
 	for i, layer := range dockerManifest.Layers {
 		layerdata := &layerData{
@@ -233,9 +237,12 @@ func (pvr *Pvr) getDockerContent(dockerURL string, outputDir, username, password
 			OutputDir:   outputDir,
 			Number:      i + 1,
 			Downloads:   downloads,
+			Limiter:     pvr.rateLimiter(),
 		}
 		go func(layerdata *layerData) {
 			defer waitGroup.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
 			downloadlayers(layerdata)
 		}(layerdata)
 	}
@@ -359,6 +366,9 @@ func downloadlayers(layerdata *layerData) {
 		return
 	}
 
+	layerReader = layerdata.Limiter.LimitReader(layerReader)
+	defer layerReader.Close()
+
 	buf := bufio.NewReader(layerReader)
 	file, err := os.Create(filename)
 
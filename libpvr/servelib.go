@@ -0,0 +1,726 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cjson "github.com/gibson042/canonicaljson-go"
+	"gitlab.com/pantacor/pantahub-base/objects"
+	pvrapi "gitlab.com/pantacor/pvr/api"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+const (
+	// ServeDefaultListen is the address pvr serve listens on by default;
+	// only local clients can connect unless told otherwise
+	ServeDefaultListen = "127.0.0.1:12368"
+
+	// ServeWritePrefix is the path prefix that, followed by the write
+	// token, gives a base url allowing put, post and object uploads
+	ServeWritePrefix = "/w/"
+
+	// ServeUploadsDir collects uploads in progress in the served .pvr
+	ServeUploadsDir = "uploads"
+
+	// ServeJsonKey is the key holding the state in envelopes posted to
+	// a pvr serve post-url
+	ServeJsonKey = "state"
+
+	// HttpHeaderPvrResumableUpload is set on object infos whose signed put
+	// url accepts continuing interrupted uploads: a put with
+	// "Content-Range: bytes */<size>" answers 308 with "Range: bytes=0-<n>"
+	// for the bytes received so far and a put with
+	// "Content-Range: bytes <n+1>-<size-1>/<size>" sends the rest
+	HttpHeaderPvrResumableUpload = "Pvr-Resumable-Upload"
+
+	// how long signed object urls handed out by pvr serve stay valid
+	serveSignedUrlLifetime = time.Hour
+)
+
+// PvrServer exposes a local repository through the pvr remote protocol so
+// that clone, get, put and post work against it like against any other
+// remote. Object data is transferred through signed blob urls just like
+// with pantahub object storage.
+type PvrServer struct {
+	// PublicUrl is the base url clients reach the server under; if empty
+	// it gets derived from the Host of each request
+	PublicUrl string
+
+	// WriteToken allows requests that change the repository if presented
+	// as "Authorization: Bearer <token>" or through base urls below
+	// ServeWritePrefix<token>; without token the repository is read-only
+	WriteToken string
+
+	repo   *Pvr
+	secret []byte
+	mux    *http.ServeMux
+
+	// per object locks of uploads in progress
+	uploads sync.Map
+
+	// serializes updates of the served state and history
+	mu sync.Mutex
+}
+
+// NewPvrServer creates a server for the repository of p. Urls are signed
+// with a random secret so they only stay valid as long as the process runs.
+func NewPvrServer(p *Pvr) (*PvrServer, error) {
+	if !p.Initialized {
+		return nil, errors.New("not a pvr repository: " + p.Dir)
+	}
+
+	s := &PvrServer{
+		repo:   p,
+		secret: make([]byte, 32),
+		mux:    http.NewServeMux(),
+	}
+
+	_, err := rand.Read(s.secret)
+	if err != nil {
+		return nil, errors.New("cannot generate url signing secret: " + err.Error())
+	}
+
+	s.mux.HandleFunc("/.pvrremote", s.handleRemote)
+	s.mux.HandleFunc("/json", s.handleJson)
+	s.mux.HandleFunc("/post", s.handlePost)
+	s.mux.HandleFunc("/objects/", s.handleObjects)
+	s.mux.HandleFunc("/blobs/", s.handleBlobs)
+
+	return s, nil
+}
+
+// ListenAndServe serves the repository on addr until an error occurs
+func (s *PvrServer) ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+	return server.ListenAndServe()
+}
+
+// context keys of the write access and base path of a request
+type serveWritableKey struct{}
+type serveBasePathKey struct{}
+
+func (s *PvrServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logPath := r.URL.Path
+	writable := false
+	basePath := ""
+
+	if s.WriteToken != "" {
+		prefix := ServeWritePrefix + s.WriteToken
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(r.URL.Path, prefix+"/") {
+			writable = true
+			basePath = prefix
+			logPath = ServeWritePrefix + "***" + strings.TrimPrefix(r.URL.Path, prefix)
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+			r2.URL.RawPath = ""
+			r = r2
+		} else if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.WriteToken)) == 1 {
+			writable = true
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), serveWritableKey{}, writable)
+	ctx = context.WithValue(ctx, serveBasePathKey{}, basePath)
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(rec, r.WithContext(ctx))
+
+	event := PvrEvent{
+		Type:    EventInfo,
+		Name:    logPath,
+		Message: r.Method + " " + logPath + " " + strconv.Itoa(rec.status),
+	}
+	if rec.status >= 400 {
+		event.Type = EventWarning
+	}
+	s.repo.emit(event)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// baseUrl is the url clients reached the server under; requests through a
+// write token base url get that one so all announced urls keep the token
+func (s *PvrServer) baseUrl(r *http.Request) string {
+	basePath, _ := r.Context().Value(serveBasePathKey{}).(string)
+	if s.PublicUrl != "" {
+		return strings.TrimSuffix(s.PublicUrl, "/") + basePath
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + basePath
+}
+
+func serveError(w http.ResponseWriter, status int, msg string) {
+	http.Error(w, msg, status)
+}
+
+func serveJson(w http.ResponseWriter, status int, v interface{}) {
+	buf, err := cjson.Marshal(v)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
+
+func (s *PvrServer) checkWritable(w http.ResponseWriter, r *http.Request) bool {
+	// not 403 as clients would take that as a reason to log in
+	if writable, _ := r.Context().Value(serveWritableKey{}).(bool); !writable {
+		serveError(w, http.StatusMethodNotAllowed, "repository is served read-only; writes need the write token")
+		return false
+	}
+	return true
+}
+
+func (s *PvrServer) handleRemote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	base := s.baseUrl(r)
+	serveJson(w, http.StatusOK, pvrapi.PvrRemote{
+		RemoteSpec:         "pvr-serve-1",
+		JsonGetUrl:         base + "/json",
+		JsonKey:            ServeJsonKey,
+		ObjectsEndpointUrl: base + "/objects",
+		PostUrl:            base + "/post",
+		PostFields:         []string{},
+		PostFieldsOpt:      []string{"commit-msg", "author"},
+	})
+}
+
+func (s *PvrServer) handleJson(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		buf, err := ioutil.ReadFile(filepath.Join(s.repo.Pvrdir, "json"))
+		s.mu.Unlock()
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+
+	case http.MethodPut:
+		if !s.checkWritable(w, r) {
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		state := map[string]interface{}{}
+		err = pvjson.Unmarshal(body, &state)
+		if err != nil {
+			serveError(w, http.StatusBadRequest, "state is not a json object: "+err.Error())
+			return
+		}
+		_, status, err := s.applyState(state, "put to "+s.baseUrl(r), remoteAuthor(r))
+		if err != nil {
+			serveError(w, status, err.Error())
+			return
+		}
+		// clients read back the state they put
+		serveJson(w, http.StatusOK, state)
+
+	default:
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *PvrServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.checkWritable(w, r) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	envelope := map[string]interface{}{}
+	err = pvjson.Unmarshal(body, &envelope)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, "envelope is not a json object: "+err.Error())
+		return
+	}
+
+	state, ok := envelope[ServeJsonKey].(map[string]interface{})
+	if !ok {
+		serveError(w, http.StatusBadRequest, "envelope has no '"+ServeJsonKey+"' object")
+		return
+	}
+
+	msg, _ := envelope["commit-msg"].(string)
+	if msg == "" {
+		msg = "post to " + s.baseUrl(r)
+	}
+	author, _ := envelope["author"].(string)
+	if author == "" {
+		author = remoteAuthor(r)
+	}
+
+	rev, status, err := s.applyState(state, msg, author)
+	if err != nil {
+		serveError(w, status, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	history, err := s.repo.Log("", 0)
+	s.mu.Unlock()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	serveJson(w, http.StatusOK, map[string]interface{}{
+		"rev":       len(history),
+		"revision":  rev.Sha,
+		"state-sha": rev.StateSha,
+		"trail-id":  filepath.Base(filepath.Clean(s.repo.Dir)),
+	})
+}
+
+// applyState makes state the json of the served repository and records it
+// as a new revision. All objects the state refers to must have been
+// uploaded before.
+func (s *PvrServer) applyState(state map[string]interface{}, msg string,
+	author string) (*PvrRevision, int, error) {
+
+	for k, v := range state {
+		if isInlineJson(k, v) || strings.HasPrefix(k, "#spec") {
+			continue
+		}
+		sha, ok := v.(string)
+		if !ok || !IsSha(sha) {
+			return nil, http.StatusBadRequest, errors.New("state entry " + k + " is not an object sha")
+		}
+		has, err := s.repo.Objects.Has(sha)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if !has {
+			return nil, http.StatusBadRequest, errors.New("object " + sha + " for " + k + " has not been uploaded")
+		}
+	}
+
+	buf, err := cjson.Marshal(state)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jsonPath := filepath.Join(s.repo.Pvrdir, "json")
+	err = ioutil.WriteFile(jsonPath+".new", buf, 0644)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	err = os.Rename(jsonPath+".new", jsonPath)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	rev, err := s.repo.recordRevision(msg, author, buf)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return rev, http.StatusOK, nil
+}
+
+func remoteAuthor(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "remote@" + host
+}
+
+func (s *PvrServer) handleObjects(w http.ResponseWriter, r *http.Request) {
+	sha := strings.TrimPrefix(r.URL.Path, "/objects/")
+
+	switch r.Method {
+	case http.MethodGet:
+		if !IsSha(sha) {
+			serveError(w, http.StatusBadRequest, "not an object sha: "+sha)
+			return
+		}
+		has, err := s.repo.Objects.Has(sha)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !has {
+			serveError(w, http.StatusNotFound, "object "+sha+" not found")
+			return
+		}
+		reader, size, err := s.repo.Objects.Get(sha)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		reader.Close()
+		w.Header().Set(objects.HttpHeaderPantahubObjectType, objects.ObjectTypeObject)
+		serveJson(w, http.StatusOK, s.objectWithAccess(r, sha, size))
+
+	case http.MethodPost:
+		if !s.checkWritable(w, r) {
+			return
+		}
+		if sha != "" {
+			serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		object := ObjectWithAccess{}
+		err = pvjson.Unmarshal(body, &object)
+		if err != nil || !IsSha(object.Sha) {
+			serveError(w, http.StatusBadRequest, "bad object info")
+			return
+		}
+
+		// 409 tells the client it can skip the upload; the signed urls
+		// still allow re-uploading with --force
+		status := http.StatusOK
+		has, err := s.repo.Objects.Has(object.Sha)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if has {
+			status = http.StatusConflict
+			w.Header().Set(objects.HttpHeaderPantahubObjectType, objects.ObjectTypeObject)
+		}
+		size, _ := strconv.ParseInt(object.Size, 10, 64)
+		result := s.objectWithAccess(r, object.Sha, size)
+		w.Header().Set(HttpHeaderPvrResumableUpload, "yes")
+		result.ObjectName = object.ObjectName
+		result.MimeType = object.MimeType
+		serveJson(w, status, result)
+
+	default:
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *PvrServer) objectWithAccess(r *http.Request, sha string, size int64) ObjectWithAccess {
+	now := time.Now()
+	expires := now.Add(serveSignedUrlLifetime).Unix()
+	blobUrl := s.baseUrl(r) + "/blobs/" + sha
+
+	return ObjectWithAccess{
+		Object: Object{
+			Id:         sha,
+			StorageId:  sha,
+			ObjectName: sha,
+			Sha:        sha,
+			Size:       strconv.FormatInt(size, 10),
+		},
+		SignedGetUrl: blobUrl + s.signature(http.MethodGet, sha, expires),
+		SignedPutUrl: blobUrl + s.signature(http.MethodPut, sha, expires),
+		Now:          strconv.FormatInt(now.Unix(), 10),
+		ExpireTime:   strconv.FormatInt(expires, 10),
+	}
+}
+
+// signature returns the query string granting method on the blob of sha
+// until expires
+func (s *PvrServer) signature(method, sha string, expires int64) string {
+	exp := strconv.FormatInt(expires, 10)
+	return "?expires=" + exp + "&sig=" + s.sign(method, sha, exp)
+}
+
+func (s *PvrServer) sign(method, sha, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + sha + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *PvrServer) checkSignature(r *http.Request, sha string) bool {
+	exp := r.URL.Query().Get("expires")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	sig, err := hex.DecodeString(r.URL.Query().Get("sig"))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(s.sign(r.Method, sha, exp))
+	return hmac.Equal(sig, expected)
+}
+
+func (s *PvrServer) handleBlobs(w http.ResponseWriter, r *http.Request) {
+	sha := strings.TrimPrefix(r.URL.Path, "/blobs/")
+	if !IsSha(sha) {
+		serveError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !s.checkSignature(r, sha) {
+		serveError(w, http.StatusForbidden, "invalid or expired signature")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendObject(w, r, sha)
+
+	case http.MethodPut:
+		if !s.checkWritable(w, r) {
+			return
+		}
+		s.receiveObject(w, r, sha)
+
+	default:
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// sendObject answers with the content of object sha. Objects of a local
+// store answer range requests so interrupted downloads resume.
+func (s *PvrServer) sendObject(w http.ResponseWriter, r *http.Request, sha string) {
+	has, err := s.repo.Objects.Has(sha)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !has {
+		serveError(w, http.StatusNotFound, "object "+sha+" not found")
+		return
+	}
+
+	if local, ok := s.repo.Objects.(*LocalObjectStore); ok {
+		file, err := os.Open(local.Path(sha))
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		http.ServeContent(w, r, sha, info.ModTime(), file)
+		return
+	}
+
+	reader, size, err := s.repo.Objects.Get(sha)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer reader.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, reader)
+}
+
+// parseContentRange parses the Content-Range of resumable uploads;
+// "bytes */<total>" queries the upload state, "bytes <start>-<end>/<total>"
+// continues it. Without header the whole object is sent and total is -1.
+func parseContentRange(header string) (start int64, total int64, query bool, err error) {
+	if header == "" {
+		return 0, -1, false, nil
+	}
+
+	bad := errors.New("bad Content-Range: " + header)
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false, bad
+	}
+	spec := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(spec) != 2 {
+		return 0, 0, false, bad
+	}
+	total, err = strconv.ParseInt(spec[1], 10, 64)
+	if err != nil {
+		return 0, 0, false, bad
+	}
+	if spec[0] == "*" {
+		return 0, total, true, nil
+	}
+	startEnd := strings.SplitN(spec[0], "-", 2)
+	start, err = strconv.ParseInt(startEnd[0], 10, 64)
+	if err != nil {
+		return 0, 0, false, bad
+	}
+	return start, total, false, nil
+}
+
+// writeUploadState answers 308 with the range of bytes received so far
+func writeUploadState(w http.ResponseWriter, received int64) {
+	if received > 0 {
+		w.Header().Set("Range", "bytes=0-"+strconv.FormatInt(received-1, 10))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+// receiveObject stores the uploaded content as object sha. Data is
+// collected in a .upload.new file below .pvr/uploads that survives
+// interrupted uploads so they can be continued; content not matching the
+// sha is rejected.
+func (s *PvrServer) receiveObject(w http.ResponseWriter, r *http.Request, sha string) {
+	lock, _ := s.uploads.LoadOrStore(sha, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	start, total, query, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if total < 0 {
+		total = r.ContentLength
+	}
+
+	uploadsDir := filepath.Join(s.repo.Pvrdir, ServeUploadsDir)
+	err = os.MkdirAll(uploadsDir, 0755)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	partPath := filepath.Join(uploadsDir, sha+".upload.new")
+	var received int64
+	info, err := os.Stat(partPath)
+	if err == nil {
+		received = info.Size()
+	}
+
+	if query {
+		if received == 0 {
+			if has, err := s.repo.Objects.Has(sha); err == nil && has {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		writeUploadState(w, received)
+		return
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if start > 0 {
+		if start != received {
+			writeUploadState(w, received)
+			return
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, err = io.Copy(file, r.Body)
+	closeErr := file.Close()
+	if err != nil {
+		// keep what we got so the client can continue
+		serveError(w, http.StatusBadRequest, "upload interrupted: "+err.Error())
+		return
+	}
+	if closeErr != nil {
+		serveError(w, http.StatusInternalServerError, closeErr.Error())
+		return
+	}
+
+	info, err = os.Stat(partPath)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if total >= 0 && info.Size() < total {
+		writeUploadState(w, info.Size())
+		return
+	}
+
+	fileSha, err := FiletoSha(partPath)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if fileSha != sha {
+		os.Remove(partPath)
+		serveError(w, http.StatusBadRequest, "uploaded content does not match sha "+sha)
+		return
+	}
+
+	part, err := os.Open(partPath)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = s.repo.Objects.Put(sha, part)
+	part.Close()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	os.Remove(partPath)
+
+	w.WriteHeader(http.StatusOK)
+}
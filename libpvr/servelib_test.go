@@ -0,0 +1,74 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+func ExamplePvrServer_ServeHTTP() {
+	dir, _ := ioutil.TempDir("", "pvr-serve-")
+	defer os.RemoveAll(dir)
+
+	session := &Session{}
+	session.SetEventSink(NewJsonLinesEventSink(ioutil.Discard))
+	p, _ := NewPvr(session, dir)
+	p.Init("")
+	p, _ = NewPvr(session, dir)
+
+	kernel := []byte("kernel")
+	sum := sha256.Sum256(kernel)
+	sha := hex.EncodeToString(sum[:])
+	p.Objects.Put(sha, bytes.NewReader(kernel))
+
+	server, _ := NewPvrServer(p)
+	server.WriteToken = "secret"
+
+	state := `{"#spec":"pantavisor-service-system@1","bsp/kernel.img":"` + sha + `"}`
+	do := func(method string, path string, body string, token string) {
+		req := httptest.NewRequest(method, "http://localhost:12368"+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		fmt.Println(method, path, rec.Code)
+		if method == http.MethodPut {
+			fmt.Println(strings.Replace(strings.TrimSpace(rec.Body.String()), sha, "<sha>", 1))
+		}
+	}
+
+	do(http.MethodPost, "/post", `{"state":`+state+`,"commit-msg":"first"}`, "")
+	do(http.MethodPost, "/post", `{"state":`+state+`,"commit-msg":"first"}`, "secret")
+	do(http.MethodPut, "/json", state, "secret")
+	do(http.MethodPut, "/json", `{"#spec":"pantavisor-service-system@1","bsp/kernel.img":"missing"}`, "secret")
+	// Output:
+	// POST /post 405
+	// POST /post 200
+	// PUT /json 200
+	// {"#spec":"pantavisor-service-system@1","bsp/kernel.img":"<sha>"}
+	// PUT /json 400
+	// state entry bsp/kernel.img is not an object sha
+}
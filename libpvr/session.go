@@ -23,6 +23,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/go-resty/resty"
 	"github.com/urfave/cli"
@@ -37,6 +39,16 @@ type Session struct {
 	auth          *PvrAuthConfig
 	Configuration *PvrGlobalConfig
 	configDir     string
+	events        EventSink
+	jobs          int
+	limiter       *RateLimiter
+
+	// loginBearer is sent if no --access-token is given; see useLogin
+	loginBearer string
+
+	// serializes logins and updates of the token cache of parallel
+	// DoAuthCalls so that an expired token gets renewed only once
+	authMu sync.Mutex
 }
 
 func NewSession(app *cli.App) (*Session, error) {
@@ -54,14 +66,89 @@ func NewSession(app *cli.App) (*Session, error) {
 		return nil, err
 	}
 
+	events := defaultEventSink
+	if format, ok := app.Metadata["PVR_EVENTS"].(string); ok {
+		events, err = NewEventSink(format, os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// --jobs and --limit-rate override the global config
+	jobs := configuration.TransferJobs
+	if j, ok := app.Metadata["PVR_JOBS"].(int); ok && j > 0 {
+		jobs = j
+	}
+	if jobs <= 0 {
+		jobs = PoolSize
+	}
+
+	limitRate := configuration.TransferLimitRate
+	if r, ok := app.Metadata["PVR_LIMIT_RATE"].(string); ok && r != "" {
+		limitRate = r
+	}
+	rate, err := ParseRate(limitRate)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Session{
 		app:           app,
 		auth:          authConfig,
 		configDir:     configDir,
 		Configuration: configuration,
+		events:        events,
+		jobs:          jobs,
+		limiter:       NewRateLimiter(rate),
 	}, nil
 }
 
+// useLogin makes the session authenticate with the cached token of the
+// login at authEp and realm (default: pantahub services)
+func (s *Session) useLogin(authEp, realm string) {
+	if realm == "" {
+		realm = "pantahub services"
+	}
+	if s.auth == nil {
+		return
+	}
+	s.loginBearer = s.auth.Tokens[authEp+" realm="+realm].AccessToken
+}
+
+// TransferJobs is the number of objects or layers transferred in parallel
+func (s *Session) TransferJobs() int {
+	if s.jobs <= 0 {
+		return PoolSize
+	}
+	return s.jobs
+}
+
+// RateLimiter limits the bandwidth of all transfers of the session; nil
+// if unlimited
+func (s *Session) RateLimiter() *RateLimiter {
+	return s.limiter
+}
+
+// SetEventSink makes all operations of this session report to sink
+func (s *Session) SetEventSink(sink EventSink) {
+	s.events = sink
+}
+
+func (s *Session) GetEventSink() EventSink {
+	if s.events == nil {
+		return defaultEventSink
+	}
+	return s.events
+}
+
+// Emit timestamps event and sends it to the event sink of the session
+func (s *Session) Emit(event PvrEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	s.GetEventSink().Emit(event)
+}
+
 func (s *Session) GetConfigDir() string {
 	return s.configDir
 }
@@ -101,13 +188,15 @@ func (s *Session) DoAuthCall(withAnon bool, fn WrappableRestyCallFunc) (*resty.R
 	var anonTried bool
 	var interactive bool
 
+	s.authMu.Lock()
 	bearer = s.GetApp().Metadata["PVR_AUTH"].(string)
+	s.authMu.Unlock()
 	if bearer == "" {
 		interactive = true
+		bearer = s.loginBearer
 	}
 
 	for {
-		var newAuthHeader string
 		// legacy flat -a from CLI will give a default token
 		response, err = fn(resty.R().SetAuthToken(bearer))
 		// we continue looping for 401 and 403 error codes, everything
@@ -120,42 +209,54 @@ func (s *Session) DoAuthCall(withAnon bool, fn WrappableRestyCallFunc) (*resty.R
 		if !interactive {
 			break
 		}
-		// if we see www-authenticate, we need to auth ...
-		newAuthHeader = response.Header().Get("www-authenticate")
-
-		// first try cached accesstoken or get a new one
-		if newAuthHeader != "" {
-			// if we already had one run with this auth header, evict from cache
-			if authHeader != "" {
-				s.auth.resetCachedAccessToken(authHeader)
-			}
-			authHeader = newAuthHeader
 
-			bearer, err = s.auth.getCachedAccessToken(authHeader)
-			if err != nil {
-				break
-			}
-			if bearer == "" {
-				bearer, err = s.auth.getNewAccessToken(authHeader, true, withAnon)
+		// one call at a time renews the token; the others find it in
+		// the cache afterwards
+		failed := func() bool {
+			s.authMu.Lock()
+			defer s.authMu.Unlock()
+
+			// if we see www-authenticate, we need to auth ...
+			newAuthHeader := response.Header().Get("www-authenticate")
+
+			// first try cached accesstoken or get a new one
+			if newAuthHeader != "" {
+				// if we already had one run with this auth header, evict from cache
+				if authHeader != "" {
+					s.auth.resetCachedAccessToken(authHeader)
+				}
+				authHeader = newAuthHeader
+
+				bearer, err = s.auth.getCachedAccessToken(authHeader)
+				if err != nil {
+					return true
+				}
+				if bearer == "" {
+					bearer, err = s.auth.getNewAccessToken(authHeader, true, withAnon)
+					anonTried = withAnon
+				}
+				if err != nil {
+					return true
+				}
+
+			} else if response.StatusCode() == http.StatusForbidden {
+				if anonTried {
+					fmt.Fprintln(os.Stderr, "** ACCESS DENIED: user cannot access repository. **")
+				}
+				bearer, err = s.auth.getNewAccessToken(authHeader, false, withAnon && !anonTried)
 				anonTried = withAnon
-			}
-			if err != nil {
-				break
+				if err != nil {
+					return true
+				}
 			}
 
-		} else if response.StatusCode() == http.StatusForbidden {
-			if anonTried {
-				fmt.Fprintln(os.Stderr, "** ACCESS DENIED: user cannot access repository. **")
-			}
-			bearer, err = s.auth.getNewAccessToken(authHeader, false, withAnon && !anonTried)
-			anonTried = withAnon
-			if err != nil {
-				break
-			}
+			// now that we would have a refreshed bearer, lets go again
+			s.GetApp().Metadata["PVR_AUTH"] = bearer
+			return false
+		}()
+		if failed {
+			break
 		}
-
-		// now that we would have a refreshed bearer, lets go again
-		s.GetApp().Metadata["PVR_AUTH"] = bearer
 	}
 
 	return response, err
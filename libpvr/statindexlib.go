@@ -0,0 +1,212 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// PvrStatIndexFilename caches the shas of working copy files by path
+const PvrStatIndexFilename = "index"
+
+// files modified this close to the time we look at them might change again
+// within the mtime granularity without us noticing; they are not cached
+const statIndexRacyWindow = 2 * time.Second
+
+type pvrStatEntry struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Inode uint64 `json:"inode"`
+	Sha   string `json:"sha"`
+}
+
+// PvrStatIndex remembers the sha of files together with size, mtime and
+// inode so unchanged files do not need to be hashed again
+type PvrStatIndex struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]pvrStatEntry
+	dirty   bool
+}
+
+func statEntryOf(info os.FileInfo) pvrStatEntry {
+	return pvrStatEntry{
+		Size:  info.Size(),
+		MTime: info.ModTime().UnixNano(),
+		Inode: fileInode(info),
+	}
+}
+
+// loadStatIndex reads .pvr/index; a missing or broken index is just empty
+func (p *Pvr) loadStatIndex() *PvrStatIndex {
+	index := PvrStatIndex{
+		path:    filepath.Join(p.Pvrdir, PvrStatIndexFilename),
+		entries: map[string]pvrStatEntry{},
+	}
+
+	buf, err := ioutil.ReadFile(index.path)
+	if err != nil {
+		return &index
+	}
+	err = pvjson.Unmarshal(buf, &index.entries)
+	if err != nil {
+		index.entries = map[string]pvrStatEntry{}
+		index.dirty = true
+	}
+	return &index
+}
+
+// Lookup returns the cached sha of relPath if the file did not change
+func (i *PvrStatIndex) Lookup(relPath string, info os.FileInfo) (string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	cached, ok := i.entries[relPath]
+	if !ok {
+		return "", false
+	}
+	entry := statEntryOf(info)
+	entry.Sha = cached.Sha
+	if entry != cached {
+		return "", false
+	}
+	return cached.Sha, true
+}
+
+// Update remembers sha for relPath
+func (i *PvrStatIndex) Update(relPath string, info os.FileInfo, sha string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if time.Since(info.ModTime()) < statIndexRacyWindow {
+		if _, ok := i.entries[relPath]; ok {
+			delete(i.entries, relPath)
+			i.dirty = true
+		}
+		return
+	}
+
+	entry := statEntryOf(info)
+	entry.Sha = sha
+	if i.entries[relPath] == entry {
+		return
+	}
+	i.entries[relPath] = entry
+	i.dirty = true
+}
+
+// Retain drops all entries for paths not in keep
+func (i *PvrStatIndex) Retain(keep map[string]interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for k := range i.entries {
+		if _, ok := keep[k]; !ok {
+			delete(i.entries, k)
+			i.dirty = true
+		}
+	}
+}
+
+// Save writes the index if it changed. The index is only a cache, so
+// callers may ignore errors.
+func (i *PvrStatIndex) Save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+
+	buf, err := json.Marshal(i.entries)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(i.path+".new", buf, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(i.path+".new", i.path)
+	if err != nil {
+		return err
+	}
+	i.dirty = false
+	return nil
+}
+
+type statHashJob struct {
+	relPath  string
+	filePath string
+	info     os.FileInfo
+}
+
+// hashFiles hashes the files of jobs in parallel, updates the index and
+// returns the shas by relPath
+func (i *PvrStatIndex) hashFiles(jobs []statHashJob) (map[string]string, error) {
+	result := map[string]string{}
+	if len(jobs) == 0 {
+		return result, nil
+	}
+
+	workers := Min(runtime.NumCPU(), len(jobs))
+	jobChan := make(chan statHashJob)
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				sha, err := FiletoSha(job.filePath)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = errors.New("cannot hash " + job.relPath + ": " + err.Error())
+					}
+				} else {
+					result[job.relPath] = sha
+				}
+				mu.Unlock()
+				if err == nil {
+					i.Update(job.relPath, job.info, sha)
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		jobChan <- job
+	}
+	close(jobChan)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
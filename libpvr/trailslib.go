@@ -0,0 +1,356 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty"
+	"gitlab.com/pantacor/pvr/utils/pvjson"
+)
+
+// ErrStepNotFound is returned for revisions a trail does not have (anymore)
+var ErrStepNotFound = errors.New("step not found")
+
+// PantahubStepProgress is the progress a device reports for a step
+type PantahubStepProgress struct {
+	Progress  int    `json:"progress"`
+	Status    string `json:"status"`
+	StatusMsg string `json:"status-msg"`
+}
+
+// PantahubStep is a revision in the trail of a device
+type PantahubStep struct {
+	Rev          int                  `json:"rev"`
+	CommitMsg    string               `json:"commit-msg"`
+	StateSha     string               `json:"state-sha"`
+	Progress     PantahubStepProgress `json:"progress"`
+	StepTime     time.Time            `json:"step-time"`
+	ProgressTime time.Time            `json:"progress-time"`
+	TimeCreated  time.Time            `json:"time-created"`
+	TimeModified time.Time            `json:"time-modified"`
+}
+
+func (s *Session) trailsUrl(baseURL string, parts ...string) (string, error) {
+	burl, err := url.Parse(baseURL)
+	if err != nil {
+		return "", errors.New("Cannot parse baseurl '" + baseURL + "': " + err.Error())
+	}
+	p := PhTrailsEp
+	for _, part := range parts {
+		p += "/" + url.PathEscape(part)
+	}
+	ref, err := url.Parse(p)
+	if err != nil {
+		return "", err
+	}
+	return burl.ResolveReference(ref).String(), nil
+}
+
+// ResolveDevice returns the id of the device referenced by <nick|id> or
+// <owner-nick>/<nick|id>
+func (s *Session) ResolveDevice(baseURL string, ref string) (string, error) {
+	ownerNick := ""
+	deviceNick := ref
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		ownerNick = ref[:i]
+		deviceNick = ref[i+1:]
+	}
+	if deviceNick == "" {
+		return "", errors.New("device nick or id is missing: " + ref)
+	}
+
+	response, err := s.GetDevice(baseURL, deviceNick, ownerNick)
+	if err != nil {
+		return "", err
+	}
+
+	device := struct {
+		Id string `json:"id"`
+	}{}
+	err = pvjson.Unmarshal(response.Body(), &device)
+	if err != nil {
+		return "", errors.New("cannot decode device " + ref + ": " + err.Error())
+	}
+	if device.Id == "" {
+		return "", errors.New("device " + ref + " has no id")
+	}
+	return device.Id, nil
+}
+
+// GetTrailSummary returns the summary of the trail of device deviceId with
+// its latest revision and the progress the device reports
+func (s *Session) GetTrailSummary(baseURL string, deviceId string) (*PantahubDevice, error) {
+	uri, err := s.trailsUrl(baseURL, deviceId, "summary")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
+		return req.Get(uri)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New("REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	summary := PantahubDevice{}
+	err = pvjson.Unmarshal(response.Body(), &summary)
+	if err != nil {
+		return nil, errors.New("cannot decode trail summary of " + deviceId + ": " + err.Error())
+	}
+	return &summary, nil
+}
+
+// GetTrailStep returns revision rev of the trail of device deviceId;
+// ErrStepNotFound if there is none
+func (s *Session) GetTrailStep(baseURL string, deviceId string, rev int) (*PantahubStep, error) {
+	uri, err := s.trailsUrl(baseURL, deviceId, "steps", strconv.Itoa(rev))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
+		return req.Get(uri)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() == http.StatusNotFound {
+		return nil, ErrStepNotFound
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New("REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	step := PantahubStep{}
+	err = pvjson.Unmarshal(response.Body(), &step)
+	if err != nil {
+		return nil, errors.New("cannot decode step " + strconv.Itoa(rev) + " of " + deviceId + ": " + err.Error())
+	}
+	return &step, nil
+}
+
+// trailStepsPageSize is the number of steps GetTrailSteps asks for at once
+const trailStepsPageSize = 50
+
+// getTrailStepsPage lists up to pageSize steps of the trail of device
+// deviceId with revisions below before (all if negative), newest first
+func (s *Session) getTrailStepsPage(baseURL string, deviceId string, before int, pageSize int) ([]PantahubStep, error) {
+	uri, err := s.trailsUrl(baseURL, deviceId, "steps")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
+		req.SetQueryParam("sort", "-rev")
+		req.SetQueryParam("limit", strconv.Itoa(pageSize))
+		if before >= 0 {
+			req.SetQueryParam("rev.lt", strconv.Itoa(before))
+		}
+		return req.Get(uri)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New("REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	page := []PantahubStep{}
+	err = pvjson.Unmarshal(response.Body(), &page)
+	if err != nil {
+		return nil, errors.New("cannot decode steps of " + deviceId + ": " + err.Error())
+	}
+
+	// do not rely on the server honouring the query
+	steps := []PantahubStep{}
+	for _, step := range page {
+		if before < 0 || step.Rev < before {
+			steps = append(steps, step)
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Rev > steps[j].Rev
+	})
+	return steps, nil
+}
+
+// GetTrailSteps pages through the trail of device deviceId from the latest
+// revision backwards. Steps older than since (unless zero) end the
+// listing, as does reaching limit steps (unless limit is 0).
+func (s *Session) GetTrailSteps(baseURL string, deviceId string, since time.Time, limit int) ([]PantahubStep, error) {
+	steps := []PantahubStep{}
+	before := -1
+	for {
+		pageSize := trailStepsPageSize
+		if limit > 0 && limit-len(steps) < pageSize {
+			pageSize = limit - len(steps)
+		}
+
+		page, err := s.getTrailStepsPage(baseURL, deviceId, before, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			return steps, nil
+		}
+
+		for _, step := range page {
+			if limit > 0 && len(steps) >= limit {
+				return steps, nil
+			}
+			if !since.IsZero() && step.StepTime.Before(since) {
+				return steps, nil
+			}
+			steps = append(steps, step)
+		}
+		before = page[len(page)-1].Rev
+		if before <= 0 || len(page) < pageSize {
+			return steps, nil
+		}
+	}
+}
+
+// step progress states reported by pantavisor that end an update
+const (
+	StepStatusDone    = "DONE"
+	StepStatusUpdated = "UPDATED"
+	StepStatusError   = "ERROR"
+	StepStatusWontGo  = "WONTGO"
+)
+
+var (
+	// ErrStepFailed is returned by WaitForStep if the device reported an
+	// error for the step or rolled it back
+	ErrStepFailed = errors.New("device reported failure")
+
+	// ErrWaitTimeout is returned by WaitForStep if the device did not
+	// finish the step in time
+	ErrWaitTimeout = errors.New("timeout waiting for device")
+)
+
+// StepSucceeded tells if status ends an update successfully
+func StepSucceeded(status string) bool {
+	return status == StepStatusDone || status == StepStatusUpdated
+}
+
+// StepFailed tells if status ends an update with an error or rollback
+func StepFailed(status string) bool {
+	return status == StepStatusError || status == StepStatusWontGo
+}
+
+// WaitForStep polls revision rev (the latest if negative) of the trail of
+// device deviceId every interval until the device reports it succeeded
+// (nil error), failed (ErrStepFailed) or timeout passed (ErrWaitTimeout).
+// onChange, if set, gets called whenever the progress status changes.
+// Failing polls are retried until timeout.
+func (s *Session) WaitForStep(baseURL string, deviceId string, rev int,
+	timeout time.Duration, interval time.Duration,
+	onChange func(step *PantahubStep)) (*PantahubStep, error) {
+
+	deadline := time.Now().Add(timeout)
+	var last *PantahubStep
+
+	for {
+		step, err := s.pollStep(baseURL, deviceId, rev)
+		if err != nil && err != ErrStepNotFound {
+			s.Emit(PvrEvent{
+				Type:    EventWarning,
+				Name:    deviceId,
+				Message: "polling step progress failed: " + err.Error(),
+			})
+		}
+
+		if step != nil {
+			rev = step.Rev
+			if onChange != nil && (last == nil || last.Progress.Status != step.Progress.Status) {
+				onChange(step)
+			}
+			last = step
+
+			if StepSucceeded(step.Progress.Status) {
+				return step, nil
+			}
+			if StepFailed(step.Progress.Status) {
+				return step, ErrStepFailed
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return last, ErrWaitTimeout
+		}
+		if remaining < interval {
+			time.Sleep(remaining)
+		} else {
+			time.Sleep(interval)
+		}
+	}
+}
+
+func (s *Session) pollStep(baseURL string, deviceId string, rev int) (*PantahubStep, error) {
+	if rev < 0 {
+		summary, err := s.GetTrailSummary(baseURL, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		rev = summary.Revision
+	}
+	return s.GetTrailStep(baseURL, deviceId, rev)
+}
+
+// GetTrailStepState returns the state json of revision rev of the trail of
+// device deviceId
+func (s *Session) GetTrailStepState(baseURL string, deviceId string, rev int) (PvrMap, error) {
+	uri, err := s.trailsUrl(baseURL, deviceId, "steps", strconv.Itoa(rev), "state")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.DoAuthCall(false, func(req *resty.Request) (*resty.Response, error) {
+		return req.Get(uri)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() == http.StatusNotFound {
+		return nil, ErrStepNotFound
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New("REST call failed. " +
+			strconv.Itoa(response.StatusCode()) + "  " + response.Status())
+	}
+
+	state := PvrMap{}
+	err = pvjson.Unmarshal(response.Body(), &state)
+	if err != nil {
+		return nil, errors.New("cannot decode state of step " + strconv.Itoa(rev) + " of " + deviceId + ": " + err.Error())
+	}
+	return state, nil
+}
@@ -0,0 +1,166 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// largest chunk a rate limited reader passes on at once; keeps the pace
+// smooth for low rates
+const rateLimitChunk = 32 * 1024
+
+// ParseRate parses a transfer rate in bytes per second like curl's
+// --limit-rate does: a number with an optional k, m or g suffix (powers of
+// 1024). Empty or 0 means unlimited.
+func ParseRate(rate string) (int64, error) {
+	orig := rate
+	rate = strings.TrimSpace(rate)
+	if rate == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToLower(rate[len(rate)-1:]) {
+	case "k":
+		multiplier = 1024
+	case "m":
+		multiplier = 1024 * 1024
+	case "g":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		rate = rate[:len(rate)-1]
+	}
+
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid transfer rate '" + orig + "'; use bytes per second with optional k, m or g suffix")
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// RateLimiter paces transfers so that together they stay below a rate in
+// bytes per second. A nil RateLimiter does not limit.
+type RateLimiter struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a limiter for rate bytes per second; nil for rates
+// <= 0
+func NewRateLimiter(rate int64) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &RateLimiter{rate: rate}
+}
+
+// WaitN blocks until n more bytes may be transferred
+func (l *RateLimiter) WaitN(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+type rateLimitedReader struct {
+	io.ReadCloser
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.limiter.WaitN(n)
+	return n, err
+}
+
+// LimitReader returns r throttled by l; r itself if l is nil
+func (l *RateLimiter) LimitReader(r io.ReadCloser) io.ReadCloser {
+	if l == nil || r == nil {
+		return r
+	}
+	return &rateLimitedReader{ReadCloser: r, limiter: l}
+}
+
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		// RoundTrippers must not modify the request they got
+		clone := req.Clone(req.Context())
+		clone.Body = t.limiter.LimitReader(req.Body)
+		req = clone
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	res.Body = t.limiter.LimitReader(res.Body)
+	return res, nil
+}
+
+// LimitTransport returns base with request and response bodies throttled
+// by l; base itself if l is nil
+func (l *RateLimiter) LimitTransport(base http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return base
+	}
+	return &rateLimitedTransport{base: base, limiter: l}
+}
+
+// transferJobs is the number of objects or layers transferred in parallel
+func (p *Pvr) transferJobs() int {
+	if p.Session == nil {
+		return PoolSize
+	}
+	return p.Session.TransferJobs()
+}
+
+// rateLimiter is shared by all transfers of the session
+func (p *Pvr) rateLimiter() *RateLimiter {
+	if p.Session == nil {
+		return nil
+	}
+	return p.Session.RateLimiter()
+}
@@ -0,0 +1,41 @@
+//
+// Copyright 2017-2023  Pantacor Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libpvr
+
+import (
+	"fmt"
+)
+
+func ExampleParseRate() {
+	for _, v := range []string{"", "0", "500", "100k", "1.5M", " 2g ", "fast", "-1k"} {
+		rate, err := ParseRate(v)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(rate)
+	}
+	// Output:
+	// 0
+	// 0
+	// 500
+	// 102400
+	// 1572864
+	// 2147483648
+	// invalid transfer rate 'fast'; use bytes per second with optional k, m or g suffix
+	// invalid transfer rate '-1k'; use bytes per second with optional k, m or g suffix
+}
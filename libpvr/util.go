@@ -937,7 +937,11 @@ var tmplMap = map[string]interface{}{
 		case "StampNano":
 			r = b.Format(time.StampNano)
 		default:
-			r = b.Format(time.Stamp)
+			// a golang time layout like "2006-01-02 15:04:05"
+			r = b.Format(a)
+			if r == a {
+				r = b.Format(time.Stamp)
+			}
 		}
 		return r
 	},
@@ -1012,7 +1016,9 @@ skip:
 		return "", err
 	}
 
-	pathExists, err = IsFileExists(uri.Path)
+	// local repository paths can carry a @<ref> suffix
+	localPath, _ := SplitRefSuffix(uri.Path)
+	pathExists, err = IsFileExists(localPath)
 
 	if err != nil {
 		return "", err
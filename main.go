@@ -97,6 +97,28 @@ func main() {
 			Usage:  "skip tls verify",
 			EnvVar: "PVR_INSECURE",
 		},
+		cli.StringFlag{
+			Name:   "output, o",
+			Usage:  "Use `PVR_OUTPUT` format for the output of inspection commands. Values 'table' (default), 'json' or 'yaml'",
+			EnvVar: "PVR_OUTPUT",
+			Value:  libpvr.OutputFormatTable,
+		},
+		cli.IntFlag{
+			Name:   "jobs, j",
+			Usage:  "Use `PVR_JOBS` parallel object and layer transfers (default: TransferJobs of global-config)",
+			EnvVar: "PVR_JOBS",
+		},
+		cli.StringFlag{
+			Name:   "limit-rate",
+			Usage:  "Limit all transfers together to `PVR_LIMIT_RATE` bytes per second; k, m and g suffixes are supported (default: TransferLimitRate of global-config)",
+			EnvVar: "PVR_LIMIT_RATE",
+		},
+		cli.StringFlag{
+			Name:   "events",
+			Usage:  "Use `PVR_EVENTS` format for progress reporting. Values 'cli' (progress bars - default) or 'json' (one json event per line on stderr)",
+			EnvVar: "PVR_EVENTS",
+			Value:  libpvr.EventFormatCli,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
@@ -105,6 +127,19 @@ func main() {
 		resty.SetDebug(libpvr.IsDebugEnabled)
 
 		c.App.Metadata["PVR_AUTH"] = c.GlobalString("access-token")
+		c.App.Metadata["PVR_EVENTS"] = c.GlobalString("events")
+		c.App.Metadata["PVR_JOBS"] = c.GlobalInt("jobs")
+		c.App.Metadata["PVR_LIMIT_RATE"] = c.GlobalString("limit-rate")
+
+		_, err := libpvr.ParseRate(c.GlobalString("limit-rate"))
+		if err != nil {
+			return err
+		}
+
+		err = libpvr.ValidateOutputFormat(c.GlobalString("output"))
+		if err != nil {
+			return err
+		}
 
 		if c.GlobalString("baseurl") != "" {
 			c.App.Metadata["PVR_BASEURL"] = c.GlobalString("baseurl")
@@ -157,7 +192,10 @@ func main() {
 			transport.Proxy = http.ProxyURL(u)
 		}
 
-		resty.SetTransport(transport)
+		// requests to remotes with own proxy or tls settings get routed
+		// to a transport of their own; see pvr remote add
+		libpvr.DefaultRemoteTransport.Base = transport
+		resty.SetTransport(libpvr.DefaultRemoteTransport)
 
 		libpvr.UpdateIfNecessary(c)
 
@@ -172,6 +210,12 @@ func main() {
 		CommandDiff(),
 		CommandStatus(),
 		CommandCommit(),
+		CommandLog(),
+		CommandShow(),
+		CommandBranch(),
+		CommandTag(),
+		CommandSwitch(),
+		CommandResolve(),
 		CommandSig(),
 		CommandPut(),
 		CommandPost(),
@@ -187,6 +231,11 @@ func main() {
 		CommandPutObjects(),
 		CommandExport(),
 		CommandImport(),
+		CommandGc(),
+		CommandFsck(),
+		CommandServe(),
+		CommandRemote(),
+		CommandCache(),
 		CommandRegister(),
 		CommandScanDeprecated(),
 		CommandPsDeprecated(),
@@ -197,6 +246,8 @@ func main() {
 		CommandWhoami(),
 		CommandLogin(),
 		CommandDevice(),
+		CommandFleet(),
+		CommandRollout(),
 		CommandCompletion(),
 		CommandDmApply(),
 		CommandDmConvert(),